@@ -0,0 +1,742 @@
+package bashgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/siadat/well/erroring"
+	"github.com/siadat/well/syntax/ast"
+	"github.com/siadat/well/syntax/parser"
+	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/syntax/strs/expander"
+	strs_parser "github.com/siadat/well/syntax/strs/parser"
+	strs_scanner "github.com/siadat/well/syntax/strs/scanner"
+	"github.com/siadat/well/syntax/token"
+)
+
+// This package translates a Well program into a standalone Bash script, so
+// that adopting Well does not lock anyone into it.
+//
+// The translation follows these rules:
+//   - Well functions become Bash functions. Arguments become locals.
+//     Returned values are passed through the global variable __well_ret,
+//     so that the stdout of a function is not mixed with its return value.
+//   - External functions become Bash functions that run their command.
+//     Their output is written to stdout, and captured only when it is
+//     assigned to a variable.
+//   - let becomes local (or a global assignment at the top level).
+//   - if, ~~ and !~ become if and [[ =~ ]].
+//
+// Constructs that cannot be translated fail with their position.
+
+type generator struct {
+	parser      *parser.Parser
+	debug       bool
+	indentLevel int
+
+	funcs   map[string]*ast.FuncDecl
+	currFun *ast.FuncDecl
+	tmpID   int
+	helpers map[string]bool
+}
+
+func NewGenerator() *generator {
+	return &generator{}
+}
+
+func (g *generator) SetDebug(v bool) {
+	g.debug = v
+}
+
+const (
+	helperMatch       = "__well_match"
+	helperQuoteDouble = "__well_quote_double"
+	helperQuoteSingle = "__well_quote_single"
+)
+
+var helperBodies = map[string]string{
+	helperMatch: `__well_match() {
+	[[ $1 =~ $2 ]]
+}
+`,
+	// Same as expander.EscapeQuote with expander.Basic for double containers,
+	// i.e. %q in Go, except that only ASCII control characters are escaped,
+	// other runes that Go does not print, e.g. U+0085 or U+200B, are kept as
+	// they are.
+	helperQuoteDouble: `__well_quote_double() {
+	local s=$1 quoted= c i code
+	for ((i = 0; i < ${#s}; i++)); do
+		c=${s:i:1}
+		case $c in
+		\\) quoted+='\\' ;;
+		\") quoted+='\"' ;;
+		$'\a') quoted+='\a' ;;
+		$'\b') quoted+='\b' ;;
+		$'\f') quoted+='\f' ;;
+		$'\n') quoted+='\n' ;;
+		$'\r') quoted+='\r' ;;
+		$'\t') quoted+='\t' ;;
+		$'\v') quoted+='\v' ;;
+		[[:cntrl:]])
+			# in a UTF-8 locale, the class also has the C1 controls
+			printf -v code '%d' "'$c"
+			if ((code < 0x80)); then
+				printf -v c '\\x%02x' "$code"
+			fi
+			quoted+=$c
+			;;
+		*) quoted+=$c ;;
+		esac
+	done
+	printf '"%s"' "$quoted"
+}
+`,
+	// Same as expander.EscapeQuote with expander.Basic for single containers
+	helperQuoteSingle: `__well_quote_single() {
+	local s=$1
+	s=${s//\\/\\\\}
+	s=${s//\'/\\\'}
+	printf "'%s'" "$s"
+}
+`,
+}
+
+func (g *generator) Generate(src io.Reader, out io.Writer) error {
+	g.parser = parser.NewParser()
+	g.parser.SetDebug(g.debug)
+	var node, parseErr = g.parser.Parse(src)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	g.funcs = make(map[string]*ast.FuncDecl)
+	g.helpers = make(map[string]bool)
+	g.tmpID = 0
+	for _, decl := range node.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok {
+			g.funcs[decl.Name.Name] = decl
+		}
+	}
+
+	var script, err = erroring.CallAndRecover[Error](func() string {
+		var body bytes.Buffer
+		for _, decl := range node.Decls {
+			g.genDecl(&body, decl)
+		}
+		if _, ok := g.funcs["main"]; !ok {
+			panic(g.newError(noPos, "function main is not declared"))
+		}
+		fmt.Fprintf(&body, "%s \"$@\"\n", funcName("main"))
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "#!/usr/bin/env bash\n")
+		fmt.Fprintf(&buf, "# Code generated by well compile. DO NOT EDIT.\n")
+		fmt.Fprintf(&buf, "set -euo pipefail\n")
+		fmt.Fprintf(&buf, "set -f # no globbing, Well never expands globs\n")
+		fmt.Fprintf(&buf, "__well_ret=\n")
+		for _, name := range []string{helperMatch, helperQuoteDouble, helperQuoteSingle} {
+			if g.helpers[name] {
+				fmt.Fprintf(&buf, "\n%s", helperBodies[name])
+			}
+		}
+		fmt.Fprintf(&buf, "\n%s", body.String())
+		return buf.String()
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, script)
+	return err
+}
+
+var noPos scanner.Pos = -1
+
+func (g *generator) indent() string {
+	return strings.Repeat("\t", g.indentLevel)
+}
+
+func (g *generator) writeLines(buf *bytes.Buffer, lines ...string) {
+	for _, line := range lines {
+		fmt.Fprintf(buf, "%s%s\n", g.indent(), line)
+	}
+}
+
+func (g *generator) genDecl(buf *bytes.Buffer, decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		g.currFun = decl
+		defer func() { g.currFun = nil }()
+
+		fmt.Fprintf(buf, "%s() {\n", funcName(decl.Name.Name))
+		g.indentLevel += 1
+		for i, arg := range decl.Signature.Args {
+			g.writeLines(buf, fmt.Sprintf("local %s=\"$%d\"", arg.Name, i+1))
+		}
+		if decl.IsExternal {
+			g.writeLines(buf, g.genTemplateCommand(decl.Template()))
+		} else {
+			for _, stmt := range decl.Body.Statements {
+				g.genStmt(buf, stmt)
+			}
+		}
+		g.indentLevel -= 1
+		fmt.Fprintf(buf, "}\n\n")
+	case *ast.LetDecl:
+		var prelude, word = g.genValue(decl.Rhs)
+		g.writeLines(buf, prelude...)
+		g.writeLines(buf, fmt.Sprintf("%s=%s", decl.Name.Name, word))
+		fmt.Fprintf(buf, "\n")
+	case *ast.RequiresDecl:
+		var quoted = strconv.Quote(decl.Name)
+		switch decl.Kind {
+		case "command":
+			g.writeLines(buf, fmt.Sprintf("command -v %s >/dev/null || { printf '%%s\\n' %s >&2; exit 1; }", quoted, strconv.Quote("missing command "+decl.Name)))
+		case "file":
+			g.writeLines(buf, fmt.Sprintf("[[ -e %s ]] || { printf '%%s\\n' %s >&2; exit 1; }", quoted, strconv.Quote("missing file "+decl.Name)))
+		}
+		fmt.Fprintf(buf, "\n")
+	default:
+		panic(g.newError(decl.Pos(), "cannot translate %T to bash", decl))
+	}
+}
+
+func (g *generator) genStmt(buf *bytes.Buffer, stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.LetDecl:
+		if g.isStreamExpr(stmt.Rhs) {
+			var prelude, cmd = g.genStream(stmt.Rhs)
+			g.writeLines(buf, prelude...)
+			g.writeLines(buf, g.capture(stmt.Name.Name, cmd, true)...)
+			return
+		}
+		var prelude, word = g.genValue(stmt.Rhs)
+		g.writeLines(buf, prelude...)
+		g.writeLines(buf, fmt.Sprintf("%s%s=%s", g.local(), stmt.Name.Name, word))
+	case *ast.ExprStmt:
+		g.genExprStmt(buf, stmt.X)
+	case *ast.ReturnStmt:
+		if g.currFun == nil {
+			panic(g.newError(stmt.Pos(), "return outside of a function"))
+		}
+		if stmt.Expr == nil {
+			g.writeLines(buf, "return")
+			return
+		}
+		if g.isStreamExpr(stmt.Expr) {
+			var prelude, cmd = g.genStream(stmt.Expr)
+			g.writeLines(buf, prelude...)
+			g.writeLines(buf, g.capture("__well_ret", cmd, false)...)
+		} else {
+			var prelude, word = g.genValue(stmt.Expr)
+			g.writeLines(buf, prelude...)
+			g.writeLines(buf, fmt.Sprintf("__well_ret=%s", word))
+		}
+		g.writeLines(buf, "return")
+	case *ast.IfStmt:
+		g.genIfStmt(buf, stmt)
+		g.writeLines(buf, "fi")
+	case *ast.BlockStmt:
+		for _, stmt := range stmt.Statements {
+			g.genStmt(buf, stmt)
+		}
+	default:
+		panic(g.newError(stmt.Pos(), "cannot translate %T to bash", stmt))
+	}
+}
+
+// genIfStmt writes everything of an if statement except the final "fi".
+func (g *generator) genIfStmt(buf *bytes.Buffer, stmt *ast.IfStmt) {
+	var prelude, cond = g.genCond(stmt.Cond)
+	g.writeLines(buf, prelude...)
+	g.writeLines(buf, fmt.Sprintf("if %s; then", cond))
+	g.genBlock(buf, stmt.Body)
+
+	switch els := stmt.Else.(type) {
+	case nil:
+	case *ast.BlockStmt:
+		g.writeLines(buf, "else")
+		g.genBlock(buf, els)
+	case *ast.IfStmt:
+		g.writeLines(buf, "else")
+		g.indentLevel += 1
+		g.genIfStmt(buf, els)
+		g.writeLines(buf, "fi")
+		g.indentLevel -= 1
+	default:
+		panic(g.newError(els.Pos(), "cannot translate else branch %T to bash", els))
+	}
+}
+
+func (g *generator) genBlock(buf *bytes.Buffer, block *ast.BlockStmt) {
+	g.indentLevel += 1
+	if len(block.Statements) == 0 {
+		g.writeLines(buf, ":")
+	}
+	for _, stmt := range block.Statements {
+		g.genStmt(buf, stmt)
+	}
+	g.indentLevel -= 1
+}
+
+func (g *generator) genExprStmt(buf *bytes.Buffer, expr ast.Expr) {
+	var call, ok = expr.(*ast.CallExpr)
+	if !ok {
+		panic(g.newError(expr.Pos(), "cannot translate expression statement %T to bash", expr))
+	}
+
+	var name = g.callName(call)
+	switch name {
+	case "print", "println":
+		var prelude, words = g.genValues(call.Arg.Exprs)
+		g.writeLines(buf, prelude...)
+		var format = "%s"
+		if name == "println" {
+			format = "%s\\n"
+		}
+		g.writeLines(buf, fmt.Sprintf("printf '%s' %s", format, joinWords(words, `" "`)))
+		return
+	case "print_stream":
+		if len(call.Arg.Exprs) != 1 {
+			panic(g.newError(call.Pos(), "print_stream expects 1 arg, got %d", len(call.Arg.Exprs)))
+		}
+		var prelude, cmd = g.genStream(call.Arg.Exprs[0])
+		g.writeLines(buf, prelude...)
+		g.writeLines(buf, cmd)
+		return
+	case "exit":
+		if len(call.Arg.Exprs) != 2 {
+			panic(g.newError(call.Pos(), "exit expects 2 args, got %d", len(call.Arg.Exprs)))
+		}
+		var prelude, words = g.genValues(call.Arg.Exprs)
+		g.writeLines(buf, prelude...)
+		g.writeLines(buf, fmt.Sprintf("printf '%%s\\n' %s >&2", words[1]))
+		g.writeLines(buf, fmt.Sprintf("exit %s", words[0]))
+		return
+	}
+
+	if g.isStreamExpr(call) {
+		// The interpreter starts the command, but nobody reads its output.
+		var prelude, cmd = g.genStream(call)
+		g.writeLines(buf, prelude...)
+		g.writeLines(buf, cmd+" >/dev/null")
+		return
+	}
+
+	var prelude, cmd = g.genCall(call)
+	g.writeLines(buf, prelude...)
+	g.writeLines(buf, cmd)
+}
+
+// funcName returns the name of the bash function of a Well function. The
+// prefix keeps the functions from shadowing the commands that the generated
+// code runs, e.g. a Well function named printf or cat.
+func funcName(name string) string {
+	return "well_" + name
+}
+
+func (g *generator) callName(call *ast.CallExpr) string {
+	if ident, ok := call.Fun.(*ast.Ident); ok {
+		return ident.Name
+	}
+	panic(g.newError(call.Pos(), "cannot translate call of %T to bash", call.Fun))
+}
+
+// isStreamExpr reports whether expr produces a stream, i.e. it is a call to
+// an external function, directly or at the end of a pipe.
+func (g *generator) isStreamExpr(expr ast.Expr) bool {
+	var call, ok = expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	var ident, isIdent = call.Fun.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	var decl, isFunc = g.funcs[ident.Name]
+	return isFunc && decl.IsExternal
+}
+
+func (g *generator) isPipedArg(name string) bool {
+	if g.currFun == nil {
+		return false
+	}
+	for _, arg := range g.currFun.Signature.PipedArgs {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// genCall returns the command calling a Well function, with its piped
+// argument, if any, connected to its stdin.
+func (g *generator) genCall(call *ast.CallExpr) ([]string, string) {
+	var name = g.callName(call)
+	var decl, ok = g.funcs[name]
+	if !ok {
+		panic(g.newError(call.Pos(), "cannot translate call to %q to bash", name))
+	}
+	if len(call.Arg.Exprs) != len(decl.Signature.Args) {
+		panic(g.newError(call.Pos(), "%s takes %d args, call is sending %d arg", name, len(decl.Signature.Args), len(call.Arg.Exprs)))
+	}
+
+	var prelude, words = g.genValues(call.Arg.Exprs)
+	var cmd = strings.Join(append([]string{funcName(name)}, words...), " ")
+	if len(call.PipedArg.Exprs) > 0 {
+		var pipedPrelude, pipedCmd = g.genStream(call.PipedArg.Exprs[0])
+		prelude = append(prelude, pipedPrelude...)
+		if decl.IsExternal {
+			cmd = pipedCmd + " | " + cmd
+		} else {
+			// Process substitution keeps the function in the current shell,
+			// so that __well_ret is not lost in a subshell.
+			cmd = cmd + " < <(" + pipedCmd + ")"
+		}
+	}
+	return prelude, cmd
+}
+
+// genStream returns a command that writes the stream of expr to stdout.
+func (g *generator) genStream(expr ast.Expr) ([]string, string) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if g.isPipedArg(expr.Name) {
+			return nil, "cat"
+		}
+		return nil, fmt.Sprintf(`printf '%%s' "$%s"`, expr.Name)
+	case *ast.CallExpr:
+		if g.isStreamExpr(expr) {
+			return g.genCall(expr)
+		}
+		var prelude, word = g.genValue(expr)
+		return prelude, fmt.Sprintf(`printf '%%s' %s`, word)
+	default:
+		panic(g.newError(expr.Pos(), "cannot translate stream %T to bash", expr))
+	}
+}
+
+func (g *generator) genValues(exprs []ast.Expr) ([]string, []string) {
+	var prelude, words []string
+	for _, expr := range exprs {
+		var p, w = g.genValue(expr)
+		prelude = append(prelude, p...)
+		words = append(words, w)
+	}
+	return prelude, words
+}
+
+// genValue returns a bash word that evaluates to the value of expr, and the
+// statements that must run before the word is used.
+func (g *generator) genValue(expr ast.Expr) ([]string, string) {
+	switch expr := expr.(type) {
+	case *ast.String:
+		return nil, `"` + g.genFragments(expr.Pos(), expr.Root.Items) + `"`
+	case *ast.Integer:
+		return nil, strconv.Itoa(expr.Value)
+	case *ast.Float:
+		// the same as Float.String in the interpreter
+		return nil, strconv.FormatFloat(expr.Value, 'f', -1, 64)
+	case *ast.Ident:
+		switch expr.Name {
+		case "true", "false":
+			return nil, expr.Name
+		}
+		if g.isPipedArg(expr.Name) {
+			panic(g.newError(expr.Pos(), "cannot use stream %q as a value", expr.Name))
+		}
+		if _, ok := g.funcs[expr.Name]; ok {
+			panic(g.newError(expr.Pos(), "cannot use function %q as a value", expr.Name))
+		}
+		return nil, fmt.Sprintf(`"$%s"`, expr.Name)
+	case *ast.BinaryExpr:
+		var tmp = g.newTmp()
+		var prelude, cond = g.genCond(expr)
+		prelude = append(prelude, fmt.Sprintf("if %s; then %s%s=true; else %s%s=false; fi", cond, g.local(), tmp, g.local(), tmp))
+		return prelude, fmt.Sprintf(`"$%s"`, tmp)
+	case *ast.CallExpr:
+		var tmp = g.newTmp()
+		if g.isStreamExpr(expr) {
+			var prelude, cmd = g.genStream(expr)
+			return append(prelude, g.capture(tmp, cmd, true)...), fmt.Sprintf(`"$%s"`, tmp)
+		}
+		switch g.callName(expr) {
+		case "date":
+			return []string{fmt.Sprintf("%s%s=\"$(date)\"", g.local(), tmp)}, fmt.Sprintf(`"$%s"`, tmp)
+		case "read":
+			return []string{fmt.Sprintf("%sIFS= read -r %s || true", g.localDecl(tmp), tmp)}, fmt.Sprintf(`"$%s"`, tmp)
+		case "list", "record":
+			panic(g.newError(expr.Pos(), "cannot translate %s to bash", g.callName(expr)))
+		case "read_secret":
+			return []string{fmt.Sprintf("%sIFS= read -rs %s || true", g.localDecl(tmp), tmp)}, fmt.Sprintf(`"$%s"`, tmp)
+		case "secret_env":
+			if len(expr.Arg.Exprs) != 1 {
+				panic(g.newError(expr.Pos(), "secret_env expects 1 arg, got %d", len(expr.Arg.Exprs)))
+			}
+			var prelude, words = g.genValues(expr.Arg.Exprs)
+			prelude = append(prelude, fmt.Sprintf(
+				`%s%s="$(printenv %s)" || { printf 'environment variable %%s is not set\n' %s >&2; exit 1; }`,
+				g.localDecl(tmp), tmp, words[0], words[0],
+			))
+			return prelude, fmt.Sprintf(`"$%s"`, tmp)
+		}
+		var prelude, cmd = g.genCall(expr)
+		prelude = append(prelude, cmd, fmt.Sprintf(`%s%s="$__well_ret"`, g.local(), tmp))
+		return prelude, fmt.Sprintf(`"$%s"`, tmp)
+	default:
+		panic(g.newError(expr.Pos(), "cannot translate %T to bash", expr))
+	}
+}
+
+// genCond returns a bash command that succeeds if expr is true.
+func (g *generator) genCond(expr ast.Expr) ([]string, string) {
+	switch expr := expr.(type) {
+	case *ast.BinaryExpr:
+		var prelude, words = g.genValues([]ast.Expr{expr.X, expr.Y})
+		switch expr.Op {
+		case token.REG:
+			g.helpers[helperMatch] = true
+			return prelude, fmt.Sprintf("%s %s %s", helperMatch, words[0], words[1])
+		case token.NREG:
+			g.helpers[helperMatch] = true
+			return prelude, fmt.Sprintf("! %s %s %s", helperMatch, words[0], words[1])
+		case token.EQL:
+			return prelude, fmt.Sprintf("[[ %s == %s ]]", words[0], words[1])
+		default:
+			panic(g.newError(expr.Pos(), "cannot translate binary operator %s to bash", expr.Op))
+		}
+	default:
+		var prelude, word = g.genValue(expr)
+		return prelude, fmt.Sprintf("[[ %s == true ]]", word)
+	}
+}
+
+// capture returns the statements that store the output of cmd in the
+// variable name. Trailing newlines are kept, unlike plain $(...).
+func (g *generator) capture(name, cmd string, declare bool) []string {
+	var decl = ""
+	if declare {
+		decl = g.localDecl(name)
+	}
+	return []string{
+		fmt.Sprintf(`%s%s="$(%s; printf .)"`, decl, name, cmd),
+		fmt.Sprintf(`%s="${%s%%.}"`, name, name),
+	}
+}
+
+func (g *generator) local() string {
+	if g.currFun == nil {
+		return ""
+	}
+	return "local "
+}
+
+func (g *generator) localDecl(name string) string {
+	if g.currFun == nil {
+		return ""
+	}
+	return "local " + name + "; "
+}
+
+func (g *generator) newTmp() string {
+	g.tmpID += 1
+	return fmt.Sprintf("__well_%d", g.tmpID)
+}
+
+func joinWords(words []string, sep string) string {
+	if len(words) == 0 {
+		return `""`
+	}
+	return strings.Join(words, sep)
+}
+
+// genTemplateCommand returns the command line that runs the command template
+// of an external function with the same argv expander.EncodeToCmdArgs
+// produces.
+func (g *generator) genTemplateCommand(template ast.Expr) string {
+	var str, ok = template.(*ast.String)
+	if !ok {
+		panic(g.newError(template.Pos(), "cannot translate external command %T to bash", template))
+	}
+
+	var words []string
+	var curr strings.Builder
+	var commit = func() {
+		if curr.Len() > 0 {
+			words = append(words, curr.String())
+			curr.Reset()
+		}
+	}
+	for _, item := range str.Root.Items {
+		switch item := item.(type) {
+		case strs_parser.Whs:
+			commit()
+		case strs_parser.Wrd:
+			curr.WriteString(`"` + dqEscape(item.Lit) + `"`)
+		case strs_parser.ContainerNode:
+			curr.WriteString(`"` + g.genFragments(template.Pos(), item.Items) + `"`)
+		case strs_parser.Var:
+			if item.Sep != nil {
+				panic(g.newError(template.Pos(), "cannot translate list variable %q to bash", item.Name))
+			}
+			switch item.Opts {
+			case "", "%s", "%-":
+				// unquoted, so that it is split on whitespace like the expander does
+				curr.WriteString(paramExp(item, false))
+			case "%q", "%Q":
+				curr.WriteString(fmt.Sprintf(`"%s"`, paramExp(item, true)))
+			case "%f":
+				curr.WriteString(fmt.Sprintf(`"$(printf '%%f' "%s")"`, paramExp(item, true)))
+			default:
+				panic(g.newError(template.Pos(), "cannot translate variable flags %q to bash", item.Opts))
+			}
+		default:
+			panic(g.newError(template.Pos(), "cannot translate %T to bash", item))
+		}
+	}
+	commit()
+
+	if len(words) == 0 {
+		panic(g.newError(template.Pos(), "external command is empty"))
+	}
+	// command bypasses the bash functions, e.g. ones exported in the environment
+	return "command " + strings.Join(words, " ")
+}
+
+// genFragments returns the bash text, to be placed inside double quotes,
+// that evaluates to the items as they are rendered inside a container.
+func (g *generator) genFragments(pos scanner.Pos, items []strs_parser.CmdNode) string {
+	var buf strings.Builder
+	for _, item := range items {
+		switch item := item.(type) {
+		case strs_parser.Wrd:
+			buf.WriteString(dqEscape(item.Lit))
+		case strs_parser.Whs:
+			buf.WriteString(dqEscape(item.Lit))
+		case strs_parser.Var:
+			if item.Sep != nil {
+				panic(g.newError(pos, "cannot translate list variable %q to bash", item.Name))
+			}
+			switch item.Opts {
+			case "", "%s", "%-":
+				buf.WriteString(paramExp(item, true))
+			case "%q":
+				g.helpers[helperQuoteDouble] = true
+				buf.WriteString(fmt.Sprintf(`$(%s "%s")`, helperQuoteDouble, paramExp(item, true)))
+			case "%Q":
+				g.helpers[helperQuoteSingle] = true
+				buf.WriteString(fmt.Sprintf(`$(%s "%s")`, helperQuoteSingle, paramExp(item, true)))
+			case "%f":
+				buf.WriteString(fmt.Sprintf(`$(printf '%%f' "%s")`, paramExp(item, true)))
+			default:
+				panic(g.newError(pos, "cannot translate variable flags %q to bash", item.Opts))
+			}
+		case strs_parser.Expr:
+			panic(g.newError(pos, "cannot translate expression ${%s} to bash", item.Src))
+		case strs_parser.ContainerNode:
+			if !hasVars(item) {
+				// Static containers are quoted at compile time
+				var inner, err = expander.EncodeToString(&strs_parser.Root{Items: item.Items}, nil, expander.Basic)
+				if err != nil {
+					panic(g.newError(pos, "%s", err))
+				}
+				quoted, err := expander.EscapeQuote(inner, item.Type, expander.Basic)
+				if err != nil {
+					panic(g.newError(pos, "%s", err))
+				}
+				buf.WriteString(dqEscape(quoted))
+				continue
+			}
+			switch item.Type {
+			case strs_scanner.LDOUBLE_GUILLEMET, strs_scanner.DOUBLE_QUOTE:
+				g.helpers[helperQuoteDouble] = true
+				buf.WriteString(fmt.Sprintf(`$(%s "%s")`, helperQuoteDouble, g.genFragments(pos, item.Items)))
+			case strs_scanner.LSINGLE_GUILLEMET, strs_scanner.SINGLE_QUOTE:
+				g.helpers[helperQuoteSingle] = true
+				buf.WriteString(fmt.Sprintf(`$(%s "%s")`, helperQuoteSingle, g.genFragments(pos, item.Items)))
+			default:
+				panic(g.newError(pos, "unsupported container %s", item.Type))
+			}
+		default:
+			panic(g.newError(pos, "cannot translate %T to bash", item))
+		}
+	}
+	return buf.String()
+}
+
+// paramExp returns the bash parameter expansion of a variable, with its
+// modifier translated to -, ? or +, which like the expander only check
+// whether the variable is set. quoted is true if the expansion is placed
+// inside double quotes.
+func paramExp(item strs_parser.Var, quoted bool) string {
+	var op string
+	switch item.Modifier {
+	case strs_parser.Default:
+		op = "-"
+	case strs_parser.Required:
+		op = "?"
+	case strs_parser.Alternate:
+		op = "+"
+	default:
+		return fmt.Sprintf("${%s}", item.Name)
+	}
+
+	var word string
+	switch {
+	case quoted:
+		word = strings.ReplaceAll(dqEscape(item.Value), "}", `\}`)
+	case strings.IndexFunc(item.Value, unicode.IsSpace) != -1:
+		// the result of a command substitution is split like the value of
+		// an unquoted variable, and the expander splits the value too
+		word = fmt.Sprintf(`$(builtin printf %%s "%s")`, dqEscape(item.Value))
+	default:
+		word = `"` + dqEscape(item.Value) + `"`
+	}
+	return fmt.Sprintf("${%s%s%s}", item.Name, op, word)
+}
+
+func hasVars(node strs_parser.CmdNode) bool {
+	switch node := node.(type) {
+	case strs_parser.Var, strs_parser.Expr:
+		return true
+	case strs_parser.ContainerNode:
+		for _, item := range node.Items {
+			if hasVars(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dqEscape escapes s to be placed inside bash double quotes.
+func dqEscape(s string) string {
+	var buf strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '\\', '"', '$', '`':
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(ch)
+	}
+	return buf.String()
+}
+
+type Error struct {
+	err error
+}
+
+func (i Error) Error() string {
+	return i.err.Error()
+}
+
+func (g *generator) newError(pos scanner.Pos, f string, args ...any) error {
+	if pos == noPos {
+		return Error{fmt.Errorf(f, args...)}
+	}
+	var lines = g.parser.MarkAt(pos, fmt.Sprintf(f, args...), false)
+	return Error{fmt.Errorf("%s", strings.Join(lines, "\n"))}
+}
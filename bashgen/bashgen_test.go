@@ -0,0 +1,186 @@
+package bashgen_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/bashgen"
+	"github.com/siadat/well/interpreter"
+	"github.com/siadat/well/syntax/scanner"
+)
+
+var testCases = []struct {
+	src        string
+	wantStdout string
+	wantErr    string
+}{
+	{
+		src: `
+		external echo(s string) => "echo ${s:%q}"
+		external (stdin reader) | nl() => "nl"
+		external (stdin reader) | head(n int) => "head -n ${n}"
+		external sh(script string) => "sh -c «echo «${script}» ‹its ${script:%q}›»"
+
+		function greet(s1 string, s2 string) {
+			println(s1, "and", s2)
+			println(f2(0, 0))
+			if "hello" ~~ "ll" {
+				return true
+			}
+			println("unreachable")
+		}
+		function f2(s1 string, s2 string) (string) {
+			return "s1=${s1} and s2=${s2}"
+		}
+
+		function (stdin reader) | main() {
+			let s1 = "hi"
+			let bye = "bye"
+			let out = echo("hello1\nhello2") | nl() | head(1)
+			print_stream(out)
+			let res = greet(s1, bye)
+			println(res)
+			print_stream(sh(` + "`" + `a "b" $c \d` + "`" + `))
+			if "x" !~ "y" {
+				println("not matched")
+			} else if "a" == "a" {
+				println("eq")
+			} else {
+				println("else")
+			}
+		}
+		`,
+		wantStdout: "     1\thello1\nhi and bye\ns1=0 and s2=0\ntrue\na \"b\"  \\d its \"a \\\"b\\\" $c \\\\d\"\nnot matched\n",
+	},
+	{
+		src: `
+		external echo(s string) => "echo ${s:%q}"
+
+		function (stdin reader) | main() {
+			let token = secret_env("WELL_TEST_SECRET")
+			print_stream(echo("token=${token}"))
+		}
+		`,
+		wantStdout: "token=hunter2\n",
+	},
+	{
+		src: `
+		external show(format string, x string) => "printf ${format:%q} ${unset|\"a b\"} ${unset:%q|\"}c d\"} ${x+\"-x\"}${unset+\"-u\"}"
+
+		function (stdin reader) | main() {
+			let x = ""
+			print_stream(show("[%s]", x))
+			println("${unset|\"\\\"e\\\" }\"}${x?\"required\"}")
+		}
+		`,
+		wantStdout: "[a][b][}c d][-x]\"e\" }\n",
+	},
+	{
+		src: `
+		function (stdin reader) | main() {
+			let s = "a\x01\a\x7fb\t\x1bé"
+			let x = 1.5
+			println("«${s}» ‹${s}›")
+			println("x=${x}", 2.25)
+		}
+		`,
+		wantStdout: "\"a\\x01\\a\\x7fb\\t\\x1bé\" 'a\x01\a\x7fb\t\x1bé'\nx=1.5 2.25\n",
+	},
+	{
+		src: `
+		external echo(s string) => "echo ${s}"
+		external (stdin reader) | cat() => "cat"
+
+		function printf(s string) {
+			println("[${s}]")
+		}
+
+		function (stdin reader) | main() {
+			printf("a")
+			echo("discarded")
+			print_stream(echo("b") | cat())
+		}
+		`,
+		wantStdout: "[a]\nb\n",
+	},
+	{
+		src: `
+		function main() {
+			let files = list("a", "b")
+		}
+		`,
+		wantErr: "cannot translate list to bash",
+	},
+	{
+		src: `
+		function main() {
+			let x = 1 + 2
+		}
+		`,
+		wantErr: "cannot translate binary operator ADD to bash",
+	},
+	{
+		src: `
+		function main() {
+			let n = 1
+			println("n=${n + 1}")
+		}
+		`,
+		wantErr: "cannot translate expression ${n + 1} to bash",
+	},
+}
+
+func TestGenerate(tt *testing.T) {
+	var bashPath, lookErr = exec.LookPath("bash")
+	tt.Setenv("WELL_TEST_SECRET", "hunter2")
+
+	for ti, tc := range testCases {
+		var src = scanner.FormatSrc(tc.src, true)
+
+		var generator = bashgen.NewGenerator()
+		var script bytes.Buffer
+		var err = generator.Generate(strings.NewReader(tc.src), &script)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.wantErr, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("generate failed (test case %d)\nsrc:\n%s\nerr:\n%s", ti, src, err)
+		}
+
+		// The script and the interpreter must behave the same
+		var interpStdout bytes.Buffer
+		var interp = interpreter.NewInterpreter(&interpStdout, os.Stderr)
+		var env = interpreter.NewEnvironment()
+		if err := env.Set("MainStdin", &interpreter.PipeStream{ReadCloser: os.Stdin}); err != nil {
+			tt.Fatal(err)
+		}
+		if _, err := interp.Eval(strings.NewReader(tc.src), env); err != nil {
+			tt.Fatalf("eval failed (test case %d)\nsrc:\n%s\nerr:\n%s", ti, src, err)
+		}
+		if diff := cmp.Diff(tc.wantStdout, interpStdout.String()); diff != "" {
+			tt.Fatalf("mismatching interpreter stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+
+		if lookErr != nil {
+			tt.Logf("skipped running the generated script: %v", lookErr)
+			continue
+		}
+		var cmd = exec.Command(bashPath, "-c", script.String())
+		var bashStdout bytes.Buffer
+		cmd.Stdout = &bashStdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			tt.Fatalf("running the generated script failed (test case %d): %v\nscript:\n%s", ti, err, scanner.FormatSrc(script.String(), false))
+		}
+		if diff := cmp.Diff(tc.wantStdout, bashStdout.String()); diff != "" {
+			tt.Fatalf("mismatching bash stdout (test case %d)\nscript:\n%s\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, scanner.FormatSrc(script.String(), false), diff)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Package cmd builds commands from guillemet templates, without a shell.
+//
+//	var c, err = cmd.Template("git log --format=%h ‹${range}›").
+//		With(cmd.Vars{"range": "main..HEAD"}).
+//		Command(ctx)
+//
+// A template is expanded to the arguments of a command, the values of its
+// variables are never parsed, so they cannot add arguments, quotes or
+// commands. Outside a container a value is split at whitespaces, e.g.
+// ${flags} with "-l -a" is two arguments, and a []string value is one
+// argument per item. Put the variable in ‹›, «» or quotes to keep the value
+// one argument.
+//
+// The |, &&, || and ; operators at the top level of a template are run like
+// in a shell by Run. Pipe builds a pipeline of separate templates.
+//
+// All functions return errors, they never panic or exit.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/siadat/well/piper"
+	"github.com/siadat/well/syntax/strs/expander"
+	"github.com/siadat/well/syntax/strs/parser"
+)
+
+// Vars are the values of the variables of a template. A value is a string,
+// a []string, whose items are separate arguments, or any other value, which
+// is formatted with fmt.Sprint.
+type Vars map[string]interface{}
+
+// Tmpl is a parsed template and the values of its variables.
+type Tmpl struct {
+	src   string
+	root  *parser.Root
+	err   error // the syntax error of src, returned by all methods
+	vars  Vars
+	trace func(pipeline string)
+}
+
+// Template parses src. A syntax error is returned by the methods of the
+// template, so that it can be built in one expression.
+func Template(src string) *Tmpl {
+	var root, err = parser.NewParser().Parse(strings.NewReader(src))
+	var t = &Tmpl{src: src, root: root}
+	if err != nil {
+		t.err = &Error{Template: src, Err: err}
+	}
+	return t
+}
+
+// With returns a copy of t with vars added to its variables. A variable that
+// is already set is replaced.
+func (t *Tmpl) With(vars Vars) *Tmpl {
+	var merged = make(Vars, len(t.vars)+len(vars))
+	for name, value := range t.vars {
+		merged[name] = value
+	}
+	for name, value := range vars {
+		merged[name] = value
+	}
+	var copied = *t
+	copied.vars = merged
+	return &copied
+}
+
+// Trace returns a copy of t whose Run calls f with each pipeline, rendered
+// with expander.Basic, before it runs it.
+func (t *Tmpl) Trace(f func(pipeline string)) *Tmpl {
+	var copied = *t
+	copied.trace = f
+	return &copied
+}
+
+// String returns the source of the template.
+func (t *Tmpl) String() string {
+	return t.src
+}
+
+// Render returns the template with its containers quoted for target, e.g.
+// expander.POSIX for a POSIX shell.
+func (t *Tmpl) Render(target expander.Target) (string, error) {
+	if t.err != nil {
+		return "", t.err
+	}
+	var s, err = expander.EncodeToString(t.root, t.vars.lookup, target)
+	if err != nil {
+		return "", &Error{Template: t.src, Err: err}
+	}
+	return s, nil
+}
+
+// Args returns the arguments of the command, starting with its name. It
+// fails if the template has operators, which are run by Run.
+func (t *Tmpl) Args() ([]string, error) {
+	var seq, err = t.sequence()
+	if err != nil {
+		return nil, err
+	}
+	if len(seq.Pipelines) != 1 || len(seq.Pipelines[0].Commands) != 1 {
+		return nil, &Error{Template: t.src, Err: errors.New("more than one command, run it with Run")}
+	}
+	return t.args(seq.Pipelines[0].Commands[0])
+}
+
+// Command returns the command of the template. Like exec.CommandContext, it
+// is killed if ctx is done before it exits.
+func (t *Tmpl) Command(ctx context.Context) (*exec.Cmd, error) {
+	var args, err = t.Args()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, args[0], args[1:]...), nil
+}
+
+// Run runs the pipelines of the template. Like in a shell, a pipeline after
+// && runs if the previous one succeeded, a pipeline after || runs if it
+// failed, and a pipeline after ; runs in any case. All arguments are
+// expanded before the first command runs. It returns the error of the last
+// pipeline that ran, or the error of ctx if it is done before a pipeline
+// starts.
+func (t *Tmpl) Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	var seq, err = t.sequence()
+	if err != nil {
+		return err
+	}
+	var pipelines = make([][][]string, len(seq.Pipelines))
+	var rendered = make([]string, len(seq.Pipelines))
+	for i, pipeline := range seq.Pipelines {
+		var cmds []string
+		for _, root := range pipeline.Commands {
+			var args, err = t.args(root)
+			if err != nil {
+				return err
+			}
+			pipelines[i] = append(pipelines[i], args)
+
+			if t.trace != nil {
+				var s, err = expander.EncodeToString(root, t.vars.lookup, expander.Basic)
+				if err != nil {
+					return &Error{Template: t.src, Err: err}
+				}
+				cmds = append(cmds, strings.TrimSpace(s))
+			}
+		}
+		rendered[i] = strings.Join(cmds, " | ")
+	}
+
+	var status error
+	for i, argvs := range pipelines {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i > 0 {
+			switch seq.Ops[i-1] {
+			case "&&":
+				if status != nil {
+					continue
+				}
+			case "||":
+				if status == nil {
+					continue
+				}
+			}
+		}
+		if t.trace != nil {
+			t.trace(rendered[i])
+		}
+		status = piper.RunContext(ctx, argvs, stdin, stdout, stderr)
+	}
+	return status
+}
+
+// Output runs the template with no stdin, and returns its stdout. If it
+// fails, the error includes its stderr.
+func (t *Tmpl) Output(ctx context.Context) ([]byte, error) {
+	return output(func(stdout, stderr io.Writer) error {
+		return t.Run(ctx, nil, stdout, stderr)
+	})
+}
+
+// sequence returns the pipelines of the template.
+func (t *Tmpl) sequence() (parser.Sequence, error) {
+	if t.err != nil {
+		return parser.Sequence{}, t.err
+	}
+	var seq, err = parser.SplitOperators(t.root)
+	if err != nil {
+		return parser.Sequence{}, &Error{Template: t.src, Err: err}
+	}
+	if len(seq.Pipelines) == 0 {
+		return parser.Sequence{}, &Error{Template: t.src, Err: errors.New("no command")}
+	}
+	return seq, nil
+}
+
+// args returns the arguments of a command of the template.
+func (t *Tmpl) args(root *parser.Root) ([]string, error) {
+	var args, err = expander.EncodeToCmdArgs(root, t.vars.lookup)
+	if err != nil {
+		return nil, &Error{Template: t.src, Err: err}
+	}
+	if len(args) == 0 {
+		return nil, &Error{Template: t.src, Err: fmt.Errorf("%q expands to no arguments", strings.TrimSpace(root.String()))}
+	}
+	return args, nil
+}
+
+// Pipeline is a list of commands, the stdout of each command is the stdin of
+// the next one.
+type Pipeline struct {
+	cmds []*Tmpl
+}
+
+// Pipe returns the pipeline of cmds, e.g.
+//
+//	cmd.Pipe(cmd.Template("git log --oneline"), cmd.Template("head -n 3"))
+func Pipe(cmds ...*Tmpl) *Pipeline {
+	return &Pipeline{cmds: cmds}
+}
+
+// Pipe returns a copy of p followed by cmd.
+func (p *Pipeline) Pipe(cmd *Tmpl) *Pipeline {
+	var cmds = make([]*Tmpl, len(p.cmds), len(p.cmds)+1)
+	copy(cmds, p.cmds)
+	return &Pipeline{cmds: append(cmds, cmd)}
+}
+
+// Args returns the arguments of each command.
+func (p *Pipeline) Args() ([][]string, error) {
+	if len(p.cmds) == 0 {
+		return nil, errors.New("empty pipeline")
+	}
+	var argvs = make([][]string, len(p.cmds))
+	for i, cmd := range p.cmds {
+		var args, err = cmd.Args()
+		if err != nil {
+			return nil, err
+		}
+		argvs[i] = args
+	}
+	return argvs, nil
+}
+
+// Run runs the pipeline, stdin is the stdin of the first command and stdout
+// is the stdout of the last one. All commands write their errors to stderr,
+// which need not be safe for concurrent use. Like bash with set -o pipefail,
+// it fails if any of the commands fails, except for a broken pipe, e.g. yes
+// in yes | head.
+func (p *Pipeline) Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	var argvs, err = p.Args()
+	if err != nil {
+		return err
+	}
+	return piper.RunContext(ctx, argvs, stdin, stdout, stderr)
+}
+
+// Output runs the pipeline with no stdin, and returns the stdout of its last
+// command. If it fails, the error includes the stderr of the commands.
+func (p *Pipeline) Output(ctx context.Context) ([]byte, error) {
+	return output(func(stdout, stderr io.Writer) error {
+		return p.Run(ctx, nil, stdout, stderr)
+	})
+}
+
+// output returns the stdout of run.
+func output(run func(stdout, stderr io.Writer) error) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	if err := run(&stdout, &stderr); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.Bytes(), err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Error is an error of a template, e.g. a syntax error or a variable that is
+// not set, which is an *expander.UndefinedError.
+type Error struct {
+	Template string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	var undefined *expander.UndefinedError
+	if errors.As(e.Err, &undefined) && !undefined.Required {
+		return fmt.Sprintf("template %q: variable %s is not set", e.Template, undefined.Name)
+	}
+	return fmt.Sprintf("template %q: %v", e.Template, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// lookup returns the value of a variable, or nil if it is not set.
+func (vars Vars) lookup(name string) interface{} {
+	var value, ok = vars[name]
+	if !ok || value == nil {
+		return nil
+	}
+	switch value := value.(type) {
+	case string, []string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
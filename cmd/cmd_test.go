@@ -0,0 +1,229 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/cmd"
+	"github.com/siadat/well/syntax/strs/expander"
+)
+
+func TestArgs(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		vars cmd.Vars
+		want []string
+		err  string
+	}{
+		{
+			src:  `git log ‹${range}› ${flags}`,
+			vars: cmd.Vars{"range": "a..b; rm -rf /", "flags": "--oneline -n 3"},
+			want: []string{"git", "log", "a..b; rm -rf /", "--oneline", "-n", "3"},
+		},
+		{
+			src:  `rm -- ${files}`,
+			vars: cmd.Vars{"files": []string{"a b", "$(c)"}},
+			want: []string{"rm", "--", "a b", "$(c)"},
+		},
+		{
+			src:  `head -n ${count}`,
+			vars: cmd.Vars{"count": 3},
+			want: []string{"head", "-n", "3"},
+		},
+		{
+			src: `echo ${name}`,
+			err: `template "echo ${name}": variable name is not set`,
+		},
+		{
+			src: `ls | wc -l`,
+			err: `template "ls | wc -l": more than one command, run it with Run`,
+		},
+		{
+			src: "  ",
+			err: `template "  ": no command`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		var got, err = cmd.Template(tc.src).With(tc.vars).Args()
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("args failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching args (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func TestWith(tt *testing.T) {
+	var base = cmd.Template(`echo ${a} ${b}`).With(cmd.Vars{"a": "1", "b": "2"})
+	var changed = base.With(cmd.Vars{"b": "3"})
+
+	var got, err = changed.Args()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"echo", "1", "3"}, got); diff != "" {
+		tt.Fatalf("mismatching args\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	got, err = base.Args()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"echo", "1", "2"}, got); diff != "" {
+		tt.Fatalf("With changed the original template\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestRender(tt *testing.T) {
+	var got, err = cmd.Template(`echo ‹${msg}›`).With(cmd.Vars{"msg": "it's"}).Render(expander.POSIX)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff(`echo 'it'\''s'`, got); diff != "" {
+		tt.Fatalf("mismatching render\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestError(tt *testing.T) {
+	var _, syntaxErr = cmd.Template(`echo ‹a`).With(cmd.Vars{"a": "1"}).Output(context.Background())
+	if syntaxErr == nil || !strings.HasPrefix(syntaxErr.Error(), `template "echo ‹a": `) || !strings.Contains(syntaxErr.Error(), "unclosed ‹") {
+		tt.Fatalf("expected a syntax error, got: %v", syntaxErr)
+	}
+
+	var _, err = cmd.Template(`echo ${name?"name is required"}`).Args()
+	var cmdErr *cmd.Error
+	if !errors.As(err, &cmdErr) {
+		tt.Fatalf("expected *cmd.Error, got %T: %v", err, err)
+	}
+	var undefined *expander.UndefinedError
+	if !errors.As(err, &undefined) || undefined.Name != "name" || !undefined.Required {
+		tt.Fatalf("expected a required *expander.UndefinedError for name, got: %v", err)
+	}
+}
+
+func TestRun(tt *testing.T) {
+	var testCases = []struct {
+		run  func(stdout, stderr *bytes.Buffer) error
+		want string
+		err  string
+	}{
+		{
+			run: func(stdout, stderr *bytes.Buffer) error {
+				var echo, err = cmd.Template(`echo ‹${msg}›`).With(cmd.Vars{"msg": "a  b"}).Command(context.Background())
+				if err != nil {
+					return err
+				}
+				echo.Stdout = stdout
+				return echo.Run()
+			},
+			want: "a  b\n",
+		},
+		{
+			run: func(stdout, stderr *bytes.Buffer) error {
+				return cmd.Template(`false && echo skipped || echo ${msg} | tr a-z A-Z; echo done`).
+					With(cmd.Vars{"msg": "recovered"}).
+					Run(context.Background(), nil, stdout, stderr)
+			},
+			want: "RECOVERED\ndone\n",
+		},
+		{
+			run: func(stdout, stderr *bytes.Buffer) error {
+				return cmd.Template(`true || echo skipped; echo ‹${msg}› | cat`).
+					With(cmd.Vars{"msg": "a b"}).
+					Trace(func(pipeline string) { fmt.Fprintf(stdout, "+%s\n", pipeline) }).
+					Run(context.Background(), nil, stdout, stderr)
+			},
+			want: "+true\n+echo 'a b' | cat\na b\n",
+		},
+		{
+			run: func(stdout, stderr *bytes.Buffer) error {
+				return cmd.Pipe(cmd.Template(`cat`), cmd.Template(`tr a-z A-Z`)).
+					Pipe(cmd.Template(`tr -d ${chars}`).With(cmd.Vars{"chars": "E"})).
+					Run(context.Background(), strings.NewReader("hello\n"), stdout, stderr)
+			},
+			want: "HLLO\n",
+		},
+		{
+			run: func(stdout, stderr *bytes.Buffer) error {
+				return cmd.Pipe(cmd.Template(`echo a`), cmd.Template(`echo ${b}`)).Run(context.Background(), nil, stdout, stderr)
+			},
+			err: `template "echo ${b}": variable b is not set`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		var stdout, stderr bytes.Buffer
+		var err = tc.run(&stdout, &stderr)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("run failed (test case %d): %v\nstderr: %s", ti, err, stderr.String())
+		}
+		if diff := cmp.Diff(tc.want, stdout.String()); diff != "" {
+			tt.Fatalf("mismatching stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+// TestSharedWriters is meant to run with -race, all the commands write to the
+// same stderr.
+func TestSharedWriters(tt *testing.T) {
+	var got, err = cmd.Pipe(
+		cmd.Template(`sh -c ‹echo a >&2; echo b›`),
+		cmd.Template(`sh -c ‹cat; echo c >&2›`),
+		cmd.Template(`sh -c ‹cat; echo d >&2; exit 2›`),
+	).Output(context.Background())
+	if err == nil || err.Error() != "sh -c cat; echo d >&2; exit 2: exit status 2: a\nc\nd" {
+		tt.Fatalf("expected the error to include the stderr of all commands, got: %v", err)
+	}
+	if diff := cmp.Diff("b\n", string(got)); diff != "" {
+		tt.Fatalf("mismatching output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestRunCanceled(tt *testing.T) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var stdout bytes.Buffer
+	// sleep is killed, and the next pipeline does not start
+	var err = cmd.Template(`sleep 5; echo skipped`).Run(ctx, nil, &stdout, &stdout)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		tt.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if stdout.Len() != 0 {
+		tt.Fatalf("expected no output, got: %q", stdout.String())
+	}
+}
+
+func TestOutput(tt *testing.T) {
+	var got, err = cmd.Template(`printf %s ${word}`).With(cmd.Vars{"word": "hi"}).Output(context.Background())
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff("hi", string(got)); diff != "" {
+		tt.Fatalf("mismatching output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	_, err = cmd.Template(`ls /does-not-exist`).Output(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "exit status") || !strings.Contains(err.Error(), "does-not-exist") {
+		tt.Fatalf("expected the error to include the exit status and stderr, got: %v", err)
+	}
+}
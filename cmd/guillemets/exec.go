@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+
+	"github.com/siadat/well/cmd"
+	"github.com/siadat/well/syntax/strs/expander"
+)
+
+// execTemplate runs the pipelines of src, which are separated by &&, || and
+// ;, with cmd.Tmpl.Run. The variables are looked up by mapper. If verbose is
+// true, each pipeline is printed to stderr before it runs.
+func execTemplate(src string, mapper func(string) interface{}, verbose bool, stdin io.Reader, stdout, stderr io.Writer) error {
+	var variables, err = expander.GetVariables(src)
+	if err != nil {
+		return fmt.Errorf("failed to parse command: %v", err)
+	}
+	var vars = make(cmd.Vars)
+	for _, v := range variables {
+		if value := mapper(v.Name); value != nil {
+			vars[v.Name] = value
+		}
+	}
+
+	var tmpl = cmd.Template(src).With(vars)
+	if verbose {
+		tmpl = tmpl.Trace(func(pipeline string) {
+			fmt.Fprintf(stderr, "+%s\n", pipeline)
+		})
+	}
+	err = tmpl.Run(context.Background(), stdin, stdout, stderr)
+	var tmplErr *cmd.Error
+	if errors.As(err, &tmplErr) {
+		// the template is the input, it is not repeated in the error
+		return envError(tmplErr.Err)
+	}
+	return err
+}
+
+// exitCode returns the exit status of the command that failed with err, like
+// sh: 127 if it was not found, and 128 plus the signal if it was killed.
+func exitCode(err error) int {
+	if errors.Is(err, exec.ErrNotFound) {
+		return 127
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 {
+			return code
+		}
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+	}
+	return 1
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/syntax/strs/expander"
+)
+
+func TestExecTemplate(tt *testing.T) {
+	var testCases = []struct {
+		src        string
+		wantStdout string
+		wantStderr string
+		err        string
+	}{
+		{
+			src:        `echo «a | b» ${name}|tr a-z A-Z`,
+			wantStdout: "A | B WORLD\n",
+			wantStderr: "+echo \"a | b\" world | tr a-z A-Z\n",
+		},
+		{
+			src:        `false && echo skipped || echo ${missing|"recovered"}; echo done`,
+			wantStdout: "recovered\ndone\n",
+			wantStderr: "+false\n+echo recovered\n+echo done\n",
+		},
+		{
+			src:        `true || echo skipped && echo ran`,
+			wantStdout: "ran\n",
+			wantStderr: "+true\n+echo ran\n",
+		},
+		{
+			src: `true && false`,
+			err: "false: exit status 1",
+		},
+		{
+			// like set -o pipefail
+			src: `false | true && echo skipped`,
+			err: "false: exit status 1",
+		},
+		{
+			// both commands write to stderr
+			src:        `sh -c ‹echo a >&2; echo b› | sh -c ‹cat; echo c >&2›`,
+			wantStdout: "b\n",
+			wantStderr: "+sh -c 'echo a >&2; echo b' | sh -c 'cat; echo c >&2'\na\nc\n",
+		},
+		{
+			// nothing runs if an argument cannot be expanded
+			src: `echo a && echo ${missing}`,
+			err: `missing value for variable "missing", did you export it or set it with --var?`,
+		},
+		{
+			src: `echo a ;; echo b`,
+			err: "expected a command after ;",
+		},
+	}
+
+	var mapper = expander.MappingFuncFromMap(map[string]interface{}{"name": "world"})
+	for ti, tc := range testCases {
+		var stdout, stderr bytes.Buffer
+		var err = execTemplate(tc.src, mapper, true, strings.NewReader(""), &stdout, &stderr)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("exec failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.wantStdout, stdout.String()); diff != "" {
+			tt.Fatalf("mismatching stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+		if diff := cmp.Diff(tc.wantStderr, stderr.String()); diff != "" {
+			tt.Fatalf("mismatching stderr (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func TestExitCode(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want int
+	}{
+		{src: `sh -c ‹exit 3›`, want: 3},
+		{src: `sh -c ‹exit 4› | true`, want: 4},
+		{src: `sh -c ‹kill -9 \$\$›`, want: 137},
+		{src: `does-not-exist-well-test`, want: 127},
+	}
+
+	for ti, tc := range testCases {
+		var stdout, stderr bytes.Buffer
+		var err = execTemplate(tc.src, expander.MappingFuncFromMap(nil), false, nil, &stdout, &stderr)
+		if err == nil {
+			tt.Fatalf("expected an error (test case %d)", ti)
+		}
+		if got := exitCode(err); got != tc.want {
+			tt.Fatalf("expected exit code %d (test case %d), got %d: %v", tc.want, ti, got, err)
+		}
+	}
+}
@@ -1,28 +1,35 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/siadat/well/convert"
 	"github.com/siadat/well/syntax/strs/expander"
 	"github.com/siadat/well/syntax/strs/parser"
 	"github.com/urfave/cli/v2"
 )
 
+// envMapper returns the value of an environment variable, or nil if it is
+// not set, so that the defaults of the template apply.
 func envMapper(name string) interface{} {
 	var value, ok = os.LookupEnv(name)
 	if !ok {
-		fmt.Fprintf(os.Stderr, "Missing value for variable %q. Did you export it?\n", name)
-		os.Exit(1)
 		return nil
 	}
 	return value
 }
 
+// envError explains the errors of variables that are not set.
+func envError(err error) error {
+	if undefined, ok := err.(*expander.UndefinedError); ok && !undefined.Required {
+		return fmt.Errorf("missing value for variable %q, did you export it or set it with --var?", undefined.Name)
+	}
+	return err
+}
+
 func main() {
 	var app = &cli.App{
 		Name:  "guillemets",
@@ -37,7 +44,7 @@ func main() {
 			{
 				Name:  "render",
 				Usage: "render a given string",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{
 						Name:  "newline",
 						Usage: "add newline after output",
@@ -47,8 +54,21 @@ func main() {
 						Aliases: []string{"i"},
 						Usage:   "input command or string",
 					},
-				},
+					&cli.StringFlag{
+						Name:  "target",
+						Value: expander.Basic.String(),
+						Usage: "quote for a shell: " + strings.Join(expander.Targets(), ", "),
+					},
+				}, varFlags...),
 				Action: func(cmdCtx *cli.Context) error {
+					var target, targetErr = expander.ParseTarget(cmdCtx.String("target"))
+					if targetErr != nil {
+						return targetErr
+					}
+					var mapper, mapperErr = newMapper(cmdCtx)
+					if mapperErr != nil {
+						return mapperErr
+					}
 					var input string
 					if cmdCtx.String("input") == "-" {
 						var byts, err = io.ReadAll(os.Stdin)
@@ -65,9 +85,9 @@ func main() {
 					if cmdCtx.Bool("debug") {
 						fmt.Fprintf(os.Stderr, "[debug] input: %q\n", input)
 					}
-					var s, err = expander.ParseAndEncodeToString(input, envMapper, cmdCtx.Bool("debug"))
+					var s, err = expander.ParseAndEncodeToString(input, mapper, target, cmdCtx.Bool("debug"))
 					if err != nil {
-						return err
+						return envError(err)
 					}
 					fmt.Print(s)
 					if cmdCtx.Bool("newline") {
@@ -78,8 +98,8 @@ func main() {
 			},
 			{
 				Name:  "exec",
-				Usage: "execute a given command",
-				Flags: []cli.Flag{
+				Usage: "execute a given command, or commands separated by |, &&, || and ;",
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{
 						Name:  "newline",
 						Usage: "add newline after output",
@@ -94,8 +114,12 @@ func main() {
 						Aliases: []string{"v"},
 						Usage:   "enable verbose mode",
 					},
-				},
+				}, varFlags...),
 				Action: func(cmdCtx *cli.Context) error {
+					var mapper, mapperErr = newMapper(cmdCtx)
+					if mapperErr != nil {
+						return mapperErr
+					}
 					var input string
 					if cmdCtx.String("input") == "-" {
 						var byts, err = io.ReadAll(os.Stdin)
@@ -117,44 +141,51 @@ func main() {
 					if cmdCtx.Bool("debug") {
 						p.SetDebug(true)
 					}
-					var root, err = p.Parse(strings.NewReader(input))
-					if err != nil {
+					if _, err := p.Parse(strings.NewReader(input)); err != nil {
 						return fmt.Errorf("failed to parse command: %v", err)
 					}
 
-					var words, encodeErr = expander.EncodeToCmdArgs(root, envMapper)
-					if encodeErr != nil {
-						return fmt.Errorf("failed to create args: %s", encodeErr)
+					return execTemplate(input, mapper, cmdCtx.Bool("verbose"), os.Stdin, os.Stdout, os.Stderr)
+				},
+			},
+			{
+				Name:  "unquote",
+				Usage: "convert a POSIX shell command line to guillemets",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "input",
+						Aliases: []string{"i"},
+						Usage:   "input shell command, - for stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "check that the result expands to the same arguments as the input, variables are read from the environment",
+					},
+				},
+				Action: func(cmdCtx *cli.Context) error {
+					var input string
+					if cmdCtx.String("input") == "-" {
+						var byts, err = io.ReadAll(os.Stdin)
+						if err != nil {
+							panic(err)
+						}
+						input = string(byts)
+					} else {
+						input = cmdCtx.String("input")
 					}
-					var pwd, pwdErr = os.Getwd()
-					if pwdErr != nil {
-						return fmt.Errorf("failed to get current working directory: %s", pwdErr)
+					if input == "" {
+						return fmt.Errorf("nothing to unquote")
 					}
-
-					if len(words) == 0 {
-						return fmt.Errorf("nothing to execute")
+					var template, err = convert.Unquote(input)
+					if err != nil {
+						return err
 					}
-
-					if cmdCtx.Bool("verbose") {
-						var rendered, renderErr = expander.ParseAndEncodeToString(input, envMapper, cmdCtx.Bool("debug"))
-						if renderErr != nil {
-							return renderErr
+					if cmdCtx.Bool("check") {
+						if err := convert.CheckUnquote(input, template, os.LookupEnv); err != nil {
+							return fmt.Errorf("round trip check failed: %s", err)
 						}
-						fmt.Fprintf(os.Stderr, "+%s\n", rendered)
-					}
-
-					var cmd = exec.CommandContext(context.TODO(), words[0], words[1:]...)
-					cmd.Dir = pwd
-					cmd.Stdout = os.Stdout
-					cmd.Stderr = os.Stderr
-					cmd.Stdin = os.Stdin
-					cmd.Env = os.Environ()
-					if err := cmd.Start(); err != nil {
-						return fmt.Errorf("failed to start command: %s", err)
-					}
-					if err := cmd.Wait(); err != nil {
-						return fmt.Errorf("failed to wait for command: %s", err)
 					}
+					fmt.Println(template)
 					return nil
 				},
 			},
@@ -162,6 +193,7 @@ func main() {
 	}
 	if err := app.Run(os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "command failed: %s\n", err)
+		os.Exit(exitCode(err))
 	}
 
 }
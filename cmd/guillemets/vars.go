@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// The variables of a template are looked up in this order:
+//  1. --var name=value flags
+//  2. --env-file files
+//  3. --vars-file files
+//  4. the environment
+// A later flag of the same kind takes precedence over an earlier one, except
+// that a repeated --var sets a list, whose items are separate arguments.
+
+var varFlags = []cli.Flag{
+	&cli.GenericFlag{
+		Name:  "var",
+		Value: &listFlag{},
+		Usage: "set a variable with `name=value`, a repeated name is a list",
+	},
+	&cli.GenericFlag{
+		Name:  "env-file",
+		Value: &listFlag{},
+		Usage: "read variables from a dotenv `file`, can be repeated",
+	},
+	&cli.GenericFlag{
+		Name:  "vars-file",
+		Value: &listFlag{},
+		Usage: "read variables from a YAML or JSON `file`, nested values are named like ${db.host}, can be repeated",
+	},
+}
+
+// listFlag collects the values of a repeated flag. Unlike cli.StringSlice,
+// values are not split on commas.
+type listFlag []string
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func flagValues(cmdCtx *cli.Context, name string) []string {
+	if f, ok := cmdCtx.Generic(name).(*listFlag); ok {
+		return *f
+	}
+	return nil
+}
+
+// newMapper returns the mapping of the variables given by the flags of
+// cmdCtx, which falls back to the environment.
+func newMapper(cmdCtx *cli.Context) (func(string) interface{}, error) {
+	var values = map[string]interface{}{}
+
+	for _, filename := range flagValues(cmdCtx, "vars-file") {
+		if err := readVarsFile(filename, values); err != nil {
+			return nil, err
+		}
+	}
+	for _, filename := range flagValues(cmdCtx, "env-file") {
+		if err := readEnvFile(filename, values); err != nil {
+			return nil, err
+		}
+	}
+	var lists = map[string][]string{}
+	for _, v := range flagValues(cmdCtx, "var") {
+		var name, value, ok = strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --var %q, expected name=value", v)
+		}
+		lists[name] = append(lists[name], value)
+	}
+	for name, list := range lists {
+		if len(list) == 1 {
+			values[name] = list[0]
+		} else {
+			values[name] = list
+		}
+	}
+
+	return func(name string) interface{} {
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return envMapper(name)
+	}, nil
+}
+
+// readEnvFile reads a dotenv file into values. Each line is NAME=value,
+// optionally prefixed with export. Values can be single quoted, which are
+// taken literally, or double quoted, in which \\, \", \n and \$ are escapes
+// and any other backslash is kept, e.g. "C:\path". Unquoted values are
+// trimmed, and a # after a space starts a comment.
+func readEnvFile(filename string, values map[string]interface{}) error {
+	var f, err = os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var lineNum = 0
+	var s = bufio.NewScanner(f)
+	for s.Scan() {
+		lineNum += 1
+		var line = strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		var name, value, ok = strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("%s:%d: expected NAME=value", filename, lineNum)
+		}
+		value, err = envFileValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", filename, lineNum, err)
+		}
+		values[name] = value
+	}
+	return s.Err()
+}
+
+func envFileValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		var end = closingQuote(value)
+		if end == -1 {
+			return "", fmt.Errorf("unclosed double quote")
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the quoted value", rest)
+		}
+		return unescapeDouble(value[1:end]), nil
+	case strings.HasPrefix(value, `'`):
+		var end = strings.IndexByte(value[1:], '\'')
+		if end == -1 {
+			return "", fmt.Errorf("unclosed single quote")
+		}
+		if rest := strings.TrimSpace(value[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the quoted value", rest)
+		}
+		return value[1 : end+1], nil
+	default:
+		if i := strings.Index(value, " #"); i != -1 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// unescapeDouble returns the value of the inside of a double quoted value.
+func unescapeDouble(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '\\', '"', '$':
+				i++
+				b.WriteByte(s[i])
+				continue
+			case 'n':
+				i++
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// closingQuote returns the index of the unescaped double quote that closes
+// the one at the start of s, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// readVarsFile reads a YAML or JSON file into values. Nested mappings are
+// flattened, e.g. the host of db is named db.host, and sequences of scalars
+// are lists.
+func readVarsFile(filename string, values map[string]interface{}) error {
+	var byts, err = os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	// JSON is a subset of YAML
+	var root interface{}
+	if err := yaml.Unmarshal(byts, &root); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	if root == nil {
+		return nil
+	}
+	if err := flattenVars("", root, values); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	return nil
+}
+
+func flattenVars(prefix string, v interface{}, values map[string]interface{}) error {
+	var join = func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var keys = make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := flattenVars(join(key), v[key], values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			if err := flattenVars(join(fmt.Sprint(key)), value, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		// null leaves the variable unset
+		return nil
+	case []interface{}:
+		if prefix == "" {
+			return fmt.Errorf("expected a mapping, got a list")
+		}
+		var list = make([]string, len(v))
+		for k, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, map[interface{}]interface{}, []interface{}, nil:
+				return fmt.Errorf("unsupported value for item %d of %s, items must be scalars", k, prefix)
+			}
+			list[k] = fmt.Sprint(item)
+		}
+		values[prefix] = list
+		return nil
+	default:
+		if prefix == "" {
+			return fmt.Errorf("expected a mapping, got %T", v)
+		}
+		values[prefix] = fmt.Sprint(v)
+		return nil
+	}
+}
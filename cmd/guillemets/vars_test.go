@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadEnvFile(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			src: "# comment\n\nA=1\nexport B = two words # comment\nC=\"a \\\"quoted\\\" #value\\n\" # comment\nD='$literal \\n'\nE=\n",
+			want: map[string]interface{}{
+				"A": "1",
+				"B": "two words",
+				"C": "a \"quoted\" #value\n",
+				"D": `$literal \n`,
+				"E": "",
+			},
+		},
+		{
+			// only \\, \", \n and \$ are escapes
+			src: `A="C:\path\to\x" # windows` + "\n" + `B="\$HOME \\ \t \u00e9 \"q\""` + "\n",
+			want: map[string]interface{}{
+				"A": `C:\path\to\x`,
+				"B": `$HOME \ \t \u00e9 "q"`,
+			},
+		},
+		{
+			src: "A=1\nB\n",
+			err: ":2: expected NAME=value",
+		},
+		{
+			src: "A=\"unclosed\n",
+			err: ":1: unclosed double quote",
+		},
+		{
+			src: "A='a' b\n",
+			err: `:1: unexpected "b" after the quoted value`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		var filename = filepath.Join(tt.TempDir(), "vars.env")
+		if err := os.WriteFile(filename, []byte(tc.src), 0o644); err != nil {
+			tt.Fatal(err)
+		}
+		var got = map[string]interface{}{}
+		var err = readEnvFile(filename, got)
+		if tc.err != "" {
+			if err == nil || err.Error() != filename+tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("read failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func TestReadVarsFile(tt *testing.T) {
+	var testCases = []struct {
+		name string
+		src  string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			name: "vars.yaml",
+			src:  "db:\n  host: localhost\n  port: 5432\n  password: null\nverbose: true\n",
+			want: map[string]interface{}{"db.host": "localhost", "db.port": "5432", "verbose": "true"},
+		},
+		{
+			name: "vars.json",
+			src:  `{"db": {"host": "localhost", "replica": {"host": "replica"}}}`,
+			want: map[string]interface{}{"db.host": "localhost", "db.replica.host": "replica"},
+		},
+		{
+			name: "vars.yaml",
+			src:  "hosts: [a b, 2]\nempty: []\n",
+			want: map[string]interface{}{"hosts": []string{"a b", "2"}, "empty": []string{}},
+		},
+		{
+			name: "vars.yaml",
+			src:  "hosts: [a, [b]]\n",
+			err:  "unsupported value for item 1 of hosts, items must be scalars",
+		},
+	}
+
+	for ti, tc := range testCases {
+		var filename = filepath.Join(tt.TempDir(), tc.name)
+		if err := os.WriteFile(filename, []byte(tc.src), 0o644); err != nil {
+			tt.Fatal(err)
+		}
+		var got = map[string]interface{}{}
+		var err = readVarsFile(filename, got)
+		if tc.err != "" {
+			if err == nil || err.Error() != filename+": "+tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("read failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/siadat/well/diagnostics"
+)
+
+var diagnosticsFormats = []string{"human", "json", "sarif"}
+
+// sourceError is an error in a Well file, it keeps the file name and the
+// source, so that the error can be reported in any diagnostics format.
+type sourceError struct {
+	filename string
+	src      []byte
+	err      error
+}
+
+func (e sourceError) Error() string {
+	return e.err.Error()
+}
+
+func (e sourceError) Unwrap() error {
+	return e.err
+}
+
+func withSource(filename string, src []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	return sourceError{filename: filename, src: src, err: err}
+}
+
+// reportError writes err in the given diagnostics format.
+func reportError(w io.Writer, format string, err error) error {
+	var diags = diagnostics.FromError(err)
+
+	var srcErr sourceError
+	var isSrcErr = errors.As(err, &srcErr)
+	if isSrcErr {
+		for i := range diags {
+			diags[i].File = srcErr.filename
+		}
+	}
+
+	switch format {
+	case "json":
+		return diagnostics.WriteJSON(w, diags)
+	case "sarif":
+		return diagnostics.WriteSARIF(w, diags)
+	default:
+		var diagErr diagnostics.Error
+		if !isSrcErr || !errors.As(err, &diagErr) {
+			var _, err2 = fmt.Fprintf(w, "%s\n", err)
+			return err2
+		}
+		return diagnostics.WriteHuman(w, srcErr.src, diags)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/siadat/well/fumt"
+)
+
+type fmtOptions struct {
+	write bool // rewrite the files in place
+	list  bool // print the names of the files that would change
+	diff  bool // print a unified diff of the changes
+	check bool // fail if any file would change
+	debug bool
+}
+
+// collectWellFiles returns the paths themselves if they are files, and the
+// *.well files under them if they are directories.
+func collectWellFiles(paths []string) ([]string, error) {
+	var filenames []string
+	for _, path := range paths {
+		var info, err = os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(filename, ".well") {
+				filenames = append(filenames, filename)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filenames, nil
+}
+
+// formatFile formats a file, and reports whether it was not formatted.
+func formatFile(filename string, opts fmtOptions, stdout io.Writer) (bool, error) {
+	var src, readErr = os.ReadFile(filename)
+	if readErr != nil {
+		return false, readErr
+	}
+
+	var formater = fumt.NewFormater()
+	formater.SetDebug(opts.debug)
+	var formatted bytes.Buffer
+	if err := formater.Format(bytes.NewReader(src), &formatted); err != nil {
+		return false, withSource(filename, src, err)
+	}
+
+	var changed = !bytes.Equal(src, formatted.Bytes())
+	if !opts.write && !opts.list && !opts.diff && !opts.check {
+		var _, err = stdout.Write(formatted.Bytes())
+		return changed, err
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if opts.list || opts.check {
+		fmt.Fprintln(stdout, filename)
+	}
+	if opts.diff {
+		var _, err = stdout.Write(fumt.Diff(filename+".orig", filename, src, formatted.Bytes()))
+		if err != nil {
+			return changed, err
+		}
+	}
+	if opts.write {
+		if err := writeFileAtomically(filename, formatted.Bytes()); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// writeFileAtomically replaces the content of the file, so that it is never
+// left half written, even if well is interrupted.
+func writeFileAtomically(filename string, content []byte) error {
+	var info, err = os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after a successful rename
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
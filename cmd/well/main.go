@@ -2,23 +2,47 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/siadat/well/fumt"
+	"github.com/siadat/well/bashgen"
+	"github.com/siadat/well/convert"
+	"github.com/siadat/well/debugger"
 	"github.com/siadat/well/interpreter"
+	"github.com/siadat/well/lsp"
+	"github.com/siadat/well/repl"
+	"github.com/siadat/well/trace"
 	"github.com/siadat/well/types"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
+	var diagnosticsFormat = "human"
 	var app = &cli.App{
 		Name: "well",
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name: "debug",
 			},
+			&cli.StringFlag{
+				Name:  "diagnostics-format",
+				Usage: "format of the reported errors: human, json (one object per line) or sarif",
+				Value: "human",
+			},
+		},
+		Before: func(cmdCtx *cli.Context) error {
+			var format = cmdCtx.String("diagnostics-format")
+			for _, f := range diagnosticsFormats {
+				if f == format {
+					diagnosticsFormat = format
+					return nil
+				}
+			}
+			return fmt.Errorf("unsupported diagnostics format %q", format)
 		},
 		Commands: []*cli.Command{
 			{
@@ -35,6 +59,22 @@ func main() {
 						Aliases: []string{"v"},
 						Usage:   "enable verbose mode",
 					},
+					&cli.BoolFlag{
+						Name:  "trace",
+						Usage: "log the calls of Well functions and the external commands to stderr",
+					},
+					&cli.StringFlag{
+						Name:  "trace-file",
+						Usage: "write the calls and the external commands to a file as Chrome trace-event JSON",
+					},
+					&cli.BoolFlag{
+						Name:  "profile",
+						Usage: "print the time spent in each Well function and external command to stderr at exit",
+					},
+					&cli.BoolFlag{
+						Name:  "debug-interactive",
+						Usage: "stop at the first statement and read debugger commands from the terminal",
+					},
 				},
 				Action: func(cmdCtx *cli.Context) error {
 					var byts, readErr = os.ReadFile(cmdCtx.String("file"))
@@ -44,10 +84,13 @@ func main() {
 
 					var checker = types.NewChecker()
 					checker.SetDebug(cmdCtx.Bool("debug"))
+					checker.SetDir(filepath.Dir(cmdCtx.String("file")))
 					var _, checkErr = checker.Check(bytes.NewReader(byts))
 					if checkErr != nil {
-						fmt.Fprintf(os.Stderr, "type checker failed\n")
-						return checkErr
+						if diagnosticsFormat == "human" {
+							fmt.Fprintf(os.Stderr, "type checker failed\n")
+						}
+						return withSource(cmdCtx.String("file"), byts, checkErr)
 					}
 
 					var fileDependencies = checker.UnresolvedDependencies()
@@ -56,7 +99,7 @@ func main() {
 					}
 					if l := len(fileDependencies); l > 0 {
 						var lines = append([]string{""}, fileDependencies...)
-						return fmt.Errorf("The following external commands and files are undeclared:%s", strings.Join(lines, "\n   "))
+						return fmt.Errorf("The following external commands and files are missing:%s", strings.Join(lines, "\n   "))
 					}
 
 					var interp = interpreter.NewInterpreter(os.Stdout, os.Stderr)
@@ -76,44 +119,256 @@ func main() {
 					//  [->] well run -f ./testdata/test5.well my_function s="s value" x="x value"
 					//  [->] well run -f ./testdata/test5.well my_function -s "s value" -x "x value"
 
-					var _, evalErr = interp.Eval(bytes.NewReader(byts), env)
+					var tracers []interpreter.Tracer
+					if cmdCtx.Bool("trace") {
+						tracers = append(tracers, trace.NewTextTracer(os.Stderr))
+					}
+					if cmdCtx.String("trace-file") != "" {
+						var f, err = os.Create(cmdCtx.String("trace-file"))
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						var tracer = trace.NewChromeTracer(f)
+						defer tracer.Close()
+						tracers = append(tracers, tracer)
+					}
+					if cmdCtx.Bool("profile") {
+						var profiler = trace.NewProfiler()
+						defer profiler.WriteReport(os.Stderr)
+						tracers = append(tracers, profiler)
+					}
+					if len(tracers) > 0 {
+						interp.SetTracer(trace.Tee(tracers...))
+					}
+
+					if cmdCtx.Bool("debug-interactive") {
+						// stdin may be the input of the program
+						var commands io.Reader = os.Stdin
+						if tty, err := os.Open("/dev/tty"); err == nil {
+							defer tty.Close()
+							commands = tty
+						}
+						var d = debugger.NewDebugger(byts, commands, os.Stderr)
+						d.SetDebug(cmdCtx.Bool("debug"))
+						d.Attach(interp)
+					}
+
+					var _, evalErr = interp.EvalFile(cmdCtx.String("file"), bytes.NewReader(byts), env)
 					if evalErr != nil {
-						return evalErr
+						return withSource(cmdCtx.String("file"), byts, evalErr)
 					}
 
 					return nil
 				},
 			},
 			{
-				Name: "fmt",
+				Name:      "fmt",
+				Usage:     "format Well files, directories are searched for *.well files",
+				ArgsUsage: "[path ...]",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "file",
-						Aliases:  []string{"f"},
-						Usage:    "path to Well file to be executed",
-						Required: true,
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "path to Well file to be formatted",
 					},
 					&cli.BoolFlag{
 						Name:    "verbose",
 						Aliases: []string{"v"},
 						Usage:   "enable verbose mode",
 					},
+					&cli.BoolFlag{
+						Name:  "w",
+						Usage: "write the result to the files instead of stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "l",
+						Usage: "list the files whose formatting differs",
+					},
+					&cli.BoolFlag{
+						Name:  "d",
+						Usage: "print a unified diff instead of the formatted files",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "list the files whose formatting differs and exit with a non-zero status if there are any",
+					},
+				},
+				Action: func(cmdCtx *cli.Context) error {
+					var paths = cmdCtx.Args().Slice()
+					if file := cmdCtx.String("file"); file != "" {
+						paths = append([]string{file}, paths...)
+					}
+					if len(paths) == 0 {
+						return fmt.Errorf("expected at least 1 file or directory")
+					}
+					var filenames, err = collectWellFiles(paths)
+					if err != nil {
+						return err
+					}
+
+					var opts = fmtOptions{
+						write: cmdCtx.Bool("w"),
+						list:  cmdCtx.Bool("l"),
+						diff:  cmdCtx.Bool("d"),
+						check: cmdCtx.Bool("check"),
+						debug: cmdCtx.Bool("debug"),
+					}
+					var unformatted = 0
+					for _, filename := range filenames {
+						var changed, err = formatFile(filename, opts, os.Stdout)
+						if err != nil {
+							return err
+						}
+						if changed {
+							unformatted += 1
+						}
+					}
+					if opts.check && unformatted > 0 {
+						return fmt.Errorf("%d of %d files are not formatted", unformatted, len(filenames))
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "deps",
+				Usage: "print the files and commands a Well file depends on as JSON",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "path to Well file",
+						Required: true,
+					},
+				},
+				Action: func(cmdCtx *cli.Context) error {
+					var byts, readErr = os.ReadFile(cmdCtx.String("file"))
+					if readErr != nil {
+						return readErr
+					}
+
+					var checker = types.NewChecker()
+					checker.SetDebug(cmdCtx.Bool("debug"))
+					checker.SetDir(filepath.Dir(cmdCtx.String("file")))
+					var _, checkErr = checker.Check(bytes.NewReader(byts))
+					if checkErr != nil {
+						if diagnosticsFormat == "human" {
+							fmt.Fprintf(os.Stderr, "type checker failed\n")
+						}
+						return withSource(cmdCtx.String("file"), byts, checkErr)
+					}
+
+					var output = struct {
+						Commands []types.Dependency `json:"commands"`
+						Files    []types.Dependency `json:"files"`
+					}{
+						Commands: []types.Dependency{},
+						Files:    []types.Dependency{},
+					}
+					for _, dep := range checker.Dependencies() {
+						switch dep.Kind {
+						case "command":
+							output.Commands = append(output.Commands, dep)
+						case "file":
+							output.Files = append(output.Files, dep)
+						}
+					}
+
+					var enc = json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(output)
+				},
+			},
+			{
+				// This handles the risk of "What if we change our mind?"
+				Name:  "compile",
+				Usage: "translate a Well file to a standalone script",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "path to Well file to be compiled",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "target",
+						Usage: "target language, only bash is supported",
+						Value: "bash",
+					},
 				},
 				Action: func(cmdCtx *cli.Context) error {
+					if target := cmdCtx.String("target"); target != "bash" {
+						return fmt.Errorf("unsupported target %q", target)
+					}
 					var byts, readErr = os.ReadFile(cmdCtx.String("file"))
 					if readErr != nil {
 						return readErr
 					}
 
-					var formater = fumt.NewFormater()
-					formater.SetDebug(cmdCtx.Bool("debug"))
-					return formater.Format(bytes.NewReader(byts), os.Stdout)
+					var generator = bashgen.NewGenerator()
+					generator.SetDebug(cmdCtx.Bool("debug"))
+					return withSource(cmdCtx.String("file"), byts, generator.Generate(bytes.NewReader(byts), os.Stdout))
+				},
+			},
+			{
+				Name:  "lsp",
+				Usage: "run the language server over stdio",
+				Action: func(cmdCtx *cli.Context) error {
+					var server = lsp.NewServer()
+					server.SetDebug(cmdCtx.Bool("debug"))
+					return server.Serve(os.Stdin, os.Stdout)
+				},
+			},
+			{
+				Name:  "repl",
+				Usage: "evaluate declarations and expressions interactively",
+				Action: func(cmdCtx *cli.Context) error {
+					var r = repl.NewRepl(os.Stdout, os.Stderr)
+					r.SetDebug(cmdCtx.Bool("debug"))
+					return r.Run(os.Stdin)
+				},
+			},
+			{
+				Name:      "convert",
+				Usage:     "translate a POSIX sh script to a Well file",
+				ArgsUsage: "script.sh",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "path to the Well file to be written, defaults to stdout",
+					},
+				},
+				Action: func(cmdCtx *cli.Context) error {
+					if cmdCtx.NArg() != 1 {
+						return fmt.Errorf("expected 1 script, got %d", cmdCtx.NArg())
+					}
+					var filename = cmdCtx.Args().First()
+					var byts, readErr = os.ReadFile(filename)
+					if readErr != nil {
+						return readErr
+					}
+
+					var converter = convert.NewConverter()
+					converter.SetDebug(cmdCtx.Bool("debug"))
+					var program bytes.Buffer
+					if err := converter.Convert(bytes.NewReader(byts), &program); err != nil {
+						return fmt.Errorf("%s:%w", filename, err)
+					}
+
+					if output := cmdCtx.String("output"); output != "" {
+						return os.WriteFile(output, program.Bytes(), 0644)
+					}
+					var _, err = os.Stdout.Write(program.Bytes())
+					return err
 				},
 			},
-			// TODO: a subcommand to generate Bash script to handle the risk of "What if we change our mind?" before getting approval.
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
+		if reportErr := reportError(os.Stderr, diagnosticsFormat, err); reportErr != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		os.Exit(1)
 	}
 }
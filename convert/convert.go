@@ -0,0 +1,1070 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siadat/well/erroring"
+	"github.com/siadat/well/syntax/posix"
+	"github.com/siadat/well/syntax/strs/expander"
+	strs_parser "github.com/siadat/well/syntax/strs/parser"
+	strs_scanner "github.com/siadat/well/syntax/strs/scanner"
+)
+
+// This package translates a POSIX sh script into a Well program. It is the
+// reverse of bashgen, and it exists to migrate existing scripts.
+//
+// The translation follows these rules:
+//   - Every distinct command line becomes an external function. The
+//     variables used in the command line become its parameters.
+//   - Quoted strings become guillemet strings. A script passed to sh -c,
+//     bash -c or ssh becomes a nested guillemet string, if that produces
+//     exactly the same script.
+//   - Shell functions become Well functions. $1, $2, ... become arg1, arg2,
+//     ... and the variables they read from the caller become parameters.
+//   - Top-level statements go into main.
+//   - [ a = b ], [ a != b ], [ -n a ] and [ -z a ] become == and regex
+//     matches.
+//
+// Constructs that cannot be translated fail with their position. Well has no
+// values for them, so these are not supported:
+//   - file tests, e.g. [ -f a ], [ -d a ] and [ -e a ], numeric tests, e.g.
+//     [ a -eq b ], and negated tests, e.g. [ ! -z a ];
+//   - environment variables, e.g. $HOME, i.e. variables that are not set by
+//     the script, and the special parameters, e.g. $@, $# and $?;
+//   - redirections, e.g. > file, 2>&1 and < file;
+//   - command substitutions, e.g. $(cmd) and `cmd`, and arithmetic, e.g.
+//     $((a + 1));
+//   - loops, case statements, && and || lists, background jobs and the
+//     exit status of commands as conditions;
+//   - parameter expansions other than $name and ${name}, e.g. ${a:-b}, and
+//     glob patterns.
+
+type converter struct {
+	debug bool
+	lines []string
+
+	funcs     map[string]*shellFunc
+	externals []*external
+	byKey     map[string]*external
+	taken     map[string]bool
+	currFunc  *shellFunc
+	scope     *scope
+	environ   bool // shell variables are environment variables, see Unquote
+}
+
+type shellFunc struct {
+	decl     *posix.FuncDecl
+	wellName string
+	nargs    int
+	free     []string // variables read from the caller
+	comments []*posix.Comment
+}
+
+type external struct {
+	name   string
+	piped  bool
+	params []string
+	items  []strs_parser.CmdNode
+}
+
+type scope struct {
+	parent *scope
+	vars   map[string]bool
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, vars: make(map[string]bool)}
+}
+
+func (s *scope) has(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.vars[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func NewConverter() *converter {
+	return &converter{}
+}
+
+func (c *converter) SetDebug(v bool) {
+	c.debug = v
+}
+
+// reserved are names that cannot be used for Well functions or variables in
+// the generated program.
+var reserved = map[string]bool{
+	"let": true, "function": true, "external": true, "requires": true,
+	"if": true, "else": true, "return": true, "true": true, "false": true,
+	"main": true, "print_stream": true, "exit": true, "stdin": true,
+	"MainStdin": true,
+}
+
+var shellBuiltins = map[string]bool{
+	"cd": true, "export": true, "unset": true, "local": true, "readonly": true,
+	"shift": true, "eval": true, "exec": true, "source": true, ".": true,
+	":": true, "read": true, "trap": true, "wait": true, "break": true,
+	"continue": true,
+}
+
+func (c *converter) Convert(src io.Reader, out io.Writer) error {
+	var byts, readErr = ioutil.ReadAll(src)
+	if readErr != nil {
+		return readErr
+	}
+	var file, parseErr = posix.NewParser().Parse(bytes.NewReader(byts))
+	if parseErr != nil {
+		return parseErr
+	}
+
+	c.lines = strings.Split(string(byts), "\n")
+	c.funcs = make(map[string]*shellFunc)
+	c.externals = nil
+	c.byKey = make(map[string]*external)
+	c.taken = make(map[string]bool)
+
+	var program, err = erroring.CallAndRecover[posix.Error](func() string {
+		var mainStmts = c.collect(file)
+
+		var funcs bytes.Buffer
+		for _, stmt := range file.Stmts {
+			if decl, ok := stmt.(*posix.FuncDecl); ok {
+				c.genFunc(&funcs, c.funcs[decl.Name])
+			}
+		}
+
+		c.currFunc = nil
+		c.scope = newScope(nil)
+		var main bytes.Buffer
+		fmt.Fprintf(&main, "function (stdin reader) | main() {\n")
+		c.genStmts(&main, mainStmts, 1)
+		fmt.Fprintf(&main, "}\n")
+
+		var buf bytes.Buffer
+		for _, ext := range c.externals {
+			fmt.Fprintf(&buf, "%s\n", ext)
+		}
+		if len(c.externals) > 0 {
+			fmt.Fprintf(&buf, "\n")
+		}
+		buf.Write(funcs.Bytes())
+		buf.Write(main.Bytes())
+		return buf.String()
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, program)
+	return err
+}
+
+// collect declares the shell functions and returns the statements that go
+// into main.
+func (c *converter) collect(file *posix.File) []posix.Stmt {
+	var variables = make(map[string]bool)
+	for _, stmt := range file.Stmts {
+		walkStmts([]posix.Stmt{stmt}, func(stmt posix.Stmt) {
+			if assign, ok := stmt.(*posix.Assign); ok {
+				if reserved[assign.Name] {
+					panic(newError(assign.Pos(), "%s is a reserved name in Well", assign.Name))
+				}
+				variables[assign.Name] = true
+			}
+		})
+	}
+	for name := range variables {
+		c.taken[name] = true
+	}
+
+	var mainStmts []posix.Stmt
+	var comments []*posix.Comment
+	for _, stmt := range file.Stmts {
+		switch stmt := stmt.(type) {
+		case *posix.Comment:
+			if stmt.Position.Line == 1 && strings.HasPrefix(stmt.Text, "#!") {
+				continue // shebang
+			}
+			comments = append(comments, stmt)
+			continue
+		case *posix.FuncDecl:
+			if _, ok := c.funcs[stmt.Name]; ok {
+				panic(newError(stmt.Pos(), "function %s is declared twice", stmt.Name))
+			}
+			c.funcs[stmt.Name] = &shellFunc{
+				decl:     stmt,
+				wellName: c.uniqueName(stmt.Name),
+				comments: comments,
+			}
+			comments = nil
+			continue
+		}
+		for _, comment := range comments {
+			mainStmts = append(mainStmts, comment)
+		}
+		comments = nil
+		mainStmts = append(mainStmts, stmt)
+	}
+	for _, comment := range comments {
+		mainStmts = append(mainStmts, comment)
+	}
+
+	c.resolveFuncParams()
+	return mainStmts
+}
+
+// resolveFuncParams finds the positional parameters and the variables that
+// every function reads from its caller, including through the functions it
+// calls.
+func (c *converter) resolveFuncParams() {
+	var assigned = make(map[*shellFunc]map[string]bool)
+	var free = make(map[*shellFunc]map[string]bool)
+	var calls = make(map[*shellFunc][]*shellFunc)
+
+	for _, f := range c.funcs {
+		assigned[f] = make(map[string]bool)
+		free[f] = make(map[string]bool)
+		walkStmts(f.decl.Body, func(stmt posix.Stmt) {
+			switch stmt := stmt.(type) {
+			case *posix.FuncDecl:
+				panic(newError(stmt.Pos(), "functions must be declared at the top level"))
+			case *posix.Assign:
+				assigned[f][stmt.Name] = true
+			case *posix.Pipeline:
+				if callee := c.calledFunc(stmt.Cmds[0]); callee != nil {
+					calls[f] = append(calls[f], callee)
+				}
+			}
+		})
+		walkParams(f.decl.Body, func(pos posix.Pos, name string) {
+			if n, err := strconv.Atoi(name); err == nil {
+				if n == 0 {
+					panic(newError(pos, "$0 is not supported"))
+				}
+				if n > f.nargs {
+					f.nargs = n
+				}
+				return
+			}
+			free[f][name] = true
+		})
+		for name := range assigned[f] {
+			delete(free[f], name)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for f, callees := range calls {
+			for _, callee := range callees {
+				for name := range free[callee] {
+					if !assigned[f][name] && !free[f][name] {
+						free[f][name] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for f, names := range free {
+		for name := range names {
+			f.free = append(f.free, name)
+		}
+		sort.Strings(f.free)
+	}
+}
+
+func (c *converter) calledFunc(cmd *posix.Command) *shellFunc {
+	if name, ok := cmd.Words[0].Lit(); ok {
+		return c.funcs[name]
+	}
+	return nil
+}
+
+func walkStmts(stmts []posix.Stmt, f func(posix.Stmt)) {
+	for _, stmt := range stmts {
+		f(stmt)
+		switch stmt := stmt.(type) {
+		case *posix.IfClause:
+			walkStmts([]posix.Stmt{stmt.Cond}, f)
+			walkStmts(stmt.Then, f)
+			walkStmts(stmt.Else, f)
+		case *posix.FuncDecl:
+			walkStmts(stmt.Body, f)
+		}
+	}
+}
+
+func walkParams(stmts []posix.Stmt, f func(posix.Pos, string)) {
+	var walkParts func(pos posix.Pos, parts []posix.WordPart)
+	walkParts = func(pos posix.Pos, parts []posix.WordPart) {
+		for _, part := range parts {
+			switch part := part.(type) {
+			case posix.ParamExp:
+				f(pos, part.Name)
+			case posix.DblQuoted:
+				walkParts(pos, part.Parts)
+			}
+		}
+	}
+	walkStmts(stmts, func(stmt posix.Stmt) {
+		switch stmt := stmt.(type) {
+		case *posix.Assign:
+			walkParts(stmt.Value.Position, stmt.Value.Parts)
+		case *posix.Pipeline:
+			for _, cmd := range stmt.Cmds {
+				for _, word := range cmd.Words {
+					walkParts(word.Position, word.Parts)
+				}
+			}
+		}
+	})
+}
+
+var identRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// uniqueName returns a valid Well identifier based on name that is not used
+// by any other function or variable.
+func (c *converter) uniqueName(name string) string {
+	var base = identRe.ReplaceAllString(name, "_")
+	if base == "" || base[0] >= '0' && base[0] <= '9' {
+		base = "cmd_" + base
+	}
+	if reserved[base] {
+		base += "_cmd"
+	}
+	var unique = base
+	for i := 2; c.taken[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", base, i)
+	}
+	c.taken[unique] = true
+	return unique
+}
+
+func (c *converter) genFunc(buf *bytes.Buffer, f *shellFunc) {
+	c.currFunc = f
+	c.scope = newScope(nil)
+
+	var params []string
+	for i := 1; i <= f.nargs; i++ {
+		var name = fmt.Sprintf("arg%d", i)
+		c.declare(f.decl.Pos(), name)
+		params = append(params, name+" string")
+	}
+	for _, name := range f.free {
+		c.declare(f.decl.Pos(), name)
+		params = append(params, name+" string")
+	}
+
+	for _, comment := range f.comments {
+		fmt.Fprintf(buf, "%s\n", wellComment(comment))
+	}
+	fmt.Fprintf(buf, "function %s(%s) {\n", f.wellName, strings.Join(params, ", "))
+	c.genStmts(buf, f.decl.Body, 1)
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+func (c *converter) declare(pos posix.Pos, name string) {
+	if c.scope.has(name) {
+		panic(newError(pos, "reassigning %s is not supported", name))
+	}
+	c.scope.vars[name] = true
+}
+
+func wellComment(comment *posix.Comment) string {
+	var text = strings.TrimPrefix(comment.Text, "#")
+	if text != "" && !strings.HasPrefix(text, " ") {
+		text = " " + text
+	}
+	return "//" + text
+}
+
+func (c *converter) genStmts(buf *bytes.Buffer, stmts []posix.Stmt, indent int) {
+	var tabs = strings.Repeat("\t", indent)
+	for i, stmt := range stmts {
+		// Keep the blank lines that separate statements
+		if line := stmt.Pos().Line; i > 0 && line >= 2 && strings.TrimSpace(c.lines[line-2]) == "" {
+			fmt.Fprintf(buf, "\n")
+		}
+
+		switch stmt := stmt.(type) {
+		case *posix.Comment:
+			fmt.Fprintf(buf, "%s%s\n", tabs, wellComment(stmt))
+		case *posix.Assign:
+			var value = c.valueExpr(stmt.Value)
+			c.declare(stmt.Pos(), stmt.Name)
+			fmt.Fprintf(buf, "%slet %s = %s\n", tabs, stmt.Name, value)
+		case *posix.Pipeline:
+			fmt.Fprintf(buf, "%s%s\n", tabs, c.pipelineStmt(stmt))
+		case *posix.IfClause:
+			fmt.Fprintf(buf, "%s", tabs)
+			var assigned = c.genIf(buf, stmt, indent)
+			for name := range assigned {
+				c.declare(stmt.Pos(), name)
+			}
+			fmt.Fprintf(buf, "\n")
+		case *posix.FuncDecl:
+			panic(newError(stmt.Pos(), "functions must be declared at the top level"))
+		default:
+			panic(newError(stmt.Pos(), "unsupported statement %T", stmt))
+		}
+	}
+}
+
+// genIf writes an if statement without its leading indentation and trailing
+// newline. It returns the variables that are assigned in every branch,
+// because only those can be used after the if statement.
+func (c *converter) genIf(buf *bytes.Buffer, clause *posix.IfClause, indent int) map[string]bool {
+	var tabs = strings.Repeat("\t", indent)
+
+	var genBranch = func(stmts []posix.Stmt) map[string]bool {
+		var outer = c.scope
+		c.scope = newScope(outer)
+		c.genStmts(buf, stmts, indent+1)
+		var assigned = c.scope.vars
+		c.scope = outer
+		return assigned
+	}
+
+	fmt.Fprintf(buf, "if %s {\n", c.condExpr(clause.Cond))
+	var thenAssigned = genBranch(clause.Then)
+
+	var elseAssigned map[string]bool
+	switch {
+	case len(clause.Else) == 1 && isIfClause(clause.Else[0]):
+		fmt.Fprintf(buf, "%s} else ", tabs)
+		var outer = c.scope
+		c.scope = newScope(outer)
+		elseAssigned = c.genIf(buf, clause.Else[0].(*posix.IfClause), indent)
+		c.scope = outer
+		return intersect(thenAssigned, elseAssigned)
+	case clause.Else != nil:
+		fmt.Fprintf(buf, "%s} else {\n", tabs)
+		elseAssigned = genBranch(clause.Else)
+	}
+	fmt.Fprintf(buf, "%s}", tabs)
+	return intersect(thenAssigned, elseAssigned)
+}
+
+func isIfClause(stmt posix.Stmt) bool {
+	var _, ok = stmt.(*posix.IfClause)
+	return ok
+}
+
+func intersect(a, b map[string]bool) map[string]bool {
+	var m = make(map[string]bool)
+	for name := range a {
+		if b[name] {
+			m[name] = true
+		}
+	}
+	return m
+}
+
+func (c *converter) pipelineStmt(pipeline *posix.Pipeline) string {
+	var first = pipeline.Cmds[0]
+	if f := c.calledFunc(first); f != nil {
+		if len(pipeline.Cmds) > 1 {
+			panic(newError(pipeline.Pos(), "piping the output of function %s is not supported", f.decl.Name))
+		}
+		return c.funcCall(first, f)
+	}
+
+	if name, ok := first.Words[0].Lit(); ok && len(pipeline.Cmds) == 1 {
+		switch name {
+		case "exit":
+			var code = "0"
+			if len(first.Words) > 1 {
+				var lit, ok = first.Words[1].Lit()
+				if _, err := strconv.Atoi(lit); !ok || err != nil {
+					panic(newError(first.Words[1].Position, "exit code must be a number"))
+				}
+				code = lit
+			}
+			return fmt.Sprintf("exit(%s, \"\")", code)
+		case "return":
+			if c.currFunc == nil {
+				panic(newError(first.Position, "return outside of a function"))
+			}
+			if len(first.Words) > 1 {
+				panic(newError(first.Words[1].Position, "returning an exit status is not supported"))
+			}
+			return "return"
+		case "set":
+			return "// dropped: " + sourceWords(first)
+		}
+	}
+
+	var calls []string
+	for i, cmd := range pipeline.Cmds {
+		if f := c.calledFunc(cmd); f != nil {
+			panic(newError(cmd.Position, "piping into function %s is not supported", f.decl.Name))
+		}
+		calls = append(calls, c.externalCall(cmd, i > 0))
+	}
+	return fmt.Sprintf("print_stream(%s)", strings.Join(calls, " | "))
+}
+
+func sourceWords(cmd *posix.Command) string {
+	var words []string
+	for _, word := range cmd.Words {
+		var lit, _ = word.Lit()
+		words = append(words, lit)
+	}
+	return strings.Join(words, " ")
+}
+
+func (c *converter) funcCall(cmd *posix.Command, f *shellFunc) string {
+	var args []string
+	for _, word := range cmd.Words[1:] {
+		args = append(args, c.valueExpr(word))
+	}
+	if len(args) > f.nargs {
+		panic(newError(cmd.Words[f.nargs+1].Position, "function %s uses %d arguments, got %d", f.decl.Name, f.nargs, len(args)))
+	}
+	for len(args) < f.nargs {
+		args = append(args, `""`)
+	}
+	for _, name := range f.free {
+		if !c.scope.has(name) {
+			panic(newError(cmd.Position, "function %s reads $%s, which is not set here", f.decl.Name, name))
+		}
+		args = append(args, name)
+	}
+	return fmt.Sprintf("%s(%s)", f.wellName, strings.Join(args, ", "))
+}
+
+func (c *converter) condExpr(cond *posix.Pipeline) string {
+	if len(cond.Cmds) != 1 {
+		panic(newError(cond.Pos(), "only [ ] and test conditions are supported"))
+	}
+	var words = cond.Cmds[0].Words
+	switch {
+	case words[0].IsUnquoted("["):
+		if !words[len(words)-1].IsUnquoted("]") {
+			panic(newError(words[0].Position, "missing ]"))
+		}
+		words = words[1 : len(words)-1]
+	case words[0].IsUnquoted("test"):
+		words = words[1:]
+	default:
+		panic(newError(cond.Pos(), "only [ ] and test conditions are supported, the exit status of commands is not"))
+	}
+
+	switch {
+	case len(words) == 2 && words[0].IsUnquoted("-n"):
+		return fmt.Sprintf("%s !~ %s", c.valueExpr(words[1]), wellString(words[1].Position, literalNodes("^$")))
+	case len(words) == 2 && words[0].IsUnquoted("-z"):
+		return fmt.Sprintf("%s ~~ %s", c.valueExpr(words[1]), wellString(words[1].Position, literalNodes("^$")))
+	case len(words) == 3 && (words[1].IsUnquoted("=") || words[1].IsUnquoted("==")):
+		return fmt.Sprintf("%s == %s", c.valueExpr(words[0]), c.valueExpr(words[2]))
+	case len(words) == 3 && words[1].IsUnquoted("!="):
+		var lit, ok = words[2].Lit()
+		if !ok {
+			panic(newError(words[2].Position, "the right side of != must be a literal"))
+		}
+		var pattern = "^" + regexp.QuoteMeta(lit) + "$"
+		return fmt.Sprintf("%s !~ %s", c.valueExpr(words[0]), wellString(words[2].Position, literalNodes(pattern)))
+	case len(words) > 1 && words[0].IsUnquoted("!"):
+		panic(newError(words[0].Position, "negated tests are not supported"))
+	case len(words) == 2 && isUnaryFileTest(words[0]):
+		var op, _ = words[0].Lit()
+		panic(newError(words[0].Position, "the file test %s is not supported, Well has no file tests", op))
+	case len(words) == 3 && isNumericTest(words[1]):
+		var op, _ = words[1].Lit()
+		panic(newError(words[1].Position, "the numeric test %s is not supported, Well has no numeric comparisons", op))
+	default:
+		panic(newError(cond.Pos(), "unsupported test expression"))
+	}
+}
+
+// isUnaryFileTest reports whether word is an operator of test that checks a
+// file, e.g. -f.
+func isUnaryFileTest(word *posix.Word) bool {
+	for _, op := range []string{"-b", "-c", "-d", "-e", "-f", "-g", "-h", "-L", "-p", "-r", "-S", "-s", "-u", "-w", "-x"} {
+		if word.IsUnquoted(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumericTest reports whether word is an operator of test that compares
+// integers, e.g. -eq.
+func isNumericTest(word *posix.Word) bool {
+	for _, op := range []string{"-eq", "-ne", "-lt", "-le", "-gt", "-ge"} {
+		if word.IsUnquoted(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// varName returns the Well name of a shell variable.
+func (c *converter) varName(pos posix.Pos, name string) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		if c.currFunc == nil {
+			panic(newError(pos, "script arguments ($%s) are not supported", name))
+		}
+		return "arg" + name
+	}
+	if !c.environ && !c.scope.has(name) {
+		panic(newError(pos, "$%s is not set by this script, environment variables are not supported", name))
+	}
+	return name
+}
+
+// valueExpr returns a Well expression for a word used as a value, e.g. on
+// the right side of an assignment.
+func (c *converter) valueExpr(word *posix.Word) string {
+	if name, ok := singleParam(word); ok {
+		return c.varName(word.Position, name)
+	}
+	return wellString(word.Position, c.valueNodes(word.Position, word.Parts))
+}
+
+func singleParam(word *posix.Word) (string, bool) {
+	if len(word.Parts) != 1 {
+		return "", false
+	}
+	switch part := word.Parts[0].(type) {
+	case posix.ParamExp:
+		return part.Name, true
+	case posix.DblQuoted:
+		if len(part.Parts) == 1 {
+			if param, ok := part.Parts[0].(posix.ParamExp); ok {
+				return param.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// valueNodes returns the nodes of a string whose rendered value is the value
+// of the given word parts. Quotes have no meaning in values, so they are all
+// escaped.
+func (c *converter) valueNodes(pos posix.Pos, parts []posix.WordPart) []strs_parser.CmdNode {
+	var nodes []strs_parser.CmdNode
+	for _, part := range parts {
+		switch part := part.(type) {
+		case posix.Lit:
+			nodes = append(nodes, literalNodes(part.Value)...)
+		case posix.SglQuoted:
+			nodes = append(nodes, literalNodes(part.Value)...)
+		case posix.AnsiCQuoted:
+			nodes = append(nodes, literalNodes(part.Value)...)
+		case posix.DblQuoted:
+			nodes = append(nodes, c.valueNodes(pos, part.Parts)...)
+		case posix.ParamExp:
+			nodes = append(nodes, strs_parser.Var{Name: c.varName(pos, part.Name)})
+		}
+	}
+	return nodes
+}
+
+var specialChars = "«»‹›$'\""
+
+// literalNodes returns the nodes of a string that renders to s as is.
+func literalNodes(s string) []strs_parser.CmdNode {
+	var nodes []strs_parser.CmdNode
+	var word strings.Builder
+	var space strings.Builder
+	var flushWord = func() {
+		if word.Len() > 0 {
+			nodes = append(nodes, strs_parser.Wrd{Lit: word.String()})
+			word.Reset()
+		}
+	}
+	var flushSpace = func() {
+		if space.Len() > 0 {
+			nodes = append(nodes, strs_parser.Whs{Lit: space.String()})
+			space.Reset()
+		}
+	}
+	for _, ch := range s {
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			flushWord()
+			space.WriteRune(ch)
+		case strings.ContainsRune(specialChars, ch):
+			flushWord()
+			flushSpace()
+			nodes = append(nodes, strs_parser.Wrd{Lit: string(ch)})
+		default:
+			flushSpace()
+			word.WriteRune(ch)
+		}
+	}
+	flushWord()
+	flushSpace()
+	return nodes
+}
+
+func hasSpace(s string) bool {
+	return strings.ContainsAny(s, " \t\n\r")
+}
+
+// hasOperator reports whether s has a character of the |, &&, || or ;
+// operators of a command template.
+func hasOperator(s string) bool {
+	return strings.ContainsAny(s, "|&;")
+}
+
+// wellString returns a Well string literal for the given nodes.
+func wellString(pos posix.Pos, nodes []strs_parser.CmdNode) string {
+	return strconv.Quote(strsSource(pos, nodes))
+}
+
+func strsSource(pos posix.Pos, nodes []strs_parser.CmdNode) string {
+	var src, err = strs_parser.Print(&strs_parser.Root{Items: nodes})
+	if err != nil {
+		panic(newError(pos, "%s", err))
+	}
+	return src
+}
+
+func (c *converter) externalCall(cmd *posix.Command, piped bool) string {
+	var cmdName, ok = cmd.Words[0].Lit()
+	if !ok {
+		panic(newError(cmd.Position, "the command name must be a literal"))
+	}
+	if shellBuiltins[cmdName] {
+		panic(newError(cmd.Position, "the shell builtin %s is not supported", cmdName))
+	}
+
+	var items = c.commandItems(cmd)
+	var params []string
+	var seen = make(map[string]bool)
+	var template = strsSource(cmd.Position, items)
+	walkVars(items, func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			params = append(params, name)
+		}
+	})
+
+	var key = fmt.Sprintf("%v %s", piped, template)
+	var ext, exists = c.byKey[key]
+	if !exists {
+		ext = &external{
+			name:   c.uniqueName(path.Base(cmdName)),
+			piped:  piped,
+			params: params,
+			items:  items,
+		}
+		c.byKey[key] = ext
+		c.externals = append(c.externals, ext)
+	}
+	return fmt.Sprintf("%s(%s)", ext.name, strings.Join(params, ", "))
+}
+
+// commandItems returns the nodes of a command template that runs cmd.
+func (c *converter) commandItems(cmd *posix.Command) []strs_parser.CmdNode {
+	var items []strs_parser.CmdNode
+	for i, word := range cmd.Words {
+		if i > 0 {
+			items = append(items, strs_parser.Whs{Lit: " "})
+		}
+		if isScriptWord(cmd, i) {
+			if script, ok := word.Lit(); ok {
+				if nested, ok := nestedScript(script); ok {
+					items = append(items, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: nested})
+					continue
+				}
+			}
+		}
+		items = append(items, c.templateWord(word)...)
+	}
+	return items
+}
+
+func walkVars(nodes []strs_parser.CmdNode, f func(string)) {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case strs_parser.Var:
+			f(node.Name)
+		case strs_parser.ContainerNode:
+			walkVars(node.Items, f)
+		}
+	}
+}
+
+func (ext *external) String() string {
+	var params []string
+	for _, name := range ext.params {
+		params = append(params, name+" string")
+	}
+	var piped string
+	if ext.piped {
+		piped = "(stdin reader) | "
+	}
+	return fmt.Sprintf("external %s%s(%s) => %s", piped, ext.name, strings.Join(params, ", "), strconv.Quote(strsSource(posix.Pos{}, ext.items)))
+}
+
+// templateWord returns the nodes of a command template that are expanded to
+// exactly one argument, the same one the shell passes for word.
+func (c *converter) templateWord(word *posix.Word) []strs_parser.CmdNode {
+	if lit, ok := word.Lit(); ok && lit == "" {
+		panic(newError(word.Position, "empty arguments are not supported"))
+	}
+
+	if len(word.Parts) == 1 {
+		switch part := word.Parts[0].(type) {
+		case posix.ParamExp:
+			// Unquoted variables are split on whitespace, in both sh and Well
+			return []strs_parser.CmdNode{strs_parser.Var{Name: c.varName(word.Position, part.Name)}}
+		case posix.DblQuoted:
+			if name, ok := singleParam(word); ok {
+				return []strs_parser.CmdNode{strs_parser.Var{Name: c.varName(word.Position, name), Opts: "%q"}}
+			}
+		}
+	}
+
+	// Words with operators are quoted, otherwise guillemets exec would split
+	// the command at them, e.g. at the | of 'a|b'.
+	if lit, ok := word.Lit(); ok && !hasSpace(lit) && !hasOperator(lit) && len(word.Parts) == 1 {
+		return literalNodes(lit)
+	}
+
+	// Everything except unquoted variables goes into containers, so that
+	// adjacent quoted parts, e.g. 'it'"'"'s', become one guillemet string.
+	var nodes []strs_parser.CmdNode
+	var quoted []strs_parser.CmdNode
+	var flush = func() {
+		if len(quoted) > 0 {
+			nodes = append(nodes, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: quoted})
+			quoted = nil
+		}
+	}
+	for _, part := range word.Parts {
+		if param, ok := part.(posix.ParamExp); ok {
+			flush()
+			// Unquoted variables are split on whitespace, in both sh and Well
+			nodes = append(nodes, strs_parser.Var{Name: c.varName(word.Position, param.Name)})
+			continue
+		}
+		quoted = append(quoted, c.valueNodes(word.Position, []posix.WordPart{part})...)
+	}
+	flush()
+	return nodes
+}
+
+func isShellCommand(cmd *posix.Command) bool {
+	var name, ok = cmd.Words[0].Lit()
+	if !ok {
+		return false
+	}
+	switch path.Base(name) {
+	case "sh", "bash", "dash":
+		return true
+	}
+	return false
+}
+
+// sshOptionsWithArg are the options of ssh that are followed by an argument.
+var sshOptionsWithArg = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// isScriptWord reports whether the word at index i of cmd is a script that
+// another shell runs: the argument of sh -c, or the remote command of ssh if
+// it is a single word.
+func isScriptWord(cmd *posix.Command, i int) bool {
+	if isShellCommand(cmd) {
+		return i > 1 && cmd.Words[i-1].IsUnquoted("-c")
+	}
+	var name, ok = cmd.Words[0].Lit()
+	if !ok || path.Base(name) != "ssh" {
+		return false
+	}
+	var host = 1
+	for ; host < len(cmd.Words); host++ {
+		var lit, ok = cmd.Words[host].Lit()
+		if !ok {
+			return false
+		}
+		if lit == "--" {
+			host += 1
+			break
+		}
+		if !strings.HasPrefix(lit, "-") || lit == "-" {
+			break
+		}
+		if len(lit) == 2 && strings.ContainsRune(sshOptionsWithArg, rune(lit[1])) {
+			host += 1
+		}
+	}
+	return i == host+1 && i == len(cmd.Words)-1
+}
+
+var safeWordRe = regexp.MustCompile(`^[A-Za-z0-9_./:=,@%+-]+$`)
+
+// nestedScript returns the nodes of a script passed to sh -c, with its
+// quoted words as nested guillemet strings. It returns false if the rendered
+// script would not be the same script, e.g. because a single-quoted $ would
+// be rendered in double quotes.
+func nestedScript(script string) ([]strs_parser.CmdNode, bool) {
+	var file, err = posix.NewParser().Parse(strings.NewReader(script))
+	if err != nil || len(file.Stmts) != 1 {
+		return nil, false
+	}
+	var pipeline, ok = file.Stmts[0].(*posix.Pipeline)
+	if !ok {
+		return nil, false
+	}
+
+	var items []strs_parser.CmdNode
+	for ci, cmd := range pipeline.Cmds {
+		if ci > 0 {
+			items = append(items, strs_parser.Whs{Lit: " "}, strs_parser.Wrd{Lit: "|"}, strs_parser.Whs{Lit: " "})
+		}
+		for wi, word := range cmd.Words {
+			if wi > 0 {
+				items = append(items, strs_parser.Whs{Lit: " "})
+			}
+			if isScriptWord(cmd, wi) {
+				if inner, ok := word.Lit(); ok {
+					if nested, ok := nestedScript(inner); ok {
+						items = append(items, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: nested})
+						continue
+					}
+				}
+			}
+			items = append(items, nestedWord(word)...)
+		}
+	}
+
+	var root = &strs_parser.Root{Items: items}
+	if _, err := strs_parser.Print(root); err != nil {
+		return nil, false
+	}
+	var rendered, renderErr = expander.EncodeToString(root, nil, expander.Basic)
+	if renderErr != nil || scriptKey(rendered) != scriptKey(script) {
+		return nil, false
+	}
+	return items, true
+}
+
+// nestedWord returns the nodes of a word in a nested script. Variables are
+// not Well variables here, they are expanded by the nested shell.
+func nestedWord(word *posix.Word) []strs_parser.CmdNode {
+	if lit, ok := word.Lit(); ok && safeWordRe.MatchString(lit) {
+		return []strs_parser.CmdNode{strs_parser.Wrd{Lit: lit}}
+	}
+
+	var param = func(name string) []strs_parser.CmdNode {
+		return []strs_parser.CmdNode{strs_parser.Wrd{Lit: "$"}, strs_parser.Wrd{Lit: "{" + name + "}"}}
+	}
+	var quoted func(parts []posix.WordPart) []strs_parser.CmdNode
+	quoted = func(parts []posix.WordPart) []strs_parser.CmdNode {
+		var nodes []strs_parser.CmdNode
+		for _, part := range parts {
+			switch part := part.(type) {
+			case posix.Lit:
+				nodes = append(nodes, literalNodes(part.Value)...)
+			case posix.ParamExp:
+				nodes = append(nodes, param(part.Name)...)
+			}
+		}
+		return nodes
+	}
+
+	var nodes []strs_parser.CmdNode
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case posix.Lit:
+			if safeWordRe.MatchString(part.Value) {
+				nodes = append(nodes, strs_parser.Wrd{Lit: part.Value})
+			} else {
+				nodes = append(nodes, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: literalNodes(part.Value)})
+			}
+		case posix.SglQuoted:
+			nodes = append(nodes, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: literalNodes(part.Value)})
+		case posix.AnsiCQuoted:
+			nodes = append(nodes, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: literalNodes(part.Value)})
+		case posix.DblQuoted:
+			nodes = append(nodes, strs_parser.ContainerNode{Type: strs_scanner.LDOUBLE_GUILLEMET, Items: quoted(part.Parts)})
+		case posix.ParamExp:
+			nodes = append(nodes, param(part.Name)...)
+		}
+	}
+	return nodes
+}
+
+// scriptKey returns a string that is the same for two scripts if and only if
+// they run the same commands with the same arguments.
+func scriptKey(script string) string {
+	var file, err = posix.NewParser().Parse(strings.NewReader(script))
+	if err != nil {
+		return "invalid " + err.Error()
+	}
+	var key strings.Builder
+	for _, stmt := range file.Stmts {
+		var pipeline, ok = stmt.(*posix.Pipeline)
+		if !ok {
+			return fmt.Sprintf("unsupported %T", stmt)
+		}
+		key.WriteString("pipeline")
+		for _, cmd := range pipeline.Cmds {
+			key.WriteString(" | cmd")
+			for wi, word := range cmd.Words {
+				if lit, ok := word.Lit(); ok && isScriptWord(cmd, wi) {
+					fmt.Fprintf(&key, " script(%s)", scriptKey(lit))
+					continue
+				}
+				fmt.Fprintf(&key, " %s", wordKey(word.Parts))
+			}
+		}
+		key.WriteString(";")
+	}
+	return key.String()
+}
+
+func wordKey(parts []posix.WordPart) string {
+	var segments []string
+	var lit strings.Builder
+	var flush = func() {
+		if lit.Len() > 0 {
+			segments = append(segments, fmt.Sprintf("L%q", lit.String()))
+			lit.Reset()
+		}
+	}
+	for _, part := range parts {
+		switch part := part.(type) {
+		case posix.Lit:
+			lit.WriteString(part.Value)
+		case posix.SglQuoted:
+			lit.WriteString(part.Value)
+		case posix.AnsiCQuoted:
+			lit.WriteString(part.Value)
+		case posix.DblQuoted:
+			// Adjacent literals are the same word, e.g. a'b' and "ab"
+			for _, inner := range part.Parts {
+				switch inner := inner.(type) {
+				case posix.Lit:
+					lit.WriteString(inner.Value)
+				case posix.ParamExp:
+					flush()
+					segments = append(segments, "Q$"+inner.Name)
+				}
+			}
+		case posix.ParamExp:
+			flush()
+			segments = append(segments, "U$"+part.Name)
+		}
+	}
+	flush()
+	return strings.Join(segments, "")
+}
+
+func newError(pos posix.Pos, f string, args ...any) posix.Error {
+	return posix.Error{Pos: pos, Msg: fmt.Sprintf(f, args...)}
+}
@@ -0,0 +1,272 @@
+package convert_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/convert"
+	"github.com/siadat/well/interpreter"
+)
+
+var testCases = []struct {
+	src        string
+	want       string
+	wantStdout string
+	wantErr    string
+}{
+	{
+		src: `#!/bin/sh
+# Deploy the app
+set -eu
+
+name="world"
+greeting='it'"'"'s a "nice" day'
+
+# Say hello
+greet() {
+	echo "hello $1" from "$name"
+	echo $greeting | tr a-z A-Z
+}
+
+greet "$name"
+if [ "$name" = world ]; then
+	msg=yes
+elif [ -z "$name" ]; then
+	msg=empty
+else
+	msg=no
+fi
+echo "$msg"
+if [ "$msg" != "n.o" ]; then
+	echo not no
+fi
+sh -c 'echo "a  b" | cat'
+bash -c 'sh -c "echo \"x y\""'
+sh -c 'echo '"'"'$HOME'"'"
+printf '%s\n' "$greeting" '«guillemets» and $dollar'
+`,
+		want: `external echo(arg1 string, name string) => "echo «hello ${arg1}» from ${name:%q}"
+external echo_2(greeting string) => "echo ${greeting}"
+external (stdin reader) | tr() => "tr a-z A-Z"
+external echo_3(msg string) => "echo ${msg:%q}"
+external echo_4() => "echo not no"
+external sh() => "sh -c «echo «a  b» | cat»"
+external bash() => "bash -c «sh -c «echo «x y»»»"
+external sh_2() => "sh -c «echo \\'\\$HOME\\'»"
+external printf(greeting string) => "printf %s\\n ${greeting:%q} «\\«guillemets\\» and \\$dollar»"
+
+// Say hello
+function greet(arg1 string, greeting string, name string) {
+	print_stream(echo(arg1, name))
+	print_stream(echo_2(greeting) | tr())
+}
+
+function (stdin reader) | main() {
+	// Deploy the app
+	// dropped: set -eu
+
+	let name = "world"
+	let greeting = "it\\'s a \\\"nice\\\" day"
+
+	greet(name, greeting, name)
+	if name == "world" {
+		let msg = "yes"
+	} else if name ~~ "^\\$" {
+		let msg = "empty"
+	} else {
+		let msg = "no"
+	}
+	print_stream(echo_3(msg))
+	if msg !~ "^n\\.o\\$" {
+		print_stream(echo_4())
+	}
+	print_stream(sh())
+	print_stream(bash())
+	print_stream(sh_2())
+	print_stream(printf(greeting))
+}
+`,
+		wantStdout: "hello world from world\nIT'S A \"NICE\" DAY\nyes\nnot no\na  b\nx y\n$HOME\nit's a \"nice\" day\n«guillemets» and $dollar\n",
+	},
+	{
+		src:     "echo $HOME",
+		wantErr: "1:6: $HOME is not set by this script, environment variables are not supported",
+	},
+	{
+		src:     "x=1\nif grep -q x file; then echo; fi",
+		wantErr: "2:4: only [ ] and test conditions are supported, the exit status of commands is not",
+	},
+	{
+		src:     "x=1\nx=2",
+		wantErr: "2:1: reassigning x is not supported",
+	},
+	{
+		src:     "f() {\n\techo $1\n}\nf a b",
+		wantErr: "4:5: function f uses 1 arguments, got 2",
+	},
+	{
+		src:     "cd /tmp",
+		wantErr: "1:1: the shell builtin cd is not supported",
+	},
+	{
+		src:     "if [ -f config ]; then echo; fi",
+		wantErr: "1:6: the file test -f is not supported, Well has no file tests",
+	},
+	{
+		src:     "if [ -d dir ]; then echo; fi",
+		wantErr: "1:6: the file test -d is not supported, Well has no file tests",
+	},
+	{
+		src:     "if [ ! -e dir ]; then echo; fi",
+		wantErr: "1:6: negated tests are not supported",
+	},
+	{
+		src:     "x=1\nif [ \"$x\" -gt 0 ]; then echo; fi",
+		wantErr: "2:11: the numeric test -gt is not supported, Well has no numeric comparisons",
+	},
+	{
+		src:     "echo a > out.txt",
+		wantErr: "1:8: redirections are not supported",
+	},
+	{
+		src:     "for x in a b; do echo $x; done",
+		wantErr: "1:1: loops are not supported",
+	},
+	{
+		src:     "x=$(date)",
+		wantErr: "1:3: command substitution is not supported",
+	},
+}
+
+func TestConvert(tt *testing.T) {
+	var bashPath, lookErr = exec.LookPath("bash")
+
+	for ti, tc := range testCases {
+		var converter = convert.NewConverter()
+		var program bytes.Buffer
+		var err = converter.Convert(strings.NewReader(tc.src), &program)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.wantErr, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("convert failed (test case %d)\nsrc:\n%s\nerr:\n%s", ti, tc.src, err)
+		}
+		if diff := cmp.Diff(tc.want, program.String()); diff != "" {
+			tt.Fatalf("mismatching program (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+
+		// The script and the converted program must behave the same
+		var interpStdout bytes.Buffer
+		var interp = interpreter.NewInterpreter(&interpStdout, os.Stderr)
+		var env = interpreter.NewEnvironment()
+		if err := env.Set("MainStdin", &interpreter.PipeStream{ReadCloser: os.Stdin}); err != nil {
+			tt.Fatal(err)
+		}
+		if _, err := interp.Eval(strings.NewReader(program.String()), env); err != nil {
+			tt.Fatalf("eval failed (test case %d)\nprogram:\n%s\nerr:\n%s", ti, program.String(), err)
+		}
+		if diff := cmp.Diff(tc.wantStdout, interpStdout.String()); diff != "" {
+			tt.Fatalf("mismatching interpreter stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+
+		if lookErr != nil {
+			tt.Logf("skipped running the original script: %v", lookErr)
+			continue
+		}
+		var cmd = exec.Command(bashPath, "-c", tc.src)
+		var bashStdout bytes.Buffer
+		cmd.Stdout = &bashStdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			tt.Fatalf("running the original script failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.wantStdout, bashStdout.String()); diff != "" {
+			tt.Fatalf("mismatching bash stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func TestUnquote(tt *testing.T) {
+	var testCases = []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			src:  `sh -c "ssh host \"grep \\\"x y\\\" /var/log\""`,
+			want: `sh -c «ssh host «grep «x y» /var/log»»`,
+		},
+		{
+			src:  `ssh -p 22 -v me@host 'ls -la "/my dir"'`,
+			want: `ssh -p 22 -v me@host «ls -la «/my dir»»`,
+		},
+		{
+			// ssh joins several words with spaces, they are not nested
+			src:  `ssh host ls '/my dir'`,
+			want: `ssh host ls «/my dir»`,
+		},
+		{
+			src:  `printf '%s\n' 'it'\''s $x' "$name" $list $'tab\there' "«g»"`,
+			want: `printf %s\n «it\'s \$x» ${name:%q} ${list} «tab	here» \«g\»`,
+		},
+		{
+			// the nested script is kept as it is, a $ in single quotes
+			// would be expanded in double quotes
+			src:  `sh -c 'echo '"'"'$HOME'"'"`,
+			want: `sh -c «echo \'\$HOME\'»`,
+		},
+		{
+			// guillemets exec splits the command at unquoted operators
+			src:  `echo 'a|b' c\;d 'x&&y' "p || q"`,
+			want: `echo «a|b» «c;d» «x&&y» «p || q»`,
+		},
+		{
+			src:     `echo a | cat`,
+			wantErr: `1:1: expected a single command, pipelines and compound commands are not supported`,
+		},
+		{
+			src:     `echo "a \\"`,
+			wantErr: `1:1: a backslash at the end of a quoted string is not supported`,
+		},
+	}
+
+	var env = map[string]string{"name": "a  b", "list": " c d "}
+	var lookup = func(name string) (string, bool) {
+		var value, ok = env[name]
+		return value, ok
+	}
+	for ti, tc := range testCases {
+		var got, err = convert.Unquote(tc.src)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.wantErr, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("unquote failed (test case %d)\nsrc:\n%s\nerr:\n%s", ti, tc.src, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching template (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+		if err := convert.CheckUnquote(tc.src, got, lookup); err != nil {
+			tt.Fatalf("round trip failed (test case %d): %v", ti, err)
+		}
+	}
+
+	// a template that passes different arguments
+	if err := convert.CheckUnquote(`echo "a b"`, `echo a b`, lookup); err == nil {
+		tt.Fatalf("expected the round trip check to fail")
+	}
+	// a template that runs two commands
+	if err := convert.CheckUnquote(`echo 'a|b'`, `echo a|b`, lookup); err == nil || err.Error() != "the template runs 2 commands, the shell command runs 1" {
+		tt.Fatalf("expected the round trip check to fail for operators, got: %v", err)
+	}
+}
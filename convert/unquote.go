@@ -0,0 +1,172 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/siadat/well/erroring"
+	"github.com/siadat/well/syntax/posix"
+	"github.com/siadat/well/syntax/strs/expander"
+	strs_parser "github.com/siadat/well/syntax/strs/parser"
+)
+
+// Unquote returns a guillemet template that runs the same command as the
+// shell command line src. Quoted words become guillemet strings, scripts
+// passed to sh -c, bash -c or ssh become nested guillemet strings where that
+// produces the same script, and shell variables become template variables.
+func Unquote(src string) (string, error) {
+	var file, err = posix.NewParser().Parse(strings.NewReader(src))
+	if err != nil {
+		return "", err
+	}
+	var c = &converter{environ: true, scope: newScope(nil)}
+	return erroring.CallAndRecover[posix.Error](func() string {
+		var cmd = singleCommand(file)
+		return strsSource(cmd.Position, c.commandItems(cmd))
+	})
+}
+
+// CheckUnquote returns an error if template does not expand to the same
+// arguments as the shell command line src, with the variables of both looked
+// up by lookup. Scripts run by nested shells are quoted differently, so they
+// are compared by the commands they run.
+func CheckUnquote(src string, template string, lookup func(string) (string, bool)) error {
+	var file, err = posix.NewParser().Parse(strings.NewReader(src))
+	if err != nil {
+		return err
+	}
+	var want []string
+	var scripts = make(map[int]bool)
+	_, err = erroring.CallAndRecover[posix.Error](func() struct{} {
+		var cmd = singleCommand(file)
+		for i, word := range cmd.Words {
+			if isScriptWord(cmd, i) {
+				scripts[len(want)] = true
+			}
+			want = append(want, shellFields(word, lookup)...)
+		}
+		return struct{}{}
+	})
+	if err != nil {
+		return err
+	}
+
+	root, err := strs_parser.NewParser().Parse(strings.NewReader(template))
+	if err != nil {
+		return err
+	}
+	// the template is split at its operators, like guillemets exec does
+	seq, err := strs_parser.SplitOperators(root)
+	if err != nil {
+		return err
+	}
+	if len(seq.Pipelines) != 1 || len(seq.Pipelines[0].Commands) != 1 {
+		return fmt.Errorf("the template runs %d commands, the shell command runs 1", countCommands(seq))
+	}
+	got, err := expander.EncodeToCmdArgs(seq.Pipelines[0].Commands[0], func(name string) interface{} {
+		if value, ok := lookup(name); ok {
+			return value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(got) != len(want) {
+		return fmt.Errorf("the template has %d arguments %q, the shell command has %d %q", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if scripts[i] && scriptKey(got[i]) == scriptKey(want[i]) {
+			continue
+		}
+		if got[i] != want[i] {
+			return fmt.Errorf("argument %d of the template is %q, the shell command passes %q", i, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+// countCommands returns the number of commands in seq.
+func countCommands(seq strs_parser.Sequence) int {
+	var n = 0
+	for _, pipeline := range seq.Pipelines {
+		n += len(pipeline.Commands)
+	}
+	return n
+}
+
+// singleCommand returns the only command of file.
+func singleCommand(file *posix.File) *posix.Command {
+	if len(file.Stmts) != 1 {
+		panic(newError(posix.Pos{Line: 1, Column: 1}, "expected a single command, got %d statements", len(file.Stmts)))
+	}
+	var pipeline, ok = file.Stmts[0].(*posix.Pipeline)
+	if !ok || len(pipeline.Cmds) != 1 {
+		panic(newError(file.Stmts[0].Pos(), "expected a single command, pipelines and compound commands are not supported"))
+	}
+	return pipeline.Cmds[0]
+}
+
+// shellFields returns the arguments the shell passes for word. Unquoted
+// variables are split on whitespace, like with the default IFS.
+func shellFields(word *posix.Word, lookup func(string) (string, bool)) []string {
+	var fields []string
+	var field strings.Builder
+	var started = false // quoted empty strings are fields too
+	var commit = func() {
+		if started {
+			fields = append(fields, field.String())
+		}
+		field.Reset()
+		started = false
+	}
+	var value = func(name string) string {
+		var value, ok = lookup(name)
+		if !ok {
+			panic(newError(word.Position, "variable %s is not set", name))
+		}
+		return value
+	}
+
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case posix.Lit:
+			field.WriteString(part.Value)
+		case posix.SglQuoted:
+			field.WriteString(part.Value)
+		case posix.AnsiCQuoted:
+			field.WriteString(part.Value)
+		case posix.DblQuoted:
+			for _, inner := range part.Parts {
+				switch inner := inner.(type) {
+				case posix.Lit:
+					field.WriteString(inner.Value)
+				case posix.ParamExp:
+					field.WriteString(value(inner.Name))
+				}
+			}
+		case posix.ParamExp:
+			var s = value(part.Name)
+			var words = strings.FieldsFunc(s, unicode.IsSpace)
+			if s != "" && unicode.IsSpace(rune(s[0])) {
+				commit()
+			}
+			for i, w := range words {
+				if i > 0 {
+					commit()
+				}
+				field.WriteString(w)
+				started = true
+			}
+			if s != "" && unicode.IsSpace(rune(s[len(s)-1])) {
+				commit()
+			}
+			continue
+		}
+		started = true
+	}
+	commit()
+	return fields
+}
@@ -0,0 +1,293 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siadat/well/interpreter"
+	"github.com/siadat/well/syntax/ast"
+	"github.com/siadat/well/syntax/parser"
+	"github.com/siadat/well/syntax/scanner"
+)
+
+// This package implements the step debugger of "well run
+// --debug-interactive". It is attached to an interpreter as a hook, stops
+// before statements and reads commands until the program is resumed.
+
+const prompt = "(wdb) "
+
+const help = `Commands:
+  s, step          stop at the next statement, stepping into calls
+  n, next          stop at the next statement, stepping over calls
+  o, out           stop at the next statement after the current call returns
+  c, continue      run until a breakpoint
+  b, break LINE    set a breakpoint on a line
+  d, delete LINE   delete the breakpoint on a line
+  breakpoints      list the breakpoints
+  p, print EXPR    evaluate an expression in the current scope
+  env              print the variables of the current scope and its parents
+  bt, stack        print the call stack
+  l, list          print the source around the current line
+  h, help          print this help
+  q, quit          stop the program
+`
+
+type mode int
+
+const (
+	modeStep     mode = iota // stop at the next statement
+	modeNext                 // stop at the next statement in the same call or an outer one
+	modeOut                  // stop at the next statement in an outer call
+	modeContinue             // stop at breakpoints only
+)
+
+type debugger struct {
+	interp      *interpreter.Interpreter
+	lines       []string
+	in          *bufio.Scanner
+	out         io.Writer
+	breakpoints map[int]bool
+	predeclared map[string]bool
+
+	mode  mode
+	depth int // the depth of the stack when the program was resumed
+
+	evaluating bool // true while a print command is evaluating
+	detached   bool // true if there are no more commands to read
+	debug      bool
+}
+
+// NewDebugger returns a debugger for src, which reads commands from in and
+// writes to out.
+func NewDebugger(src []byte, in io.Reader, out io.Writer) *debugger {
+	var predeclared = make(map[string]bool)
+	for _, name := range interpreter.NewEnvironment().Names() {
+		predeclared[name] = true
+	}
+	return &debugger{
+		lines:       strings.Split(string(src), "\n"),
+		in:          bufio.NewScanner(in),
+		out:         out,
+		breakpoints: make(map[int]bool),
+		predeclared: predeclared,
+		mode:        modeStep,
+	}
+}
+
+func (d *debugger) SetDebug(v bool) {
+	d.debug = v
+}
+
+// Attach makes interp stop at the first statement.
+func (d *debugger) Attach(interp *interpreter.Interpreter) {
+	d.interp = interp
+	interp.SetHook(d.hook)
+}
+
+func (d *debugger) hook(node ast.Node, env interpreter.Environment) error {
+	if d.evaluating || d.detached {
+		return nil
+	}
+	switch node.(type) {
+	case *ast.LetDecl, *ast.ExprStmt, *ast.ReturnStmt, *ast.IfStmt:
+	default:
+		return nil
+	}
+
+	var pos = d.interp.Position(node.Pos())
+	var depth = len(d.interp.Stack())
+	var stop = d.breakpoints[pos.Line]
+	switch d.mode {
+	case modeStep:
+		stop = true
+	case modeNext:
+		stop = stop || depth <= d.depth
+	case modeOut:
+		stop = stop || depth < d.depth
+	}
+	if !stop {
+		return nil
+	}
+	return d.stop(pos, env)
+}
+
+// stop reads commands until one of them resumes the program.
+func (d *debugger) stop(pos scanner.Position, env interpreter.Environment) error {
+	var stack = d.interp.Stack()
+	fmt.Fprintf(d.out, "stopped at %s in %s\n", pos, frameName(stack, len(stack)-1))
+	d.printLine(pos.Line, "=>")
+
+	for {
+		fmt.Fprint(d.out, prompt)
+		if !d.in.Scan() {
+			// nothing to read, run the rest of the program
+			d.detached = true
+			fmt.Fprintln(d.out)
+			return nil
+		}
+
+		var cmd, arg = strings.TrimSpace(d.in.Text()), ""
+		if i := strings.IndexAny(cmd, " \t"); i >= 0 {
+			cmd, arg = cmd[:i], strings.TrimSpace(cmd[i:])
+		}
+
+		switch cmd {
+		case "":
+			continue
+		case "s", "step":
+			d.mode = modeStep
+			return nil
+		case "n", "next":
+			d.mode, d.depth = modeNext, len(stack)
+			return nil
+		case "o", "out":
+			d.mode, d.depth = modeOut, len(stack)
+			return nil
+		case "c", "continue":
+			d.mode = modeContinue
+			return nil
+		case "q", "quit":
+			return fmt.Errorf("stopped by the debugger")
+		case "b", "break":
+			if line, ok := d.parseLine(arg); ok {
+				d.breakpoints[line] = true
+				fmt.Fprintf(d.out, "breakpoint on line %d\n", line)
+			}
+		case "d", "delete":
+			if line, ok := d.parseLine(arg); ok {
+				delete(d.breakpoints, line)
+			}
+		case "breakpoints":
+			var lines []int
+			for line := range d.breakpoints {
+				lines = append(lines, line)
+			}
+			sort.Ints(lines)
+			for _, line := range lines {
+				d.printLine(line, "*")
+			}
+		case "p", "print":
+			d.print(arg, env)
+		case "env":
+			d.printEnv(env)
+		case "bt", "stack":
+			d.printStack(pos, stack)
+		case "l", "list":
+			for line := pos.Line - 3; line <= pos.Line+3; line++ {
+				var marker = ""
+				if line == pos.Line {
+					marker = "=>"
+				} else if d.breakpoints[line] {
+					marker = "*"
+				}
+				d.printLine(line, marker)
+			}
+		case "h", "help":
+			fmt.Fprint(d.out, help)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, see help\n", cmd)
+		}
+	}
+}
+
+func (d *debugger) parseLine(arg string) (int, bool) {
+	var line, err = strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(d.lines) {
+		fmt.Fprintf(d.out, "invalid line %q\n", arg)
+		return 0, false
+	}
+	return line, true
+}
+
+func (d *debugger) printLine(line int, marker string) {
+	if line < 1 || line > len(d.lines) {
+		return
+	}
+	fmt.Fprintf(d.out, "%2s %4d  %s\n", marker, line, d.lines[line-1])
+}
+
+func (d *debugger) print(src string, env interpreter.Environment) {
+	if src == "" {
+		fmt.Fprintln(d.out, "usage: print EXPR")
+		return
+	}
+	var p = parser.NewParser()
+	var expr, err = p.ParseExpr(strings.NewReader(src))
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+	obj, err := d.interp.EvalNode(p, expr, env)
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+	fmt.Fprintln(d.out, format(obj))
+}
+
+// printEnv prints the names defined in each scope of the chain, starting
+// from the innermost scope. Scopes start with a copy of their parent, so the
+// names that are the same as in the parent are skipped.
+func (d *debugger) printEnv(env interpreter.Environment) {
+	for depth := 0; env != nil; depth++ {
+		var parent = env.Parent()
+		var name = "local"
+		if parent == nil {
+			name = "global"
+		}
+		fmt.Fprintf(d.out, "scope %d (%s):\n", depth, name)
+		for _, name := range env.Names() {
+			var obj, _ = env.Get(name)
+			if parent != nil {
+				if parentObj, err := parent.Get(name); err == nil && parentObj == obj {
+					continue
+				}
+			} else if d.predeclared[name] {
+				continue
+			}
+			fmt.Fprintf(d.out, "  %s = %s\n", name, format(obj))
+		}
+		env = parent
+	}
+}
+
+// printStack prints the innermost call first. The position of each outer
+// call is where it called the next one.
+func (d *debugger) printStack(pos scanner.Position, stack []interpreter.Frame) {
+	for i := len(stack) - 1; i >= -1; i-- {
+		fmt.Fprintf(d.out, "#%d %s at %s\n", len(stack)-1-i, frameName(stack, i), pos)
+		if i < 0 || stack[i].Call.Pos() == interpreter.NoPos {
+			// main is called by the interpreter
+			break
+		}
+		pos = d.interp.Position(stack[i].Call.Pos())
+	}
+}
+
+func frameName(stack []interpreter.Frame, i int) string {
+	if i < 0 {
+		return "<top level>"
+	}
+	return stack[i].Function.Name
+}
+
+// format returns strings quoted, so that they are not mistaken for numbers.
+func format(obj interpreter.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nothing>"
+	case *interpreter.String:
+		return fmt.Sprintf("%q", obj.String())
+	case *interpreter.PipeStream:
+		return "stream"
+	default:
+		return obj.String()
+	}
+}
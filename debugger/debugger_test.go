@@ -0,0 +1,87 @@
+package debugger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/debugger"
+	"github.com/siadat/well/interpreter"
+)
+
+const src = `let greeting = "hello"
+
+function greet(name string) string {
+  let msg = "${greeting} ${name}"
+  return msg
+}
+
+function (stdin reader) | main() {
+  let a = greet("x")
+  println(a)
+}
+`
+
+func TestDebugger(tt *testing.T) {
+	var testCases = []struct {
+		commands string
+		want     string
+	}{
+		{
+			commands: "b 5\nc\nbt\nenv\np msg\nn\nn\nc\n",
+			want: "stopped at test.well:1:1 in <top level>\n" +
+				"=>    1  let greeting = \"hello\"\n" +
+				"(wdb) breakpoint on line 5\n" +
+				"(wdb) stopped at test.well:5:3 in greet\n" +
+				"=>    5    return msg\n" +
+				"(wdb) #0 greet at test.well:5:3\n" +
+				"#1 main at test.well:9:11\n" +
+				"(wdb) scope 0 (local):\n" +
+				"  msg = \"hello x\"\n" +
+				"  name = \"x\"\n" +
+				"scope 1 (global):\n" +
+				"  MainStdin = stream\n" +
+				"  greet = function greet\n" +
+				"  greeting = \"hello\"\n" +
+				"  main = function main\n" +
+				"(wdb) \"hello x\"\n" +
+				"(wdb) stopped at test.well:10:3 in main\n" +
+				"=>   10    println(a)\n" +
+				"(wdb) ",
+		},
+		{
+			commands: "s\ns\no\n",
+			want: "stopped at test.well:1:1 in <top level>\n" +
+				"=>    1  let greeting = \"hello\"\n" +
+				"(wdb) stopped at test.well:9:3 in main\n" +
+				"=>    9    let a = greet(\"x\")\n" +
+				"(wdb) stopped at test.well:4:3 in greet\n" +
+				"=>    4    let msg = \"${greeting} ${name}\"\n" +
+				"(wdb) stopped at test.well:10:3 in main\n" +
+				"=>   10    println(a)\n" +
+				"(wdb) \n",
+		},
+	}
+
+	for i, tc := range testCases {
+		var stdout, out bytes.Buffer
+		var interp = interpreter.NewInterpreter(&stdout, &stdout)
+		var d = debugger.NewDebugger([]byte(src), strings.NewReader(tc.commands), &out)
+		d.Attach(interp)
+
+		var env = interpreter.NewEnvironment()
+		if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+			tt.Fatal(err)
+		}
+		if _, err := interp.EvalFile("test.well", strings.NewReader(src), env); err != nil {
+			tt.Fatalf("test case %d failed: %s", i, err)
+		}
+		if diff := cmp.Diff("hello x\n", stdout.String()); diff != "" {
+			tt.Fatalf("mismatching stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+		if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+	}
+}
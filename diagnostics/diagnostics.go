@@ -0,0 +1,141 @@
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/siadat/well/syntax/scanner"
+)
+
+// This package describes problems found in Well files in a structured way,
+// so that they can be rendered for humans, or consumed by tools, e.g. CI and
+// code scanning. Errors returned by the parser, the type checker and the
+// interpreter implement Error.
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Codes identify the kind of a diagnostic, e.g. as SARIF rule ids.
+const (
+	CodeSyntax  = "syntax-error"
+	CodeType    = "type-error"
+	CodeRuntime = "runtime-error"
+	CodeOther   = "error"
+)
+
+// Position is 1-based, columns count runes. It is zero if unknown.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Call is a call of a Well function that was active when a runtime error
+// happened.
+type Call struct {
+	Function string   `json:"function"`
+	Caller   string   `json:"caller,omitempty"` // empty if called at the top level
+	Position Position `json:"position"`         // the position of the call
+}
+
+// Traceback returns e.g. "called from deploy.well:40 in main".
+func (c Call) Traceback(file string) string {
+	var location = "an unknown position"
+	if c.Position.Line > 0 && file != "" {
+		location = fmt.Sprintf("%s:%d", file, c.Position.Line)
+	} else if c.Position.Line > 0 {
+		location = fmt.Sprintf("line %d", c.Position.Line)
+	}
+	if c.Caller == "" {
+		return fmt.Sprintf("called from %s at the top level", location)
+	}
+	return fmt.Sprintf("called from %s in %s", location, c.Caller)
+}
+
+// Related is another location in the same file that explains a diagnostic,
+// e.g. where an unclosed quote is opened.
+type Related struct {
+	Range   *Range `json:"range"`
+	Message string `json:"message"`
+
+	Pos scanner.Pos `json:"-"`
+	End scanner.Pos `json:"-"`
+}
+
+type Diagnostic struct {
+	File     string    `json:"file,omitempty"`
+	Range    *Range    `json:"range,omitempty"` // nil if the position is unknown
+	Severity Severity  `json:"severity"`
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Related  []Related `json:"related,omitempty"`
+	Stack    []Call    `json:"stack,omitempty"` // the active calls, innermost first
+
+	// Pos and End are the rune offsets of Range, they are used to mark the
+	// source when rendering for humans.
+	Pos scanner.Pos `json:"-"`
+	End scanner.Pos `json:"-"`
+}
+
+// New returns an error diagnostic for the source between the offsets pos and
+// end, whose 1-based range is computed with lineCol, a function that returns
+// the 0-based line and column of an offset, e.g. Parser.GetLineColAt.
+func New(code string, pos, end scanner.Pos, lineCol func(scanner.Pos) (int, int), msg string) Diagnostic {
+	var startLine, startColumn = lineCol(pos)
+	var endLine, endColumn = lineCol(end)
+	return Diagnostic{
+		Range: &Range{
+			Start: Position{Line: startLine + 1, Column: startColumn + 1},
+			End:   Position{Line: endLine + 1, Column: endColumn + 1},
+		},
+		Severity: SeverityError,
+		Code:     code,
+		Message:  msg,
+		Pos:      pos,
+		End:      end,
+	}
+}
+
+// NewRelated returns a related location for the source between pos and end,
+// like New.
+func NewRelated(pos, end scanner.Pos, lineCol func(scanner.Pos) (int, int), msg string) Related {
+	var startLine, startColumn = lineCol(pos)
+	var endLine, endColumn = lineCol(end)
+	return Related{
+		Range: &Range{
+			Start: Position{Line: startLine + 1, Column: startColumn + 1},
+			End:   Position{Line: endLine + 1, Column: endColumn + 1},
+		},
+		Message: msg,
+		Pos:     pos,
+		End:     end,
+	}
+}
+
+// Error is implemented by errors that carry diagnostics.
+type Error interface {
+	error
+	Diagnostics() []Diagnostic
+}
+
+// FromError returns the diagnostics of err. Errors that do not carry
+// diagnostics become a single diagnostic without a range.
+func FromError(err error) []Diagnostic {
+	var diagErr Error
+	if errors.As(err, &diagErr) {
+		return diagErr.Diagnostics()
+	}
+	return []Diagnostic{{
+		Severity: SeverityError,
+		Code:     CodeOther,
+		Message:  err.Error(),
+	}}
+}
@@ -0,0 +1,175 @@
+package diagnostics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/diagnostics"
+	"github.com/siadat/well/syntax/parser"
+)
+
+const src = "let a = 1\nlet b = )\nlet c = 2\nlet d = \n"
+
+func parseDiagnostics(tt *testing.T) []diagnostics.Diagnostic {
+	var _, err = parser.NewParser().Parse(strings.NewReader(src))
+	if err == nil {
+		tt.Fatal("expected an error")
+	}
+	var diags = diagnostics.FromError(err)
+	for i := range diags {
+		diags[i].File = "test.well"
+	}
+	return diags
+}
+
+func TestFromError(tt *testing.T) {
+	var got = parseDiagnostics(tt)
+	var want = []diagnostics.Diagnostic{
+		{
+			File:     "test.well",
+			Range:    &diagnostics.Range{Start: diagnostics.Position{Line: 2, Column: 9}, End: diagnostics.Position{Line: 2, Column: 10}},
+			Severity: diagnostics.SeverityError,
+			Code:     diagnostics.CodeSyntax,
+			Message:  `failed to parse primary expression, got RPAREN(")") at 18`,
+			Pos:      18,
+			End:      19,
+		},
+		{
+			File:     "test.well",
+			Range:    &diagnostics.Range{Start: diagnostics.Position{Line: 4, Column: 9}, End: diagnostics.Position{Line: 5, Column: 1}},
+			Severity: diagnostics.SeverityError,
+			Code:     diagnostics.CodeSyntax,
+			Message:  `failed to parse primary expression, got NEWLINE("\n") at 38`,
+			Pos:      38,
+			End:      39,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		tt.Fatalf("mismatching diagnostics\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var other = diagnostics.FromError(errors.New("boom"))
+	if diff := cmp.Diff([]diagnostics.Diagnostic{{Severity: diagnostics.SeverityError, Code: diagnostics.CodeOther, Message: "boom"}}, other); diff != "" {
+		tt.Fatalf("mismatching diagnostics\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestRender(tt *testing.T) {
+	var diags = parseDiagnostics(tt)
+
+	var human bytes.Buffer
+	if err := diagnostics.WriteHuman(&human, []byte(src), diags[:1]); err != nil {
+		tt.Fatal(err)
+	}
+	var wantHuman = "test.well:2:9:\n" +
+		"let b = )\n" +
+		"        ⌃\n" +
+		"        │\n" +
+		"        ╰─── at line 2 column 9: failed to parse primary expression, got RPAREN(\")\") at 18\n"
+	if diff := cmp.Diff(wantHuman, human.String()); diff != "" {
+		tt.Fatalf("mismatching human output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var jsonLines bytes.Buffer
+	if err := diagnostics.WriteJSON(&jsonLines, diags); err != nil {
+		tt.Fatal(err)
+	}
+	var wantJSON = `{"file":"test.well","range":{"start":{"line":2,"column":9},"end":{"line":2,"column":10}},"severity":"error","code":"syntax-error","message":"failed to parse primary expression, got RPAREN(\")\") at 18"}` + "\n" +
+		`{"file":"test.well","range":{"start":{"line":4,"column":9},"end":{"line":5,"column":1}},"severity":"error","code":"syntax-error","message":"failed to parse primary expression, got NEWLINE(\"\\n\") at 38"}` + "\n"
+	if diff := cmp.Diff(wantJSON, jsonLines.String()); diff != "" {
+		tt.Fatalf("mismatching json output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var sarif bytes.Buffer
+	if err := diagnostics.WriteSARIF(&sarif, diags[:1]); err != nil {
+		tt.Fatal(err)
+	}
+	var got any
+	if err := json.Unmarshal(sarif.Bytes(), &got); err != nil {
+		tt.Fatal(err)
+	}
+	var want any
+	var wantSARIF = `{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": [{
+			"tool": {"driver": {"name": "well", "rules": [{"id": "syntax-error"}]}},
+			"columnKind": "unicodeCodePoints",
+			"results": [{
+				"ruleId": "syntax-error",
+				"level": "error",
+				"message": {"text": "failed to parse primary expression, got RPAREN(\")\") at 18"},
+				"locations": [{
+					"physicalLocation": {
+						"artifactLocation": {"uri": "test.well"},
+						"region": {"startLine": 2, "startColumn": 9, "endLine": 2, "endColumn": 10}
+					}
+				}]
+			}]
+		}]
+	}`
+	if err := json.Unmarshal([]byte(wantSARIF), &want); err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		tt.Fatalf("mismatching sarif output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestRelated(tt *testing.T) {
+	var src = "let x = \"echo «a\"\n"
+	var _, err = parser.NewParser().Parse(strings.NewReader(src))
+	if err == nil {
+		tt.Fatal("expected an error")
+	}
+	var diags = diagnostics.FromError(err)
+	var want = []diagnostics.Related{{
+		Range:   &diagnostics.Range{Start: diagnostics.Position{Line: 1, Column: 15}, End: diagnostics.Position{Line: 1, Column: 16}},
+		Message: "« is opened here",
+		Pos:     14,
+		End:     15,
+	}}
+	if len(diags) != 1 {
+		tt.Fatalf("expected 1 diagnostic, got %+v", diags)
+	}
+	if diff := cmp.Diff(want, diags[0].Related); diff != "" {
+		tt.Fatalf("mismatching related locations\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var human bytes.Buffer
+	if err := diagnostics.WriteHuman(&human, []byte(src), diags); err != nil {
+		tt.Fatal(err)
+	}
+	var wantHuman = "let x = \"echo «a\"\n" +
+		"                ⌃\n" +
+		"                │\n" +
+		"                ╰─── at line 1 column 17: unclosed «\n" +
+		"let x = \"echo «a\"\n" +
+		"              ⌃\n" +
+		"              │\n" +
+		"              ╰─── at line 1 column 15: « is opened here\n"
+	if diff := cmp.Diff(wantHuman, human.String()); diff != "" {
+		tt.Fatalf("mismatching human output\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var jsonLines bytes.Buffer
+	if err := diagnostics.WriteJSON(&jsonLines, diags); err != nil {
+		tt.Fatal(err)
+	}
+	if !strings.Contains(jsonLines.String(), `"related":[{"range":{"start":{"line":1,"column":15},"end":{"line":1,"column":16}},"message":"« is opened here"}]`) {
+		tt.Fatalf("expected the related location in the json output, got: %s", jsonLines.String())
+	}
+
+	diags[0].File = "test.well"
+	var sarif bytes.Buffer
+	if err := diagnostics.WriteSARIF(&sarif, diags); err != nil {
+		tt.Fatal(err)
+	}
+	if !strings.Contains(sarif.String(), `"relatedLocations"`) || !strings.Contains(sarif.String(), `"text": "« is opened here"`) {
+		tt.Fatalf("expected the related location in the sarif output, got: %s", sarif.String())
+	}
+}
@@ -0,0 +1,182 @@
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/siadat/well/syntax/scanner"
+)
+
+// WriteHuman writes the diagnostics with the source line and an arrow
+// pointing at the position, the same way errors are printed. The span of the
+// diagnostic is underlined, and followed by its related locations. The
+// source may be nil, in which case only the positions are printed.
+func WriteHuman(w io.Writer, src []byte, diags []Diagnostic) error {
+	var s *scanner.Scanner
+	if src != nil {
+		s = scanner.NewScanner(bytes.NewReader(src))
+	}
+	for _, d := range diags {
+		var text string
+		switch {
+		case d.Range == nil:
+			text = d.Message
+		case s != nil:
+			text = strings.Join(s.MarkSpan(d.Pos, d.End, d.Message, false), "\n")
+		default:
+			text = fmt.Sprintf("at line %d column %d: %s", d.Range.Start.Line, d.Range.Start.Column, d.Message)
+		}
+		for _, related := range d.Related {
+			if s != nil {
+				text += "\n" + strings.Join(s.MarkSpan(related.Pos, related.End, related.Message, false), "\n")
+			} else {
+				text += fmt.Sprintf("\nat line %d column %d: %s", related.Range.Start.Line, related.Range.Start.Column, related.Message)
+			}
+		}
+		for _, call := range d.Stack {
+			text += "\n" + call.Traceback(d.File)
+		}
+		if d.File != "" && d.Range != nil {
+			text = fmt.Sprintf("%s:%d:%d:\n%s", d.File, d.Range.Start.Line, d.Range.Start.Column, text)
+		} else if d.File != "" {
+			text = d.File + ":\n" + text
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes one JSON object per line for each diagnostic.
+func WriteJSON(w io.Writer, diags []Diagnostic) error {
+	var enc = json.NewEncoder(w)
+	for _, d := range diags {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SARIF 2.1.0, the format of GitHub code scanning.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"` // only in relatedLocations
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// newSarifLocation returns the location of r in file.
+func newSarifLocation(file string, r *Range) sarifLocation {
+	var location = sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: file},
+	}}
+	if r != nil {
+		var region = &sarifRegion{StartLine: r.Start.Line, StartColumn: r.Start.Column}
+		if r.End != r.Start {
+			region.EndLine, region.EndColumn = r.End.Line, r.End.Column
+		}
+		location.PhysicalLocation.Region = region
+	}
+	return location
+}
+
+// WriteSARIF writes the diagnostics as a SARIF log with a single run.
+func WriteSARIF(w io.Writer, diags []Diagnostic) error {
+	var run = sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: "well", Rules: []sarifRule{}}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+
+	var rules = make(map[string]bool)
+	for _, d := range diags {
+		if !rules[d.Code] {
+			rules[d.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: d.Code})
+		}
+
+		var result = sarifResult{
+			RuleID:  d.Code,
+			Level:   string(d.Severity),
+			Message: sarifMessage{Text: d.Message},
+		}
+		if d.File != "" {
+			result.Locations = []sarifLocation{newSarifLocation(d.File, d.Range)}
+			for i, related := range d.Related {
+				var id = i
+				var location = newSarifLocation(d.File, related.Range)
+				location.ID = &id
+				location.Message = &sarifMessage{Text: related.Message}
+				result.RelatedLocations = append(result.RelatedLocations, location)
+			}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
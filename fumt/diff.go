@@ -0,0 +1,185 @@
+package fumt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines printed around each change,
+// same as diff -u.
+const contextLines = 3
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+type edit struct {
+	kind editKind
+	line string
+}
+
+// Diff returns the unified diff of old and new, or nil if they are equal.
+func Diff(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+
+	var edits = diffLines(splitLines(old), splitLines(new))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n", oldName)
+	fmt.Fprintf(&buf, "+++ %s\n", newName)
+
+	// oldLine and newLine are the 0-based line numbers of edits[i]
+	var oldLine, newLine = 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// a hunk starts with the context before the first change and ends
+		// when there are more than 2*contextLines equal lines in a row
+		var start = i
+		for start > 0 && i-start < contextLines && edits[start-1].kind == editEqual {
+			start--
+		}
+		var end = i
+		for end < len(edits) {
+			if edits[end].kind != editEqual {
+				end++
+				continue
+			}
+			var equal = 0
+			for end+equal < len(edits) && edits[end+equal].kind == editEqual {
+				equal++
+			}
+			if end+equal == len(edits) || equal > 2*contextLines {
+				if equal > contextLines {
+					equal = contextLines
+				}
+				end += equal
+				break
+			}
+			end += equal
+		}
+
+		var hunkOld, hunkNew = oldLine - (i - start), newLine - (i - start)
+		var oldCount, newCount int
+		var body strings.Builder
+		for _, e := range edits[start:end] {
+			switch e.kind {
+			case editEqual:
+				oldCount++
+				newCount++
+				writeDiffLine(&body, " ", e.line)
+			case editDelete:
+				oldCount++
+				writeDiffLine(&body, "-", e.line)
+			case editInsert:
+				newCount++
+				writeDiffLine(&body, "+", e.line)
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		buf.WriteString(body.String())
+
+		for _, e := range edits[i:end] {
+			if e.kind != editInsert {
+				oldLine++
+			}
+			if e.kind != editDelete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+func writeDiffLine(buf *strings.Builder, prefix, line string) {
+	buf.WriteString(prefix)
+	buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		buf.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange formats the 0-based start and the length of a hunk the way
+// diff -u does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits b after each newline.
+func splitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		var i = bytes.IndexByte(b, '\n')
+		if i < 0 {
+			lines = append(lines, string(b))
+			break
+		}
+		lines = append(lines, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns the edits that turn a into b, using the longest common
+// subsequence of their lines. Source files are small enough for the
+// quadratic table.
+func diffLines(a, b []string) []edit {
+	var lcs = make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	var i, j = 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{editEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{editDelete, a[i]})
+			i++
+		default:
+			edits = append(edits, edit{editInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{editDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{editInsert, b[j]})
+	}
+	return edits
+}
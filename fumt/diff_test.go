@@ -0,0 +1,75 @@
+package fumt_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/fumt"
+)
+
+func TestDiff(tt *testing.T) {
+	var testCases = []struct {
+		old  string
+		new  string
+		want string
+	}{
+		{
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			old: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			new: "1\n2\nX\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\nnew",
+			want: `--- a.well
++++ b.well
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++X
+ 4
+ 5
+ 6
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++new
+\ No newline at end of file
+`,
+		},
+		{
+			old: "1\n2\n3\n4\n5\n6\n7\n",
+			new: "2\n3\n4\n5\n6\n7\n8\n",
+			want: `--- a.well
++++ b.well
+@@ -1,7 +1,7 @@
+-1
+ 2
+ 3
+ 4
+ 5
+ 6
+ 7
++8
+`,
+		},
+		{
+			old: "",
+			new: "a\n",
+			want: `--- a.well
++++ b.well
+@@ -0,0 +1 @@
++a
+`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		var got = string(fumt.Diff("a.well", "b.well", []byte(tc.old), []byte(tc.new)))
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ngot:\n%s\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, got, diff)
+		}
+	}
+}
@@ -4,21 +4,30 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/siadat/well/erroring"
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/parser"
 	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/syntax/token"
 )
 
-// This is an experimental formater. It does not support comments yet. It will
-// proabbly be re-written using a different approach. Ideas are welcome. :)
+// This formater prints every node of the syntax tree in a canonical form.
+// Comments are not part of the tree, they are printed before the first node
+// that comes after them, or at the end of the previous line if they were
+// written after code on the same line. Intentional blank lines (at most one)
+// between statements are kept. The output of the formater does not change
+// when it is formatted again.
 
 type formater struct {
 	indentLevel int
 	parser      *parser.Parser
 	debug       bool
+
+	src      []rune
+	comments []*ast.Comment
 }
 
 func NewFormater() *formater {
@@ -30,47 +39,107 @@ func (ft *formater) SetDebug(v bool) {
 }
 
 func (ft *formater) Format(src io.Reader, out io.Writer) error {
+	var byts, readErr = io.ReadAll(src)
+	if readErr != nil {
+		return readErr
+	}
+	ft.src = []rune(string(byts))
+
 	ft.parser = parser.NewParser()
 	ft.parser.SetDebug(ft.debug)
-	ft.parser.SetIncludeComments(false) // TODO: include and preserve comments
-	var node, parseErr = ft.parser.Parse(src)
+	ft.parser.SetIncludeComments(true)
+	var node, parseErr = ft.parser.Parse(bytes.NewReader(byts))
 	if parseErr != nil {
 		return parseErr
 	}
+	ft.comments = node.Comments
 
-	var _, err = erroring.CallAndRecover[Error](func() struct{} {
-		fmt.Fprint(out, ft.FormatNode(node))
-		return struct{}{}
+	var formatted, err = erroring.CallAndRecover[Error](func() string {
+		return ft.FormatNode(node)
 	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, formatted)
 	return err
 }
 
+var operators = map[token.Token]string{
+	token.PIPE: "|",
+	token.ADD:  "+",
+	token.SUB:  "-",
+	token.MUL:  "*",
+	token.QUO:  "/",
+	token.REM:  "%",
+	token.NOT:  "!",
+	token.EQL:  "==",
+	token.NEQ:  "!=",
+	token.REG:  "~~",
+	token.NREG: "!~",
+	token.LSS:  "<",
+	token.GTR:  ">",
+	token.LEQ:  "<=",
+	token.GEQ:  ">=",
+}
+
 func (ft *formater) FormatNode(node ast.Node) string {
 	switch node := node.(type) {
 	case *ast.Root:
-		var buf bytes.Buffer
+		var l = ft.newLines()
 		for _, decl := range node.Decls {
-			fmt.Fprint(&buf, ft.FormatNode(decl))
+			l.flushComments(decl.Pos())
+			var blank = ft.blankLineBefore(decl.Pos())
+			if isFuncBody(decl) && !l.afterComment {
+				blank = true
+			}
+			l.write(ft.FormatNode(decl), blank)
+			l.afterFunc = isFuncBody(decl)
 		}
-		return buf.String()
+		l.flushComments(scanner.Pos(len(ft.src)))
+		return l.buf.String()
 	case *ast.BlockStmt:
-		var buf bytes.Buffer
 		ft.indentLevel += 1
+		var l = ft.newLines()
+		l.buf.WriteString("{\n")
 		for _, stmt := range node.Statements {
-			fmt.Fprint(&buf, ft.FormatNode(stmt))
+			l.flushComments(stmt.Pos())
+			l.write(ft.FormatNode(stmt), ft.blankLineBefore(stmt.Pos()))
 		}
+		l.flushComments(node.Rbrace)
 		ft.indentLevel -= 1
-		return ft.indent() + "{\n" +
-			buf.String() +
-			ft.indent() + "}\n"
+		l.buf.WriteString(ft.indent() + "}")
+		return l.buf.String()
 	case *ast.FuncDecl:
-		return ft.indent() + fmt.Sprintf("function %s%s %s\n", node.Name.Name, ft.FormatNode(node.Signature), ft.FormatNode(node.Body))
+		if node.IsExternal {
+			return ft.indent() + fmt.Sprintf("external %s%s%s => %s\n", ft.formatPipedArgs(node.Signature), node.Name.Name, ft.formatArgs(node.Signature.Args), ft.FormatNode(node.Template()))
+		}
+		return ft.indent() + fmt.Sprintf("function %s%s%s %s\n", ft.formatPipedArgs(node.Signature), node.Name.Name, ft.FormatNode(node.Signature), ft.FormatNode(node.Body))
 	case *ast.LetDecl:
 		return ft.indent() + fmt.Sprintf("let %s = %s\n", node.Name.Name, ft.FormatNode(node.Rhs))
+	case *ast.RequiresDecl:
+		return ft.indent() + fmt.Sprintf("requires %s %s\n", node.Kind, node.Lit)
 	case *ast.ExprStmt:
 		return ft.indent() + fmt.Sprintf("%s\n", ft.FormatNode(node.X))
+	case *ast.IfStmt:
+		return ft.indent() + ft.formatIf(node) + "\n"
 	case *ast.CallExpr:
-		return fmt.Sprintf("%s%s", ft.FormatNode(node.Fun), ft.FormatNode(node.Arg))
+		var call = fmt.Sprintf("%s%s", ft.FormatNode(node.Fun), ft.FormatNode(node.Arg))
+		if node.PipedArg != nil && len(node.PipedArg.Exprs) > 0 {
+			var piped []string
+			for _, expr := range node.PipedArg.Exprs {
+				piped = append(piped, ft.FormatNode(expr))
+			}
+			return fmt.Sprintf("%s | %s", strings.Join(piped, ", "), call)
+		}
+		return call
+	case *ast.BinaryExpr:
+		return fmt.Sprintf("%s %s %s", ft.FormatNode(node.X), ft.operator(node.Pos(), node.Op), ft.FormatNode(node.Y))
+	case *ast.UnaryExpr:
+		return fmt.Sprintf("%s%s", ft.operator(node.Pos(), node.Op), ft.FormatNode(node.X))
+	case *ast.IndexExpr:
+		return fmt.Sprintf("%s[%s]", ft.FormatNode(node.X), ft.FormatNode(node.Index))
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s", ft.FormatNode(node.X), node.Sel.Name)
 	case *ast.Ident:
 		return node.Name
 	case *ast.String:
@@ -78,15 +147,13 @@ func (ft *formater) FormatNode(node ast.Node) string {
 	case *ast.Integer:
 		return fmt.Sprintf("%d", node.Value)
 	case *ast.Float:
-		return fmt.Sprintf("%v", node.Value)
+		var s = strconv.FormatFloat(node.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0" // otherwise it would become an integer
+		}
+		return s
 	case *ast.FuncSignature:
-		var arguments = func() string {
-			var args []string
-			for _, arg := range node.Args {
-				args = append(args, fmt.Sprintf("%s %s", arg.Name, arg.Type))
-			}
-			return strings.Join(args, ", ")
-		}()
+		var arguments = ft.formatArgs(node.Args)
 
 		var returns = func() string {
 			var rets []string
@@ -98,14 +165,14 @@ func (ft *formater) FormatNode(node ast.Node) string {
 			} else if len(rets) == 1 {
 				return rets[0]
 			} else {
-				return strings.Join(rets, ", ")
+				return "(" + strings.Join(rets, ", ") + ")"
 			}
 		}()
 
 		if returns == "" {
-			return fmt.Sprintf("(%s)", arguments)
+			return arguments
 		} else {
-			return fmt.Sprintf("(%s) %s", arguments, returns)
+			return fmt.Sprintf("%s %s", arguments, returns)
 		}
 	case *ast.ReturnStmt:
 		if node.Expr == nil {
@@ -113,27 +180,127 @@ func (ft *formater) FormatNode(node ast.Node) string {
 		}
 		return ft.indent() + fmt.Sprintf("return %s\n", ft.FormatNode(node.Expr))
 	case *ast.ParenExpr:
-		var perline = false
-		if perline {
-			var buf bytes.Buffer
-			ft.indentLevel += 1
-			for _, expr := range node.Exprs {
-				fmt.Fprintf(&buf, "%s%s,\n", ft.indent(), ft.FormatNode(expr))
-			}
-			ft.indentLevel -= 1
-			return "(\n" +
-				buf.String() +
-				ft.indent() + ")\n"
-		} else {
-			var exprs []string
-			for _, expr := range node.Exprs {
-				exprs = append(exprs, ft.FormatNode(expr))
-			}
-			return "(" + strings.Join(exprs, ", ") + ")"
+		var exprs []string
+		for _, expr := range node.Exprs {
+			exprs = append(exprs, ft.FormatNode(expr))
 		}
+		return "(" + strings.Join(exprs, ", ") + ")"
+	default:
+		panic(ft.newError(node.Pos(), "unsupported node type %T", node))
+	}
+}
+
+// formatIf formats an if statement without its indentation and newline,
+// so that else if can be formatted on the same line.
+func (ft *formater) formatIf(node *ast.IfStmt) string {
+	var s = fmt.Sprintf("if %s %s", ft.FormatNode(node.Cond), ft.FormatNode(node.Body))
+	switch elseStmt := node.Else.(type) {
+	case nil:
+		return s
+	case *ast.IfStmt:
+		return s + " else " + ft.formatIf(elseStmt)
 	default:
-		return fmt.Sprintf("(TODO %T)", node)
+		return s + " else " + ft.FormatNode(elseStmt)
+	}
+}
+
+func (ft *formater) formatArgs(args []ast.FuncSignatureArg) string {
+	var formatted []string
+	for _, arg := range args {
+		formatted = append(formatted, fmt.Sprintf("%s %s", arg.Name, arg.Type))
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
+
+func (ft *formater) formatPipedArgs(signature *ast.FuncSignature) string {
+	if len(signature.PipedArgs) == 0 {
+		return ""
+	}
+	return ft.formatArgs(signature.PipedArgs) + " | "
+}
+
+func (ft *formater) operator(pos scanner.Pos, op token.Token) string {
+	var s, ok = operators[op]
+	if !ok {
+		panic(ft.newError(pos, "unsupported operator %s", op))
+	}
+	return s
+}
+
+func isFuncBody(decl ast.Decl) bool {
+	var funcDecl, ok = decl.(*ast.FuncDecl)
+	return ok && !funcDecl.IsExternal
+}
+
+// lines writes statements and the comments between them.
+type lines struct {
+	ft           *formater
+	buf          bytes.Buffer
+	empty        bool // nothing is written yet, except maybe an opening brace
+	afterComment bool // the last line is a comment on its own line
+	afterFunc    bool // the last statement is a function with a body
+}
+
+func (ft *formater) newLines() *lines {
+	return &lines{ft: ft, empty: true}
+}
+
+func (l *lines) write(s string, blankLine bool) {
+	if !l.empty && (blankLine || l.afterFunc) {
+		l.buf.WriteString("\n")
+	}
+	l.buf.WriteString(s)
+	l.empty = false
+	l.afterComment = false
+	l.afterFunc = false
+}
+
+// flushComments writes the comments that come before pos.
+func (l *lines) flushComments(pos scanner.Pos) {
+	for len(l.ft.comments) > 0 && l.ft.comments[0].Position < pos {
+		var comment = l.ft.comments[0]
+		l.ft.comments = l.ft.comments[1:]
+
+		if l.ft.isTrailing(comment.Position) && l.buf.Len() > 0 {
+			var s = strings.TrimSuffix(l.buf.String(), "\n")
+			l.buf.Reset()
+			l.buf.WriteString(s + " " + comment.Text + "\n")
+			continue
+		}
+		l.write(l.ft.indent()+comment.Text+"\n", l.ft.blankLineBefore(comment.Position))
+		l.afterComment = true
+	}
+}
+
+// isTrailing reports whether there is code before pos on its line.
+func (ft *formater) isTrailing(pos scanner.Pos) bool {
+	for i := int(pos) - 1; i >= 0; i-- {
+		switch ft.src[i] {
+		case ' ', '\t':
+			continue
+		case '\n':
+			return false
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// blankLineBefore reports whether the line before the one at pos is blank.
+func (ft *formater) blankLineBefore(pos scanner.Pos) bool {
+	var i = int(pos) - 1
+	for i >= 0 && (ft.src[i] == ' ' || ft.src[i] == '\t') {
+		i--
+	}
+	if i < 0 || ft.src[i] != '\n' {
+		return false
+	}
+	i--
+	for i >= 0 && (ft.src[i] == ' ' || ft.src[i] == '\t' || ft.src[i] == '\r') {
+		i--
 	}
+	return i >= 0 && ft.src[i] == '\n'
 }
 
 func (ft *formater) indent() string {
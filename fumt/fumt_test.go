@@ -3,6 +3,8 @@ package fumt_test
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -39,25 +41,69 @@ var testCases = []struct {
 			    return
 	    }
 	    `,
-		want: `let x = 1
+		want: `// pipe(x)
+
+let x = 1
+
 function main() {
 	let x = "hello"
 	let y = 3.14
 	let z = 123
 	f2(1, pipe_capture("date ${x:%q}"))
+
+	// pipe(x)
 }
 
 function f2(x int) {
 	let y = 3.14
 	return
 }
-
+`,
+	},
+	{
+		src: `
+		external  echo (s string)=>"echo ${s}"   // prints s
+		external (stdin reader)|nl()  =>  "nl"
+		// Greets
+		function (stdin reader)|main() {
+			if 1==1{
+				print_stream(echo("a")|nl())
+			}else if "a"~~"b" {  // never
+				let x=-1
+			} else {
+				let y = 1.0
+			}
+		}`,
+		want: `external echo(s string) => "echo ${s}" // prints s
+external (stdin reader) | nl() => "nl"
+// Greets
+function (stdin reader) | main() {
+	if 1 == 1 {
+		print_stream(echo("a") | nl())
+	} else if "a" ~~ "b" { // never
+		let x = -1
+	} else {
+		let y = 1.0
+	}
+}
+`,
+	},
+	{
+		src: `function main() {
+			let x=list(1,2)[ 0 ]+1
+			let db=record("port",x)
+			println("${x  *  2}",db.port)
+		}`,
+		want: `function main() {
+	let x = list(1, 2)[0] + 1
+	let db = record("port", x)
+	println("${x  *  2}", db.port)
+}
 `,
 	},
 }
 
 func TestFumt(tt *testing.T) {
-	// TODO: preserve comments
 	for ti, tc := range testCases {
 		var src = tc.src
 		src = scanner.FormatSrc(src, true)
@@ -78,3 +124,29 @@ func TestFumt(tt *testing.T) {
 		}
 	}
 }
+
+func TestFumtRoundTrip(tt *testing.T) {
+	var filenames, err = filepath.Glob("../testdata/*.well")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		tt.Fatal("no testdata found")
+	}
+	for _, filename := range filenames {
+		var src, err = os.ReadFile(filename)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		// testdata files are already formatted, so formatting them must not
+		// change them
+		var got bytes.Buffer
+		if err := fumt.NewFormater().Format(bytes.NewReader(src), &got); err != nil {
+			tt.Fatalf("format failed (%s)\nerr:\n%s", filename, err)
+		}
+		if diff := cmp.Diff(string(src), got.String()); diff != "" {
+			tt.Fatalf("formatting is not idempotent (%s)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", filename, diff)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package interpreter
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -11,6 +12,8 @@ type Environment interface {
 	Set(string, Object) error
 	NewScope() Environment
 	Global() Environment
+	Parent() Environment
+	Names() []string
 	SetDebug(bool)
 }
 
@@ -67,6 +70,21 @@ func (env *mapEnv) Set(name string, obj Object) error {
 	return nil
 }
 
+// Names returns the sorted names defined in the environment.
+func (env *mapEnv) Names() []string {
+	var names []string
+	for name := range env.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parent returns the environment the scope was created from, or nil.
+func (env *mapEnv) Parent() Environment {
+	return env.parent
+}
+
 func (env *mapEnv) Global() Environment {
 	return env.global
 }
@@ -3,15 +3,18 @@ package interpreter
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/siadat/well/diagnostics"
 	"github.com/siadat/well/erroring"
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/parser"
@@ -29,10 +32,24 @@ type Interpreter struct {
 	Debug   bool
 
 	parser *parser.Parser
+	hook   Hook
+	tracer Tracer
+	stack  []Frame
 
 	currEvalNode ast.Node
 }
 
+// Hook is called before each node is evaluated. If it returns an error, the
+// evaluation stops with that error.
+type Hook func(node ast.Node, env Environment) error
+
+// Frame is an active call of a Well function.
+type Frame struct {
+	Function *Function
+	Call     *ast.CallExpr // the call in the caller
+	Env      Environment   // the scope of the call
+}
+
 func NewInterpreter(stdout, stderr io.Writer) *Interpreter {
 	return &Interpreter{
 		Stdout: stdout,
@@ -48,16 +65,56 @@ func (interp *Interpreter) SetDebug(v bool) {
 	interp.Debug = v
 }
 
+// SetHook sets a function that is called before each node is evaluated, e.g.
+// by a debugger.
+func (interp *Interpreter) SetHook(hook Hook) {
+	interp.hook = hook
+}
+
+// Stack returns the active calls, the innermost call is the last one.
+func (interp *Interpreter) Stack() []Frame {
+	return append([]Frame(nil), interp.stack...)
+}
+
+// Position returns the position of pos in the source being evaluated, or an
+// invalid position if pos is not in it.
+func (interp *Interpreter) Position(pos scanner.Pos) scanner.Position {
+	var file = interp.parser.File()
+	if !file.Contains(pos) {
+		return scanner.Position{}
+	}
+	return file.Position(pos)
+}
+
 func (interp *Interpreter) Eval(src io.Reader, env Environment) (Object, error) {
+	return interp.EvalFile("", src, env)
+}
+
+// EvalFile is like Eval, but positions in errors include the file name.
+func (interp *Interpreter) EvalFile(filename string, src io.Reader, env Environment) (Object, error) {
 	interp.parser = parser.NewParser()
 	interp.parser.SetDebug(interp.Debug)
-	var node, err = interp.parser.Parse(src)
+	var node, err = interp.parser.ParseFile(scanner.NewFileSet(), filename, src)
 	if err != nil {
 		return nil, err
 	}
 	return interp.evalParsed(node, env)
 }
 
+// EvalNode evaluates a node that was parsed by p and returns its value.
+// Unlike Eval, it does not call main, so that declarations and expressions
+// can be evaluated one by one in the same environment, e.g. in the REPL.
+func (interp *Interpreter) EvalNode(p *parser.Parser, node ast.Node, env Environment) (Object, error) {
+	// EvalNode may be called by a hook in the middle of an evaluation
+	defer func(parser *parser.Parser, currEvalNode ast.Node) {
+		interp.parser, interp.currEvalNode = parser, currEvalNode
+	}(interp.parser, interp.currEvalNode)
+	interp.parser = p
+	return erroring.CallAndRecover[InterpError](func() Object {
+		return interp.eval(node, env)
+	})
+}
+
 func (interp *Interpreter) evalParsed(node ast.Node, env Environment) (Object, error) {
 	return erroring.CallAndRecover[InterpError](func() Object {
 		interp.eval(node, env)
@@ -75,10 +132,18 @@ func (interp *Interpreter) builtins() map[string]*Builtin {
 				}
 
 				var stdin io.Reader
+				var upstream *commandStream
 				if pipedArg != nil {
 					stdin = pipedArg.(*PipeStream).ReadCloser
+					if s, ok := stdin.(*commandStream); ok {
+						// pass the pipe itself, so that the commands are
+						// connected directly
+						upstream, stdin = s, s.file
+					}
 				}
-				var cmdArgs = posArgs[0].(*String).AsArgs
+				var cmdStr = posArgs[0].(*String)
+				var cmdArgs = cmdStr.AsArgs
+				var loggedArgs = cmdStr.RedactArgs(cmdArgs)
 				var cmd = exec.CommandContext(context.TODO(), cmdArgs[0], cmdArgs[1:]...)
 
 				// var pr, pw, err = os.Pipe()
@@ -88,8 +153,28 @@ func (interp *Interpreter) builtins() map[string]*Builtin {
 					return nil, err
 				}
 
-				var runErr = cmd.Start()
-				return &PipeStream{ReadCloser: stdout}, runErr
+				var start = time.Now()
+				var depth = len(interp.stack)
+				if runErr := cmd.Start(); runErr != nil {
+					return nil, fmt.Errorf("%s", cmdStr.Redact(runErr.Error()))
+				}
+				var stream = &commandStream{
+					file:     stdout,
+					cmd:      cmd,
+					upstream: upstream,
+					done: func(exitCode int) {
+						interp.trace(TraceEvent{
+							Kind:     TraceCommand,
+							Depth:    depth,
+							Name:     loggedArgs[0],
+							Argv:     loggedArgs,
+							ExitCode: exitCode,
+							Time:     start,
+							Duration: time.Since(start),
+						})
+					},
+				}
+				return &PipeStream{ReadCloser: stream}, nil
 			},
 		},
 		{
@@ -149,7 +234,8 @@ func (interp *Interpreter) builtins() map[string]*Builtin {
 					return nil, fmt.Errorf("read expects 2 args, got %d", len(posArgs))
 				}
 				var code = posArgs[0].(*Integer).Value
-				var msg = posArgs[1].(*String).AsSingle
+				// String masks the secrets in the message
+				var msg = posArgs[1].(*String).String()
 				fmt.Fprintf(interp.Stderr, "%s\n", msg)
 				os.Exit(code)
 				return nil, nil
@@ -226,6 +312,68 @@ func (interp *Interpreter) builtins() map[string]*Builtin {
 				}
 			},
 		},
+		{
+			"secret_env", func(pipedValue Object, posArgs []Object, kvArgs map[string]Object) (Object, error) {
+				if len(posArgs) != 1 {
+					return nil, fmt.Errorf("secret_env expects 1 arg, got %d", len(posArgs))
+				}
+				var name = posArgs[0].(*String).AsSingle
+				var value, ok = os.LookupEnv(name)
+				if !ok {
+					return nil, fmt.Errorf("environment variable %s is not set", name)
+				}
+				return newSecret(value), nil
+			},
+		},
+		{
+			"read_secret", func(pipedValue Object, posArgs []Object, kvArgs map[string]Object) (Object, error) {
+				if len(posArgs) != 0 {
+					return nil, fmt.Errorf("read_secret expects 0 args, got %d", len(posArgs))
+				}
+				if isTerminal(os.Stdin) {
+					// do not echo the secret while it is typed
+					if err := stty("-echo"); err == nil {
+						defer func() {
+							stty("echo")
+							fmt.Fprintln(interp.Stderr)
+						}()
+					}
+				}
+				var scanner = bufio.NewScanner(os.Stdin)
+				scanner.Scan()
+				if err := scanner.Err(); err != nil {
+					return nil, err
+				}
+				return newSecret(scanner.Text()), nil
+			},
+		},
+		{
+			"list", func(pipedValue Object, posArgs []Object, kvArgs map[string]Object) (Object, error) {
+				var items = make([]Object, len(posArgs))
+				copy(items, posArgs)
+				return &List{Items: items}, nil
+			},
+		},
+		{
+			"record", func(pipedValue Object, posArgs []Object, kvArgs map[string]Object) (Object, error) {
+				if len(posArgs)%2 != 0 {
+					return nil, fmt.Errorf("record expects pairs of names and values, got %d args", len(posArgs))
+				}
+				var record = &Record{Fields: make(map[string]Object, len(posArgs)/2)}
+				for i := 0; i < len(posArgs); i += 2 {
+					var name, ok = posArgs[i].(*String)
+					if !ok {
+						return nil, fmt.Errorf("record field name %s is not a string", posArgs[i])
+					}
+					if _, ok := record.Fields[name.AsSingle]; ok {
+						return nil, fmt.Errorf("record field %s is given twice", name.AsSingle)
+					}
+					record.Names = append(record.Names, name.AsSingle)
+					record.Fields[name.AsSingle] = posArgs[i+1]
+				}
+				return record, nil
+			},
+		},
 		{
 			"date", func(pipedValue Object, posArgs []Object, kvArgs map[string]Object) (Object, error) {
 				return &String{AsSingle: fmt.Sprintf("%v", time.Now())}, nil
@@ -240,9 +388,23 @@ func (interp *Interpreter) builtins() map[string]*Builtin {
 	return m
 }
 
+// BuiltinNames returns the sorted names of the builtin functions, except the
+// internal ones that start with an underscore.
+func (interp *Interpreter) BuiltinNames() []string {
+	var names []string
+	for name := range interp.builtins() {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (interp *Interpreter) mustSet(env Environment, name string, obj Object) {
 	if err := env.Set(name, obj); err != nil {
-		panic(interp.newError(interp.currEvalNode.Pos(), "%s", err))
+		panic(interp.newError(interp.currEvalNode, "%s", err))
 	}
 }
 
@@ -251,6 +413,11 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 	if interp.Debug {
 		fmt.Printf("[eval] %T %+v\n", node, node)
 	}
+	if interp.hook != nil {
+		if err := interp.hook(node, env); err != nil {
+			panic(interp.newError(node, "%s", err))
+		}
+	}
 	switch node := node.(type) {
 	case *ast.Root:
 		for _, decl := range node.Decls {
@@ -263,6 +430,7 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 				PipedArg: &ast.ParenExpr{Exprs: []ast.Expr{
 					&ast.Ident{Name: "MainStdin", Position: NoPos},
 				}},
+				Position: NoPos,
 			},
 			env,
 		)
@@ -273,17 +441,25 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 		}
 		return &Paren{Objects: objs}
 	case *ast.ExprStmt:
-		return interp.eval(node.X, env)
+		var obj = interp.eval(node.X, env)
+		if stream, ok := obj.(*PipeStream); ok {
+			if cmd, ok := stream.ReadCloser.(*commandStream); ok {
+				// nobody reads the output of the command, it is discarded
+				// and the command is waited for, so that it is traced
+				io.Copy(io.Discard, cmd)
+				cmd.Close()
+			}
+		}
+		return obj
 	case *ast.CallExpr:
 		var funcDef = interp.eval(node.Fun, env)
-		if interp.Verbose {
-			switch f := node.Fun.(type) {
-			case *ast.Ident:
-				var line, col = interp.parser.GetLineColAt(f.Pos())
-				fmt.Fprintf(os.Stderr, "+ called %v(...) at %d:%d\n", f.Name, line+1, col+1)
-			default:
-				panic(interp.newError(node.Pos(), "unsupported call expressiong of type %T", f))
+		if interp.Verbose && node.Fun.Pos() != NoPos {
+			var name = funcDef.String()
+			if f, ok := node.Fun.(*ast.Ident); ok {
+				name = f.Name
 			}
+			var line, col = interp.parser.GetLineColAt(node.Fun.Pos())
+			fmt.Fprintf(interp.Stderr, "+ called %v(...) at %d:%d\n", name, line+1, col+1)
 		}
 		// TODO: trace function calls
 		switch funcDef := funcDef.(type) {
@@ -308,20 +484,20 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 
 			var userResult, userErr = funcDef.Func(pipedObject, positionals, keywords)
 			if userErr != nil {
-				panic(interp.newError(node.Pos(), "%s", userErr))
+				panic(interp.newError(node, "%s", userErr))
 			}
 			return userResult
 		case *Function:
 			var callLen = len(node.Arg.Exprs)
 			var declLen = len(funcDef.Signature.Args)
 			if callLen != declLen {
-				panic(interp.newError(node.Arg.Pos(), "%s takes %d args, call is sending %d arg", funcDef, declLen, callLen))
+				panic(interp.newError(node.Arg, "%s takes %d args, call is sending %d arg", funcDef, declLen, callLen))
 			}
 
 			want := len(funcDef.Signature.PipedArgs)
 			got := len(node.PipedArg.Exprs)
 			if want != got {
-				panic(interp.newError(node.Arg.Pos(), "%s takes %d piped args, call is sending %v", funcDef, want, got))
+				panic(interp.newError(node.Arg, "%s takes %d piped args, call is sending %v", funcDef, want, got))
 			}
 
 			var positionalArgNames []string
@@ -335,12 +511,14 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 			}
 
 			var newEnv = env.Global().NewScope()
+			var traceArgs []TraceArg
 
 			var pipedIdx = 0
 			for _, arg := range node.PipedArg.Exprs {
 				var obj = interp.eval(arg, env) // here we should use the old env
 				var name = pipedArgNames[0]
 				interp.mustSet(newEnv, name, obj)
+				traceArgs = append(traceArgs, TraceArg{Name: name, Value: obj})
 				pipedIdx += 1
 			}
 
@@ -349,23 +527,47 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 				var obj = interp.eval(arg, env) // here we should use the old env
 				var name = positionalArgNames[positionalIdx]
 				interp.mustSet(newEnv, name, obj)
+				traceArgs = append(traceArgs, TraceArg{Name: name, Value: obj})
 				positionalIdx += 1
 			}
 
+			interp.stack = append(interp.stack, Frame{Function: funcDef, Call: node, Env: newEnv})
+			defer func() { interp.stack = interp.stack[:len(interp.stack)-1] }()
+
+			var start = time.Now()
+			interp.trace(TraceEvent{
+				Kind:     TraceCall,
+				Depth:    len(interp.stack),
+				Name:     funcDef.Name,
+				Args:     traceArgs,
+				Position: interp.Position(node.Pos()),
+				Time:     start,
+			})
+
 			// ast.BlockStmt
 			// return interp.eval(funcDef.Body, newEnv)
 
 			var result = interp.eval(funcDef.Body, newEnv)
+			var returned Object
 			switch result := result.(type) {
 			case nil:
-				return nil
 			case *ReturnStmt:
-				return result.Expr
+				returned = result.Expr
 			default:
-				panic(interp.newError(node.Pos(), "unexpected return type %T", result))
+				panic(interp.newError(node, "unexpected return type %T", result))
 			}
+			interp.trace(TraceEvent{
+				Kind:     TraceReturn,
+				Depth:    len(interp.stack),
+				Name:     funcDef.Name,
+				Result:   returned,
+				Position: interp.Position(node.Pos()),
+				Time:     time.Now(),
+				Duration: time.Since(start),
+			})
+			return returned
 		default:
-			panic(interp.newError(node.Pos(), "unsupported function type %T", funcDef))
+			panic(interp.newError(node, "unsupported function type %T", funcDef))
 		}
 	case *ast.ReturnStmt:
 		return &ReturnStmt{Expr: interp.eval(node.Expr, env)}
@@ -376,7 +578,7 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 			if b, ok := interp.builtins()[node.Name]; ok {
 				return b
 			}
-			panic(interp.newError(node.Pos(), "%q is missing: %v", node.Name, err))
+			panic(interp.newError(node, "%q is missing: %v", node.Name, err))
 		}
 		return val
 	case *ast.FuncDecl:
@@ -393,6 +595,9 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 		// language are not expressions atm. If in the futre you want to
 		// support anonymous function, return the Function here.
 		return nil
+	case *ast.RequiresDecl:
+		// Dependencies are resolved by the type checker before running
+		return nil
 	case *ast.Integer:
 		return &Integer{Value: node.Value}
 	case *ast.Float:
@@ -410,14 +615,52 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 			var y = interp.eval(node.Y, env)
 			// TODO: check regexp compilation statically on a best effort basis
 			var re = regexp.MustCompile(y.(*String).AsSingle)
-			return &Boolean{Value: re.MatchString(x.(*String).AsSingle)}
+			return &Boolean{Value: !re.MatchString(x.(*String).AsSingle)}
 		case token.EQL:
 			var x = interp.eval(node.X, env)
 			var y = interp.eval(node.Y, env)
-			return &Boolean{Value: x.GoValue() == y.GoValue()}
+			return &Boolean{Value: reveal(x) == reveal(y)}
+		case token.ADD, token.SUB, token.MUL, token.QUO:
+			var x = unparen(interp.eval(node.X, env))
+			var y = unparen(interp.eval(node.Y, env))
+			var result, err = arithmetic(node.Op, x, y)
+			if err != nil {
+				panic(interp.newError(node, "%s", err))
+			}
+			return result
 		default:
-			panic(interp.newError(node.Pos(), "unsupported binary operator %q", node.Op))
+			panic(interp.newError(node, "unsupported binary operator %q", node.Op))
+		}
+	case *ast.UnaryExpr:
+		var x = unparen(interp.eval(node.X, env))
+		// -x is 0 - x, and +x is 0 + x
+		var result, err = arithmetic(node.Op, &Integer{Value: 0}, x)
+		if err != nil {
+			panic(interp.newError(node, "%s", err))
 		}
+		return result
+	case *ast.IndexExpr:
+		var x = unparen(interp.eval(node.X, env))
+		var index = unparen(interp.eval(node.Index, env))
+		var list, ok = x.(*List)
+		if !ok {
+			panic(interp.newError(node.X, "cannot index %s, it is not a list", x))
+		}
+		i, ok := index.(*Integer)
+		if !ok {
+			panic(interp.newError(node.Index, "list index %s is not an integer", index))
+		}
+		if i.Value < 0 || i.Value >= len(list.Items) {
+			panic(interp.newError(node, "index %d is out of range, the list has %d items", i.Value, len(list.Items)))
+		}
+		return list.Items[i.Value]
+	case *ast.SelectorExpr:
+		var x = unparen(interp.eval(node.X, env))
+		var field, err = selectField(x, node.Sel.Name)
+		if err != nil {
+			panic(interp.newError(node.Sel, "%s", err))
+		}
+		return field
 	case *ast.BlockStmt:
 		for _, stmt := range node.Statements {
 			var result = interp.eval(stmt, env)
@@ -441,17 +684,63 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 		interp.mustSet(env, node.Name.Name, interp.eval(node.Rhs, env))
 		return nil
 	case *ast.String:
+		// expressions are evaluated once, even though the template is
+		// rendered twice
+		var interpolated = make(map[string]Object, len(node.Interpolations))
+		for _, interpolation := range node.Interpolations {
+			interpolated[interpolation.Src] = unparen(interp.eval(interpolation.X, env))
+		}
+
+		var secrets []string
+		var missing = map[string]error{}
 		var envFunc = func(name string) interface{} {
-			val, err := env.Get(name)
-			if err != nil {
-				panic(interp.newError(node.Pos(), "%q is missing: %v", name, err))
+			val, ok := interpolated[name]
+			if ok && val == nil {
+				// the expander reports that the expression has no value
+				return errors.New("it has no value")
+			}
+			if !ok {
+				var err error
+				val, err = lookup(env, name)
+				if err != nil {
+					// the variable might have a default value, the expander
+					// fails if it does not
+					missing[name] = err
+					return nil
+				}
+			}
+			var value = func(val Object) interface{} {
+				if str, ok := val.(*String); ok {
+					// the string keeps the secrets it interpolates, its String
+					// method would mask them
+					for _, secret := range str.Secrets {
+						if !contains(secrets, secret) {
+							secrets = append(secrets, secret)
+						}
+					}
+					return str.AsSingle
+				}
+				return val
+			}
+			if list, ok := val.(*List); ok {
+				var items = make([]string, len(list.Items))
+				for k, item := range list.Items {
+					if _, ok := item.(*List); ok {
+						panic(interp.newError(node, "cannot interpolate %q, its item %d is a list", name, k))
+					}
+					items[k] = fmt.Sprint(value(item))
+				}
+				return items
 			}
-			return val
+			return value(val)
 		}
 
-		var rendered, err = expander.EncodeToString(node.Root, envFunc)
+		var rendered, err = expander.EncodeToString(node.Root, envFunc, expander.Basic)
+		if undefined, ok := err.(*expander.UndefinedError); ok && !undefined.Required {
+			panic(interp.newError(node, "%q is missing: %v", undefined.Name, missing[undefined.Name]))
+		}
 		if err != nil {
-			panic(interp.newError(node.Pos(), "failed to render string: %v", err))
+			panic(interp.newError(node, "failed to render string: %v", err))
 		}
 		if interp.Verbose {
 			// fmt.Fprintf(interp.Stderr, "+ string %q\n", rendered)
@@ -459,29 +748,195 @@ func (interp *Interpreter) eval(node ast.Node, env Environment) Object {
 
 		var words, encodeErr = expander.EncodeToCmdArgs(node.Root, envFunc)
 		if encodeErr != nil {
-			panic(interp.newError(node.Pos(), "failed to create args: %s", encodeErr))
+			panic(interp.newError(node, "failed to create args: %s", encodeErr))
 		}
 		return &String{
 			AsSingle: rendered,
 			AsArgs:   words,
+			Secrets:  secrets,
 		}
 	default:
-		panic(interp.newError(node.Pos(), "unsupported node type %T", node))
+		panic(interp.newError(node, "unsupported node type %T", node))
 	}
 }
 
 type InterpError struct {
-	err error
+	Stack []StackEntry // the active calls when the error happened, innermost first
+
+	err        error
+	diagnostic diagnostics.Diagnostic
+}
+
+// StackEntry is a call of a Well function.
+type StackEntry struct {
+	Function string
+	Caller   string           // empty if called at the top level
+	Position scanner.Position // the position of the call
 }
 
 func (i InterpError) Error() string {
 	return i.err.Error()
 }
 
-func (interp *Interpreter) newError(pos scanner.Pos, f string, args ...any) error {
-	if pos == NoPos {
-		return InterpError{fmt.Errorf(f, args...)}
+func (i InterpError) Diagnostics() []diagnostics.Diagnostic {
+	return []diagnostics.Diagnostic{i.diagnostic}
+}
+
+// newError returns an error that spans node, followed by a traceback of the
+// active calls.
+func (interp *Interpreter) newError(node ast.Node, f string, args ...any) error {
+	var msg = fmt.Sprintf(f, args...)
+	var pos = node.Pos()
+	var e InterpError
+	var lines []string
+	// nodes evaluated in the REPL may come from a source that was parsed
+	// before, in which case there is no source to mark
+	if pos == NoPos || !interp.parser.File().Contains(pos) {
+		e.diagnostic = diagnostics.Diagnostic{Severity: diagnostics.SeverityError, Code: diagnostics.CodeRuntime, Message: msg}
+		lines = []string{msg}
+	} else {
+		e.diagnostic = diagnostics.New(diagnostics.CodeRuntime, pos, node.End(), interp.parser.GetLineColAt, msg)
+		lines = interp.parser.MarkSpan(pos, node.End(), msg, false)
+	}
+
+	e.Stack = interp.callStack()
+	for _, entry := range e.Stack {
+		var call = diagnostics.Call{
+			Function: entry.Function,
+			Caller:   entry.Caller,
+			Position: diagnostics.Position{Line: entry.Position.Line, Column: entry.Position.Column},
+		}
+		e.diagnostic.Stack = append(e.diagnostic.Stack, call)
+		lines = append(lines, call.Traceback(interp.parser.File().Name()))
+	}
+	e.err = fmt.Errorf("%s", strings.Join(lines, "\n"))
+	return e
+}
+
+// callStack returns the active calls, innermost first. The call of main by
+// the interpreter is not included.
+func (interp *Interpreter) callStack() []StackEntry {
+	var entries []StackEntry
+	for i := len(interp.stack) - 1; i >= 0; i-- {
+		var frame = interp.stack[i]
+		var pos = frame.Call.Pos()
+		if pos == NoPos {
+			continue
+		}
+		var entry = StackEntry{Function: frame.Function.Name, Position: interp.Position(pos)}
+		if i > 0 {
+			entry.Caller = interp.stack[i-1].Function.Name
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecret returns a string that is masked everywhere except in the
+// arguments of external commands.
+func newSecret(value string) *String {
+	return &String{AsSingle: value, AsArgs: []string{value}, Secrets: []string{value}}
+}
+
+// reveal returns the value of obj, including the secrets it contains.
+func reveal(obj Object) interface{} {
+	if str, ok := obj.(*String); ok {
+		return str.AsSingle
+	}
+	return obj.GoValue()
+}
+
+// lookup returns the value of an interpolated name, which selects the
+// fields of a record if it has dots, e.g. db.host.
+func lookup(env Environment, name string) (Object, error) {
+	var parts = strings.Split(name, ".")
+	var obj, err = env.Get(parts[0])
+	for _, field := range parts[1:] {
+		if err != nil {
+			break
+		}
+		obj, err = selectField(unparen(obj), field)
+	}
+	return obj, err
+}
+
+// unparen returns the object in a parenthesized expression, e.g. the value
+// of (1 + 2).
+func unparen(obj Object) Object {
+	if paren, ok := obj.(*Paren); ok && len(paren.Objects) == 1 {
+		return paren.Objects[0]
 	}
-	var lines = interp.parser.MarkAt(pos, fmt.Sprintf(f, args...), false)
-	return InterpError{fmt.Errorf("%s", strings.Join(lines, "\n"))}
+	return obj
+}
+
+// arithmetic returns x op y. The result is an integer if both operands are
+// integers, otherwise it is a float.
+func arithmetic(op token.Token, x, y Object) (Object, error) {
+	var xi, xIsInt = x.(*Integer)
+	var yi, yIsInt = y.(*Integer)
+	if xIsInt && yIsInt {
+		switch op {
+		case token.ADD:
+			return &Integer{Value: xi.Value + yi.Value}, nil
+		case token.SUB:
+			return &Integer{Value: xi.Value - yi.Value}, nil
+		case token.MUL:
+			return &Integer{Value: xi.Value * yi.Value}, nil
+		case token.QUO:
+			if yi.Value == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return &Integer{Value: xi.Value / yi.Value}, nil
+		}
+	}
+
+	var xf, xOk = toFloat(x)
+	var yf, yOk = toFloat(y)
+	if !xOk || !yOk {
+		return nil, fmt.Errorf("unsupported operands of %s: %s and %s", op, x, y)
+	}
+	switch op {
+	case token.ADD:
+		return &Float{Value: xf + yf}, nil
+	case token.SUB:
+		return &Float{Value: xf - yf}, nil
+	case token.MUL:
+		return &Float{Value: xf * yf}, nil
+	case token.QUO:
+		if yf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return &Float{Value: xf / yf}, nil
+	}
+	return nil, fmt.Errorf("unsupported arithmetic operator %s", op)
+}
+
+func toFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+func isTerminal(f *os.File) bool {
+	var info, err = f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func stty(arg string) error {
+	var cmd = exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
 }
@@ -2,8 +2,11 @@ package interpreter_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
 
@@ -61,6 +64,50 @@ var testCases = []struct {
 		wantObj:    nil,
 		wantStdout: "     1\thello1\nhi and bye\ns1=0 and s2=0\ntrue\n",
 	},
+	{
+		src: `
+		external printf(format string, args list) => "printf ${format:%q} ${args}"
+
+		function (stdin reader) | main() {
+			let files = list("my file", "", 3)
+			print_stream(printf("[%s]", files))
+			println("«${files:%q\", \"}»", files)
+		}
+		`,
+		wantObj:    nil,
+		wantStdout: `[my file][][3]"\"my file\", \"\", \"3\"" [my file  3]` + "\n",
+	},
+	{
+		src: `
+		external echo(s string) => "echo ${s:%q}"
+
+		function double(n int) (int) {
+			return n * 2
+		}
+
+		function (stdin reader) | main() {
+			let count = 2
+			let names = list("a b", "c")
+			println("${count + 1} ${double(count) - 1} ${(count + 1) * 2} ${10 - 4 - 3} ${7 / 2} ${-count}")
+			println("${names[0]:%q} ${names[count - 1]} ${7 / 2.0}")
+			print_stream(echo("n=${count * 3}"))
+		}
+		`,
+		wantObj:    nil,
+		wantStdout: "3 3 6 3 3 -2\n\"a b\" c 3.5\nn=6\n",
+	},
+	{
+		src: `
+		function (stdin reader) | main() {
+			let count = 2
+			let db = record("host", "db.local", "port", 5432)
+			println("${db.host}:${db.port} ${db.port+1} ${count+1} ${count+\"set\"}")
+			println(db.port - 1, "${db:%q}")
+		}
+		`,
+		wantObj:    nil,
+		wantStdout: "db.local:5432 5433 3 set\n5431 \"{host=db.local port=5432}\"\n",
+	},
 }
 
 func TestParser(tt *testing.T) {
@@ -94,3 +141,223 @@ func TestParser(tt *testing.T) {
 		}
 	}
 }
+
+func TestErrorStack(tt *testing.T) {
+	var src = `function inner(x string) {
+  println(missing)
+}
+
+function outer(x string) {
+  inner(x)
+}
+
+function (stdin reader) | main() {
+  outer("a")
+}
+`
+	var interp = interpreter.NewInterpreter(io.Discard, io.Discard)
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	var _, err = interp.EvalFile("deploy.well", strings.NewReader(src), env)
+	var interpErr interpreter.InterpError
+	if !errors.As(err, &interpErr) {
+		tt.Fatalf("want an InterpError, got %v", err)
+	}
+
+	var wantStack = []interpreter.StackEntry{
+		{Function: "inner", Caller: "outer", Position: scanner.Position{Filename: "deploy.well", Offset: 78, Line: 6, Column: 3}},
+		{Function: "outer", Caller: "main", Position: scanner.Position{Filename: "deploy.well", Offset: 127, Line: 10, Column: 3}},
+	}
+	if diff := cmp.Diff(wantStack, interpErr.Stack); diff != "" {
+		tt.Fatalf("mismatching stack\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var want = `  println(missing)
+          ⌃‾‾‾‾‾‾
+          │
+          ╰─── at line 2 column 11: "missing" is missing: undefined object "missing"
+called from deploy.well:6 in outer
+called from deploy.well:10 in main`
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		tt.Fatalf("mismatching error\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+type recordingTracer []interpreter.TraceEvent
+
+func (r *recordingTracer) Trace(event interpreter.TraceEvent) {
+	*r = append(*r, event)
+}
+
+func TestSecret(tt *testing.T) {
+	tt.Setenv("WELL_TEST_TOKEN", "hunter2")
+	var src = `external echo(s string) => "echo ${s}"
+
+function (stdin reader) | main() {
+  let token = secret_env("WELL_TEST_TOKEN")
+  let header = "Authorization: ${token}"
+  print_stream(echo(header))
+  println(header, token == "hunter2")
+}
+`
+	var stdout bytes.Buffer
+	var tracer recordingTracer
+	var interp = interpreter.NewInterpreter(&stdout, io.Discard)
+	interp.SetTracer(&tracer)
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	if _, err := interp.Eval(strings.NewReader(src), env); err != nil {
+		tt.Fatal(err)
+	}
+
+	// the command gets the secret, everything else gets the mask
+	var want = "Authorization: hunter2\nAuthorization: *** true\n"
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		tt.Fatalf("mismatching stdout\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+	var argvs [][]string
+	for _, event := range tracer {
+		if event.Kind == interpreter.TraceCommand {
+			argvs = append(argvs, event.Argv)
+		}
+	}
+	if diff := cmp.Diff([][]string{{"echo", "Authorization:", "***"}}, argvs); diff != "" {
+		tt.Fatalf("mismatching traced argv\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestTraceDiscardedCommand(tt *testing.T) {
+	var src = `external sh(script string) => "sh -c ${script:%q}"
+
+function (stdin reader) | main() {
+  sh("echo discarded; exit 3")
+  println("done")
+}
+`
+	var stdout bytes.Buffer
+	var tracer recordingTracer
+	var interp = interpreter.NewInterpreter(&stdout, io.Discard)
+	interp.SetTracer(&tracer)
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	if _, err := interp.Eval(strings.NewReader(src), env); err != nil {
+		tt.Fatal(err)
+	}
+
+	if diff := cmp.Diff("done\n", stdout.String()); diff != "" {
+		tt.Fatalf("mismatching stdout\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+	var exitCodes []int
+	for _, event := range tracer {
+		if event.Kind == interpreter.TraceCommand {
+			exitCodes = append(exitCodes, event.ExitCode)
+		}
+	}
+	if diff := cmp.Diff([]int{3}, exitCodes); diff != "" {
+		tt.Fatalf("mismatching traced exit codes\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestInterpolateNoValue(tt *testing.T) {
+	var src = `function nothing() {
+}
+
+function (stdin reader) | main() {
+  println("${nothing()}")
+}
+`
+	var interp = interpreter.NewInterpreter(io.Discard, io.Discard)
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	var _, err = interp.Eval(strings.NewReader(src), env)
+	if err == nil || !strings.Contains(err.Error(), "cannot evaluate ${nothing()}: it has no value") {
+		tt.Fatalf("expected an error for an expression without a value, got: %v", err)
+	}
+}
+
+func TestRedact(tt *testing.T) {
+	var str = &interpreter.String{Secrets: []string{`it's "a\b"`}}
+	var testCases = []struct {
+		src  string
+		want string
+	}{
+		{src: `token=it's "a\b"`, want: `token=***`},
+		{src: `token="it's \"a\\b\""`, want: `token="***"`},
+		{src: `token='it\'s "a\\b"'`, want: `token='***'`},
+		{src: `token='it'\''s "a\b"'`, want: `token='***'`},
+		{src: `token="it's \"a\\b\""`, want: `token="***"`},
+	}
+
+	for ti, tc := range testCases {
+		if diff := cmp.Diff(tc.want, str.Redact(tc.src)); diff != "" {
+			tt.Fatalf("mismatching redact (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+// TestExitRedacts runs exit in a child process, because it exits.
+func TestExitRedacts(tt *testing.T) {
+	if os.Getenv("WELL_TEST_EXIT") == "1" {
+		var src = `function (stdin reader) | main() {
+  fail("token=${secret_env(\"WELL_TEST_TOKEN\"):%q}")
+}
+function fail(msg string) {
+  exit(3, msg)
+}
+`
+		var interp = interpreter.NewInterpreter(os.Stdout, os.Stderr)
+		var env = interpreter.NewEnvironment()
+		if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+			tt.Fatal(err)
+		}
+		if _, err := interp.Eval(strings.NewReader(src), env); err != nil {
+			tt.Fatal(err)
+		}
+		return
+	}
+
+	var cmd = exec.Command(os.Args[0], "-test.run=^TestExitRedacts$")
+	cmd.Env = append(os.Environ(), "WELL_TEST_EXIT=1", "WELL_TEST_TOKEN=hunter\"2")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var err = cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		tt.Fatalf("expected exit status 3, got: %v\nstderr: %s", err, stderr.String())
+	}
+	if diff := cmp.Diff("token=\"***\"\n", stderr.String()); diff != "" {
+		tt.Fatalf("mismatching stderr\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestInterpolationError(tt *testing.T) {
+	var src = `function (stdin reader) | main() {
+  let n = 0
+  println("total: ${10 / n}")
+}
+`
+	var interp = interpreter.NewInterpreter(io.Discard, io.Discard)
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	var _, err = interp.Eval(strings.NewReader(src), env)
+	if err == nil {
+		tt.Fatal("want an error")
+	}
+	var want = `  println("total: ${10 / n}")
+                       ⌃‾‾
+                       │
+                       ╰─── at line 3 column 24: division by zero`
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		tt.Fatalf("mismatching error\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
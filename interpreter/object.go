@@ -3,6 +3,9 @@ package interpreter
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/siadat/well/syntax/ast"
 )
@@ -33,12 +36,32 @@ type String struct {
 	// TODO: refactor this, so ugly
 	AsSingle string
 	AsArgs   []string
+
+	// Secrets are the secret values in the string. They are passed to
+	// external commands as they are, but masked everywhere else.
+	Secrets []string
 }
 
+// Mask replaces secret values in everything that is printed.
+const Mask = "***"
+
 type Boolean struct {
 	Value bool
 }
 
+// List is created with the list builtin. Interpolated outside a container,
+// each item is an argument of its own.
+type List struct {
+	Items []Object
+}
+
+// Record is created with the record builtin. Its fields are selected with a
+// dot, e.g. db.host, also in strings, e.g. "${db.host}".
+type Record struct {
+	Names  []string // in the order they were given
+	Fields map[string]Object
+}
+
 type ExtDecl struct {
 	Name string
 	Path string
@@ -64,9 +87,11 @@ var NoValue = struct{}{}
 func (i *Paren) String() string      { return fmt.Sprintf("%#v", i.Objects) }
 func (i *PipeStream) String() string { return fmt.Sprintf("%#v", i.ReadCloser) }
 func (i *Integer) String() string    { return fmt.Sprintf("%d", i.Value) }
-func (i *Float) String() string      { return fmt.Sprintf("%f", i.Value) }
-func (i *String) String() string     { return fmt.Sprintf("%s", i.AsSingle) }
+func (i *Float) String() string      { return strconv.FormatFloat(i.Value, 'f', -1, 64) }
+func (i *String) String() string     { return i.Redact(i.AsSingle) }
 func (i *Boolean) String() string    { return fmt.Sprintf("%v", i.Value) }
+func (i *List) String() string       { return listString(i) }
+func (i *Record) String() string     { return recordString(i) }
 func (i *ExtDecl) String() string    { return fmt.Sprintf("external %s %v", i.Name, i.Path) }
 func (i *Function) String() string   { return fmt.Sprintf("function %s", i.Name) }
 func (i *ReturnStmt) String() string { return fmt.Sprintf("retrun %s", i.Expr.String()) }
@@ -76,8 +101,10 @@ func (i *Paren) GoValue() interface{}      { return i.Objects }
 func (i *PipeStream) GoValue() interface{} { return nil /* internal? */ }
 func (i *Integer) GoValue() interface{}    { return i.Value }
 func (i *Float) GoValue() interface{}      { return i.Value }
-func (i *String) GoValue() interface{}     { return i.AsSingle }
+func (i *String) GoValue() interface{}     { return i.Redact(i.AsSingle) }
 func (i *Boolean) GoValue() interface{}    { return i.Value }
+func (i *List) GoValue() interface{}       { return listGoValue(i) }
+func (i *Record) GoValue() interface{}     { return recordGoValue(i) }
 func (i *ExtDecl) GoValue() interface{}    { return NoValue }
 func (i *Function) GoValue() interface{}   { return NoValue }
 func (i *ReturnStmt) GoValue() interface{} { return NoValue }
@@ -89,7 +116,105 @@ func (i *Integer) isObject()    {}
 func (i *Float) isObject()      {}
 func (i *String) isObject()     {}
 func (i *Boolean) isObject()    {}
+func (i *List) isObject()       {}
+func (i *Record) isObject()     {}
 func (i *ExtDecl) isObject()    {}
 func (i *Function) isObject()   {}
 func (i *ReturnStmt) isObject() {}
 func (i *Builtin) isObject()    {}
+
+// Redact returns s with the secrets of i replaced by Mask. The secrets are
+// also masked where they are escaped, e.g. after %q or in a container.
+func (i *String) Redact(s string) string {
+	for _, secret := range i.Secrets {
+		for _, form := range escapedForms(secret) {
+			s = strings.ReplaceAll(s, form, Mask)
+		}
+	}
+	return s
+}
+
+// escapedForms returns secret as it is and as it is escaped in the quotes
+// of Go, Basic single containers, and POSIX single and double quotes, the
+// longest first, so that an escaped form is masked before the parts of it
+// that are not escaped.
+func escapedForms(secret string) []string {
+	if secret == "" {
+		return nil
+	}
+	var quoted = strconv.Quote(secret)
+	var candidates = []string{
+		secret,
+		quoted[1 : len(quoted)-1],
+		strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(secret),
+		strings.ReplaceAll(secret, `'`, `'\''`),
+		strings.NewReplacer(`\`, `\\`, `$`, `\$`, "`", "\\`", `"`, `\"`).Replace(secret),
+	}
+	var forms []string
+	var seen = make(map[string]bool)
+	for _, form := range candidates {
+		if !seen[form] {
+			seen[form] = true
+			forms = append(forms, form)
+		}
+	}
+	sort.SliceStable(forms, func(a, b int) bool { return len(forms[a]) > len(forms[b]) })
+	return forms
+}
+
+// RedactArgs is like Redact for each argument.
+func (i *String) RedactArgs(args []string) []string {
+	if len(i.Secrets) == 0 {
+		return args
+	}
+	var redacted = make([]string, len(args))
+	for k, arg := range args {
+		redacted[k] = i.Redact(arg)
+	}
+	return redacted
+}
+
+func listString(l *List) string {
+	var items = make([]string, len(l.Items))
+	for k, item := range l.Items {
+		items[k] = item.String()
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func listGoValue(l *List) interface{} {
+	var items = make([]interface{}, len(l.Items))
+	for k, item := range l.Items {
+		items[k] = item.GoValue()
+	}
+	return items
+}
+
+func recordString(r *Record) string {
+	var fields = make([]string, len(r.Names))
+	for k, name := range r.Names {
+		fields[k] = name + "=" + r.Fields[name].String()
+	}
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+func recordGoValue(r *Record) interface{} {
+	var fields = make(map[string]interface{}, len(r.Fields))
+	for name, field := range r.Fields {
+		fields[name] = field.GoValue()
+	}
+	return fields
+}
+
+// selectField returns the field name of obj, which must be a record.
+func selectField(obj Object, name string) (Object, error) {
+	var record, ok = obj.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("cannot select field %s of %s, it is not a record", name, obj)
+	}
+	field, ok := record.Fields[name]
+	if !ok {
+		return nil, fmt.Errorf("the record has no field %s", name)
+	}
+	return field, nil
+}
@@ -0,0 +1,96 @@
+package interpreter
+
+import (
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/siadat/well/syntax/scanner"
+)
+
+type TraceKind int
+
+const (
+	TraceCall    TraceKind = iota // a Well function is called
+	TraceReturn                   // a Well function returns
+	TraceCommand                  // an external command exits
+)
+
+// TraceEvent describes a call, a return or an external command, see
+// SetTracer.
+type TraceEvent struct {
+	Kind  TraceKind
+	Depth int    // the number of active calls, including the call of the event
+	Name  string // the function, or the command
+
+	Args     []TraceArg       // the arguments of a call
+	Result   Object           // the returned value, nil if nothing is returned
+	Argv     []string         // the rendered arguments of a command
+	ExitCode int              // the exit code of a command, -1 if it was killed
+	Position scanner.Position // the position of a call, invalid for main
+
+	Time     time.Time     // when a call or a command starts, or when a function returns
+	Duration time.Duration // of a return or a command
+}
+
+type TraceArg struct {
+	Name  string
+	Value Object
+}
+
+// Tracer receives the events of an evaluation, e.g. to log them.
+type Tracer interface {
+	Trace(TraceEvent)
+}
+
+// SetTracer sets a tracer that is notified of every call and return of Well
+// functions and of every external command.
+func (interp *Interpreter) SetTracer(tracer Tracer) {
+	interp.tracer = tracer
+}
+
+func (interp *Interpreter) trace(event TraceEvent) {
+	if interp.tracer == nil {
+		return
+	}
+	interp.tracer.Trace(event)
+}
+
+// commandStream is the stdout of an external command. The command is waited
+// for when its output is read to the end or closed, and then the command
+// that writes to its stdin is waited for, if any. The output of a call whose
+// result is not used is read to the end by the statement.
+type commandStream struct {
+	file     io.ReadCloser
+	cmd      *exec.Cmd
+	upstream *commandStream
+	done     func(exitCode int)
+	once     sync.Once
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	var n, err = s.file.Read(p)
+	if err == io.EOF {
+		s.wait()
+	}
+	return n, err
+}
+
+func (s *commandStream) Close() error {
+	var err = s.file.Close()
+	s.wait()
+	return err
+}
+
+func (s *commandStream) wait() {
+	s.once.Do(func() {
+		s.cmd.Wait() // the exit code is in ProcessState
+		if s.upstream != nil {
+			// let the upstream command exit, even if its output was not read
+			// to the end
+			s.upstream.Close()
+		}
+		s.done(s.cmd.ProcessState.ExitCode())
+	})
+}
@@ -0,0 +1,341 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/siadat/well/diagnostics"
+	"github.com/siadat/well/syntax/ast"
+	"github.com/siadat/well/syntax/parser"
+	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/types"
+)
+
+type document struct {
+	uri  string
+	text []rune
+
+	// root is the syntax tree of the last version of the document that was
+	// parsed successfully, so that completion keeps working while the user
+	// is typing an incomplete statement.
+	root *ast.Root
+}
+
+// update replaces the text and returns its diagnostics.
+func (doc *document) update(text string, debug bool) []Diagnostic {
+	doc.text = []rune(text)
+
+	var p = parser.NewParser()
+	p.SetDebug(debug)
+	var root, parseErr = p.Parse(strings.NewReader(text))
+	if parseErr != nil {
+		return doc.diagnostics(parseErr)
+	}
+	doc.root = root
+
+	var checker = types.NewChecker()
+	checker.SetDebug(debug)
+	if _, err := checker.Check(strings.NewReader(text)); err != nil {
+		return doc.diagnostics(err)
+	}
+	return []Diagnostic{}
+}
+
+func (doc *document) diagnostics(err error) []Diagnostic {
+	var diags []Diagnostic
+	for _, d := range diagnostics.FromError(err) {
+		var end = d.End
+		if end == d.Pos && int(end) < len(doc.text) && doc.text[end] != '\n' {
+			end++ // highlight at least one character
+		}
+		var related []DiagnosticRelatedInformation
+		for _, r := range d.Related {
+			related = append(related, DiagnosticRelatedInformation{
+				Location: Location{URI: doc.uri, Range: Range{Start: doc.position(r.Pos), End: doc.position(r.End)}},
+				Message:  r.Message,
+			})
+		}
+		diags = append(diags, Diagnostic{
+			Range:              Range{Start: doc.position(d.Pos), End: doc.position(end)},
+			Severity:           severityError,
+			Source:             "well",
+			Message:            d.Message,
+			RelatedInformation: related,
+		})
+	}
+	return diags
+}
+
+// position converts a rune offset to a position in UTF-16 code units.
+func (doc *document) position(pos scanner.Pos) Position {
+	var position Position
+	for i := 0; i < int(pos) && i < len(doc.text); i++ {
+		if doc.text[i] == '\n' {
+			position.Line++
+			position.Character = 0
+		} else {
+			position.Character += len(utf16.Encode([]rune{doc.text[i]}))
+		}
+	}
+	return position
+}
+
+// offset converts a position in UTF-16 code units to a rune offset.
+func (doc *document) offset(position Position) scanner.Pos {
+	var line, character = 0, 0
+	for i, r := range doc.text {
+		if line == position.Line && character >= position.Character {
+			return scanner.Pos(i)
+		}
+		if r == '\n' {
+			if line == position.Line {
+				return scanner.Pos(i) // past the end of the line
+			}
+			line++
+			character = 0
+		} else if line == position.Line {
+			character += len(utf16.Encode([]rune{r}))
+		}
+	}
+	return scanner.Pos(len(doc.text))
+}
+
+func (doc *document) rangeOf(pos scanner.Pos, name string) Range {
+	return Range{
+		Start: doc.position(pos),
+		End:   doc.position(pos + scanner.Pos(len([]rune(name)))),
+	}
+}
+
+// identAt returns the identifier that contains the offset.
+func (doc *document) identAt(offset scanner.Pos) *ast.Ident {
+	var found *ast.Ident
+	ast.Inspect(doc.root, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			if ident.Position <= offset && offset <= ident.Position+scanner.Pos(len([]rune(ident.Name))) {
+				found = ident
+			}
+		}
+		return found == nil
+	})
+	return found
+}
+
+// enclosingFunc returns the function declaration whose body contains the
+// offset.
+func (doc *document) enclosingFunc(offset scanner.Pos) *ast.FuncDecl {
+	for _, decl := range doc.root.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && !funcDecl.IsExternal {
+			if funcDecl.Position <= offset && offset <= funcDecl.Body.Rbrace {
+				return funcDecl
+			}
+		}
+	}
+	return nil
+}
+
+// binding is something a name can refer to.
+type binding struct {
+	name     string
+	position scanner.Pos
+	funcDecl *ast.FuncDecl         // if it is a function
+	arg      *ast.FuncSignatureArg // if it is an argument
+	letDecl  *ast.LetDecl          // if it is a let
+}
+
+// scope returns the bindings visible at the offset. Later bindings shadow
+// earlier ones with the same name.
+func (doc *document) scope(offset scanner.Pos) []binding {
+	var bindings []binding
+	for _, decl := range doc.root.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			bindings = append(bindings, binding{name: decl.Name.Name, position: decl.Name.Position, funcDecl: decl})
+		case *ast.LetDecl:
+			bindings = append(bindings, binding{name: decl.Name.Name, position: decl.Name.Position, letDecl: decl})
+		}
+	}
+
+	var funcDecl = doc.enclosingFunc(offset)
+	if funcDecl == nil {
+		return bindings
+	}
+	for _, args := range [][]ast.FuncSignatureArg{funcDecl.Signature.PipedArgs, funcDecl.Signature.Args} {
+		for i := range args {
+			bindings = append(bindings, binding{name: args[i].Name, position: args[i].Position, arg: &args[i]})
+		}
+	}
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		if letDecl, ok := node.(*ast.LetDecl); ok && doc.declaredBefore(letDecl, offset) {
+			bindings = append(bindings, binding{name: letDecl.Name.Name, position: letDecl.Name.Position, letDecl: letDecl})
+		}
+		return true
+	})
+	return bindings
+}
+
+// declaredBefore reports whether the let can be used at the offset, which
+// is after the end of the let, so that its own right hand side is excluded.
+// The name of the let is included, so that it resolves to itself.
+func (doc *document) declaredBefore(letDecl *ast.LetDecl, offset scanner.Pos) bool {
+	if offset < letDecl.Name.Position {
+		return false
+	}
+	return offset <= letDecl.Name.End() || offset > letDecl.End()
+}
+
+func (doc *document) lookup(name string, offset scanner.Pos) *binding {
+	var bindings = doc.scope(offset)
+	for i := len(bindings) - 1; i >= 0; i-- {
+		if bindings[i].name == name {
+			return &bindings[i]
+		}
+	}
+	return nil
+}
+
+func (doc *document) definition(position Position) *Location {
+	if doc.root == nil {
+		return nil
+	}
+	var offset = doc.offset(position)
+	var ident = doc.identAt(offset)
+	if ident == nil {
+		return nil
+	}
+	var b = doc.lookup(ident.Name, offset)
+	if b == nil {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: doc.rangeOf(b.position, b.name)}
+}
+
+func (doc *document) hover(position Position, builtins []string) *Hover {
+	if doc.root == nil {
+		return nil
+	}
+	var offset = doc.offset(position)
+	var ident = doc.identAt(offset)
+	if ident == nil {
+		return nil
+	}
+
+	var value string
+	if b := doc.lookup(ident.Name, offset); b != nil {
+		switch {
+		case b.funcDecl != nil:
+			value = signature(b.funcDecl)
+		case b.arg != nil:
+			value = fmt.Sprintf("%s %s", b.arg.Name, b.arg.Type)
+		case b.letDecl != nil:
+			value = fmt.Sprintf("let %s", b.letDecl.Name.Name)
+		}
+	} else if contains(builtins, ident.Name) {
+		value = fmt.Sprintf("builtin %s", ident.Name)
+	} else {
+		return nil
+	}
+
+	var r = doc.rangeOf(ident.Position, ident.Name)
+	return &Hover{
+		Contents: MarkupContent{Kind: markupKindMarkdown, Value: "```well\n" + value + "\n```"},
+		Range:    &r,
+	}
+}
+
+func (doc *document) completion(position Position, builtins []string) []CompletionItem {
+	var offset = doc.offset(position)
+	var items = []CompletionItem{}
+
+	// ${...} inside strings only refers to variables
+	var i = int(offset) - 1
+	for i >= 0 && isIdentRune(doc.text[i]) {
+		i--
+	}
+	var inVar = i >= 1 && doc.text[i] == '{' && doc.text[i-1] == '$'
+
+	if doc.root != nil {
+		var seen = make(map[string]bool)
+		var bindings = doc.scope(offset)
+		for i := len(bindings) - 1; i >= 0; i-- {
+			var b = bindings[i]
+			if seen[b.name] {
+				continue
+			}
+			seen[b.name] = true
+			switch {
+			case b.funcDecl != nil:
+				if !inVar {
+					items = append(items, CompletionItem{Label: b.name, Kind: completionKindFunction, Detail: signature(b.funcDecl)})
+				}
+			case b.arg != nil:
+				items = append(items, CompletionItem{Label: b.name, Kind: completionKindVariable, Detail: b.arg.Type})
+			default:
+				items = append(items, CompletionItem{Label: b.name, Kind: completionKindVariable})
+			}
+		}
+	}
+
+	if !inVar {
+		for _, name := range builtins {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindFunction, Detail: "builtin"})
+		}
+	}
+	return items
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signature returns the declaration of a function without its body.
+func signature(funcDecl *ast.FuncDecl) string {
+	var formatArgs = func(args []ast.FuncSignatureArg) string {
+		var formatted []string
+		for _, arg := range args {
+			formatted = append(formatted, fmt.Sprintf("%s %s", arg.Name, arg.Type))
+		}
+		return "(" + strings.Join(formatted, ", ") + ")"
+	}
+
+	var s strings.Builder
+	if funcDecl.IsExternal {
+		s.WriteString("external ")
+	} else {
+		s.WriteString("function ")
+	}
+	if len(funcDecl.Signature.PipedArgs) > 0 {
+		s.WriteString(formatArgs(funcDecl.Signature.PipedArgs) + " | ")
+	}
+	s.WriteString(funcDecl.Name.Name + formatArgs(funcDecl.Signature.Args))
+
+	if funcDecl.IsExternal {
+		if template, ok := funcDecl.Template().(*ast.String); ok {
+			s.WriteString(" => " + template.StringLit)
+		}
+		return s.String()
+	}
+	switch rets := funcDecl.Signature.RetTypes; len(rets) {
+	case 0:
+	case 1:
+		s.WriteString(" " + rets[0])
+	default:
+		s.WriteString(" (" + strings.Join(rets, ", ") + ")")
+	}
+	return s.String()
+}
+
+// end returns the position after the last character.
+func (doc *document) end() Position {
+	return doc.position(scanner.Pos(len(doc.text)))
+}
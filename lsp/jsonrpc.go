@@ -0,0 +1,45 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// readMessage reads one message with its "Content-Length" header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	var header, err = textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	var length = header.Get("Content-Length")
+	if length == "" {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header %q", length)
+	}
+
+	var body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = "2.0"
+	var body, err = json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
@@ -0,0 +1,321 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/lsp"
+)
+
+// client is a minimal JSON-RPC client that talks to an in-process server.
+type client struct {
+	tt            *testing.T
+	w             io.Writer
+	r             *bufio.Reader
+	nextID        int
+	notifications []rpcMessage
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (c *client) write(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	var body, err = json.Marshal(msg)
+	if err != nil {
+		c.tt.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.tt.Fatal(err)
+	}
+}
+
+func (c *client) read() rpcMessage {
+	var header, err = textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.tt.Fatal(err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.tt.Fatal(err)
+	}
+	var body = make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.tt.Fatal(err)
+	}
+	var msg rpcMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.tt.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) call(method string, params any, result any) {
+	c.nextID++
+	var id = c.nextID
+	c.write(rpcMessage{ID: &id, Method: method, Params: mustMarshal(c.tt, params)})
+	for {
+		var msg = c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if *msg.ID != id {
+			c.tt.Fatalf("expected response %d, got %d", id, *msg.ID)
+		}
+		if msg.Error != nil {
+			c.tt.Fatalf("%s failed: %s", method, msg.Error.Message)
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.tt.Fatalf("%s returned %s: %v", method, msg.Result, err)
+		}
+		return
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.write(rpcMessage{Method: method, Params: mustMarshal(c.tt, params)})
+}
+
+// diagnostics reads the diagnostics published after a notification.
+func (c *client) diagnostics() lsp.PublishDiagnosticsParams {
+	var msg = c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.tt.Fatalf("expected diagnostics, got %+v", msg)
+	}
+	var params lsp.PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.tt.Fatal(err)
+	}
+	return params
+}
+
+func mustMarshal(tt *testing.T, v any) json.RawMessage {
+	var b, err = json.Marshal(v)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	return b
+}
+
+const uri = "file:///tmp/test.well"
+
+func TestServer(tt *testing.T) {
+	var serverIn, clientOut = io.Pipe()
+	var clientIn, serverOut = io.Pipe()
+
+	var done = make(chan error)
+	go func() {
+		done <- lsp.NewServer().Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	var c = &client{tt: tt, w: clientOut, r: bufio.NewReader(clientIn)}
+
+	var initResult lsp.InitializeResult
+	c.call("initialize", map[string]any{"capabilities": map[string]any{}}, &initResult)
+	if !initResult.Capabilities.DefinitionProvider || !initResult.Capabilities.DocumentFormattingProvider {
+		tt.Fatalf("missing capabilities: %+v", initResult.Capabilities)
+	}
+	c.notify("initialized", map[string]any{})
+
+	// Parse errors are reported
+	c.notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "well", Version: 1, Text: "function main() {\n\tlet x = \n}\n"},
+	})
+	var diags = c.diagnostics()
+	if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Range.Start != (lsp.Position{Line: 1, Character: 9}) {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	// Fixing the error clears the diagnostics. The emoji is 2 UTF-16 code
+	// units long, but 1 rune.
+	var src = "external echo(s string) => \"echo ${s}\"\n" +
+		"\n" +
+		"function greet(name string) {\n" +
+		"\tlet greeting = \"😀 hello ${name}\"\n" +
+		"\tprint_stream(echo(\"😀\", greeting))\n" +
+		"}\n"
+	c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: src}},
+	})
+	diags = c.diagnostics()
+	if len(diags.Diagnostics) != 0 {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	// Go to the definition of greeting, after the emoji
+	var location lsp.Location
+	c.call("textDocument/definition", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 4, Character: 25},
+	}, &location)
+	var wantLocation = lsp.Location{URI: uri, Range: lsp.Range{Start: lsp.Position{Line: 3, Character: 5}, End: lsp.Position{Line: 3, Character: 13}}}
+	if diff := cmp.Diff(wantLocation, location); diff != "" {
+		tt.Fatalf("mismatching definition\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	// Go to the definition of an argument
+	c.call("textDocument/definition", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 4, Character: 15},
+	}, &location)
+	wantLocation = lsp.Location{URI: uri, Range: lsp.Range{Start: lsp.Position{Line: 0, Character: 9}, End: lsp.Position{Line: 0, Character: 13}}}
+	if diff := cmp.Diff(wantLocation, location); diff != "" {
+		tt.Fatalf("mismatching definition\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	// Hover shows the signature
+	var hover lsp.Hover
+	c.call("textDocument/hover", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 4, Character: 15},
+	}, &hover)
+	if want := "```well\nexternal echo(s string) => \"echo ${s}\"\n```"; hover.Contents.Value != want {
+		tt.Fatalf("expected hover %q, got %q", want, hover.Contents.Value)
+	}
+
+	// Completion of builtins and declared functions
+	var items []lsp.CompletionItem
+	c.call("textDocument/completion", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 4, Character: 1},
+	}, &items)
+	if labels := completionLabels(items); !labels["println"] || !labels["echo"] || !labels["greeting"] {
+		tt.Fatalf("unexpected completion items: %+v", items)
+	}
+
+	// Completion inside ${...} only offers variables
+	c.call("textDocument/completion", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 3, Character: 28},
+	}, &items)
+	if diff := cmp.Diff(map[string]bool{"name": true}, completionLabels(items)); diff != "" {
+		tt.Fatalf("mismatching completion items\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	// Formatting replaces the whole document
+	c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "let  x=\"😀\"\n"}},
+	})
+	c.diagnostics()
+	var edits []lsp.TextEdit
+	c.call("textDocument/formatting", lsp.DocumentFormattingParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &edits)
+	var wantEdits = []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 1, Character: 0}},
+		NewText: "let x = \"😀\"\n",
+	}}
+	if diff := cmp.Diff(wantEdits, edits); diff != "" {
+		tt.Fatalf("mismatching edits\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	// Closing clears the diagnostics
+	c.notify("textDocument/didClose", lsp.DidCloseTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	})
+	if diags = c.diagnostics(); diags.URI != uri || len(diags.Diagnostics) != 0 {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	var shutdownResult any
+	c.call("shutdown", nil, &shutdownResult)
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		tt.Fatalf("serve failed: %v", err)
+	}
+	if len(c.notifications) != 0 {
+		tt.Fatalf("unexpected notifications: %+v", c.notifications)
+	}
+}
+
+func TestUnterminatedString(tt *testing.T) {
+	var serverIn, clientOut = io.Pipe()
+	var clientIn, serverOut = io.Pipe()
+
+	var done = make(chan error)
+	go func() {
+		done <- lsp.NewServer().Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	var c = &client{tt: tt, w: clientOut, r: bufio.NewReader(clientIn)}
+	var initResult lsp.InitializeResult
+	c.call("initialize", map[string]any{"capabilities": map[string]any{}}, &initResult)
+	c.notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "well", Version: 1, Text: "function main() {\n\tlet x = 1\n}\n"},
+	})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	// the user types an opening quote
+	c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "function main() {\n\tlet x = \"1\n}\n"}},
+	})
+	var diags = c.diagnostics()
+	if len(diags.Diagnostics) == 0 || diags.Diagnostics[0].Range.Start != (lsp.Position{Line: 1, Character: 9}) || diags.Diagnostics[0].Message != `unterminated string, expected "` {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	// the server still answers, with the last document that was parsed
+	var items []lsp.CompletionItem
+	c.call("textDocument/completion", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 2, Character: 0},
+	}, &items)
+	if labels := completionLabels(items); !labels["main"] {
+		tt.Fatalf("unexpected completion items: %+v", items)
+	}
+
+	// an unclosed container points at its opener
+	c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "let x = \"echo «a\"\n"}},
+	})
+	diags = c.diagnostics()
+	var wantRelated = []lsp.DiagnosticRelatedInformation{{
+		Location: lsp.Location{URI: uri, Range: lsp.Range{Start: lsp.Position{Line: 0, Character: 14}, End: lsp.Position{Line: 0, Character: 15}}},
+		Message:  "« is opened here",
+	}}
+	if len(diags.Diagnostics) != 1 {
+		tt.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+	if diff := cmp.Diff(wantRelated, diags.Diagnostics[0].RelatedInformation); diff != "" {
+		tt.Fatalf("mismatching related information\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+
+	var shutdownResult any
+	c.call("shutdown", nil, &shutdownResult)
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		tt.Fatalf("serve failed: %v", err)
+	}
+}
+
+func completionLabels(items []lsp.CompletionItem) map[string]bool {
+	var labels = make(map[string]bool)
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+	return labels
+}
@@ -0,0 +1,258 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/siadat/well/fumt"
+	"github.com/siadat/well/interpreter"
+)
+
+// This package implements a language server for Well files. It speaks
+// JSON-RPC with Content-Length headers, usually over stdio, and handles one
+// message at a time. Documents are synchronized in full on every change.
+
+type server struct {
+	out      io.Writer
+	docs     map[string]*document
+	builtins []string
+	shutdown bool
+	debug    bool
+}
+
+func NewServer() *server {
+	return &server{
+		docs:     make(map[string]*document),
+		builtins: interpreter.NewInterpreter(io.Discard, io.Discard).BuiltinNames(),
+	}
+}
+
+func (s *server) SetDebug(v bool) {
+	s.debug = v
+}
+
+// Serve handles the messages read from in until the client sends the exit
+// notification or closes in.
+func (s *server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	var r = bufio.NewReader(in)
+	for {
+		var body, err = readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s.debug {
+			fmt.Fprintf(os.Stderr, "[lsp] <- %s\n", body)
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.reply(nil, nil, &responseError{codeParseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+
+		var result, respErr = s.handle(msg.Method, msg.Params)
+		if msg.ID == nil {
+			// notifications have no response
+			if respErr != nil && s.debug {
+				fmt.Fprintf(os.Stderr, "[lsp] %s: %s\n", msg.Method, respErr)
+			}
+			continue
+		}
+		if err := s.reply(msg.ID, result, respErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) reply(id *json.RawMessage, result any, respErr *responseError) error {
+	var msg = &message{ID: id, Error: respErr}
+	if respErr == nil {
+		var b, err = json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = b
+	}
+	return s.send(msg)
+}
+
+func (s *server) notify(method string, params any) error {
+	var b, err = json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(&message{Method: method, Params: b})
+}
+
+func (s *server) send(msg *message) error {
+	if s.debug {
+		var b, _ = json.Marshal(msg)
+		fmt.Fprintf(os.Stderr, "[lsp] -> %s\n", b)
+	}
+	return writeMessage(s.out, msg)
+}
+
+func (s *server) handle(method string, params json.RawMessage) (result any, respErr *responseError) {
+	// a bug that panics on one document must not stop the server
+	defer func() {
+		if r := recover(); r != nil {
+			result, respErr = nil, &responseError{codeInternalError, fmt.Sprintf("%s failed: %v", method, r)}
+		}
+	}()
+
+	if s.shutdown && method != "exit" {
+		return nil, &responseError{codeInvalidRequest, "the server is shut down"}
+	}
+
+	switch method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:           textDocumentSyncFull,
+				DefinitionProvider:         true,
+				HoverProvider:              true,
+				CompletionProvider:         &CompletionOptions{TriggerCharacters: []string{"{"}},
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "well"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc = &document{uri: p.TextDocument.URI}
+		s.docs[doc.uri] = doc
+		return nil, s.publishDiagnostics(doc.uri, doc.update(p.TextDocument.Text, s.debug))
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc, respErr = s.document(p.TextDocument.URI)
+		if respErr != nil {
+			return nil, respErr
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		var text = p.ContentChanges[len(p.ContentChanges)-1].Text
+		return nil, s.publishDiagnostics(doc.uri, doc.update(text, s.debug))
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.publishDiagnostics(p.TextDocument.URI, []Diagnostic{})
+	case "textDocument/definition":
+		var p TextDocumentPositionParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc, respErr = s.document(p.TextDocument.URI)
+		if respErr != nil {
+			return nil, respErr
+		}
+		return doc.definition(p.Position), nil
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc, respErr = s.document(p.TextDocument.URI)
+		if respErr != nil {
+			return nil, respErr
+		}
+		return doc.hover(p.Position, s.builtins), nil
+	case "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc, respErr = s.document(p.TextDocument.URI)
+		if respErr != nil {
+			return nil, respErr
+		}
+		return doc.completion(p.Position, s.builtins), nil
+	case "textDocument/formatting":
+		var p DocumentFormattingParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		var doc, respErr = s.document(p.TextDocument.URI)
+		if respErr != nil {
+			return nil, respErr
+		}
+		return s.format(doc)
+	default:
+		return nil, &responseError{codeMethodNotFound, fmt.Sprintf("method %q is not supported", method)}
+	}
+}
+
+func unmarshalParams(params json.RawMessage, v any) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *server) document(uri string) (*document, *responseError) {
+	var doc, ok = s.docs[uri]
+	if !ok {
+		return nil, &responseError{codeInvalidParams, fmt.Sprintf("document %s is not open", uri)}
+	}
+	return doc, nil
+}
+
+func (s *server) publishDiagnostics(uri string, diagnostics []Diagnostic) *responseError {
+	var err = s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+	if err != nil {
+		return &responseError{codeInternalError, err.Error()}
+	}
+	return nil
+}
+
+// format returns a single edit that replaces the whole document, or no edits
+// if it is already formatted.
+func (s *server) format(doc *document) ([]TextEdit, *responseError) {
+	var formater = fumt.NewFormater()
+	formater.SetDebug(s.debug)
+	var buf bytes.Buffer
+	if err := formater.Format(strings.NewReader(string(doc.text)), &buf); err != nil {
+		return nil, &responseError{codeInternalError, err.Error()}
+	}
+	if buf.String() == string(doc.text) {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: doc.end()},
+		NewText: buf.String(),
+	}}, nil
+}
@@ -61,6 +61,27 @@ func PrintInfo(str string) {
 
 type ValMap map[string]interface{}
 
+// Secret is a value of a ValMap that is passed to commands as it is, but
+// masked in the logs and errors.
+type Secret string
+
+const SecretMask = "***"
+
+func (s Secret) String() string {
+	return SecretMask
+}
+
+// revealSecrets returns a mapping of env in which secrets are not masked.
+func revealSecrets(env ValMap) func(string) interface{} {
+	var mapping = expander.MappingFuncFromMap(env)
+	return func(name string) interface{} {
+		if secret, ok := mapping(name).(Secret); ok {
+			return string(secret)
+		}
+		return mapping(name)
+	}
+}
+
 func expand_str(str string, mapping func(string) string) string {
 	var re = regexp.MustCompile(`\${\w+}|@+{\w+}`)
 	return re.ReplaceAllStringFunc(str, func(s string) string {
@@ -86,7 +107,7 @@ func expand_str(str string, mapping func(string) string) string {
 }
 
 func Interpolate(str string, env ValMap) string {
-	var s, err = expander.ParseAndEncodeToString(str, expander.MappingFuncFromMap(env), false)
+	var s, err = expander.ParseAndEncodeToString(str, expander.MappingFuncFromMap(env), expander.Basic, false)
 	if err != nil {
 		panic(fmt.Sprintf("test case failed src=%q: %v", str, err))
 	}
@@ -195,7 +216,7 @@ func externalPiped(env ValMap, strs Pipe, opts ...Options) string {
 	var stdouts = make([]bytes.Buffer, len(strs))
 	var stderrs = make([]bytes.Buffer, len(strs))
 	var first_words []string
-	var all_words = make([][]string, len(strs))
+	var all_words = make([][]string, len(strs)) // with secrets masked
 	for i := range cmds {
 		var str = strs[i]
 
@@ -204,19 +225,24 @@ func externalPiped(env ValMap, strs Pipe, opts ...Options) string {
 		if err != nil {
 			Exit(fmt.Sprintf("parsing command failed str=%q: %v", str, err))
 		}
-		var words, encodeErr = expander.EncodeToCmdArgs(node, expander.MappingFuncFromMap(env))
+		var words, encodeErr = expander.EncodeToCmdArgs(node, revealSecrets(env))
 		if encodeErr != nil {
 			Exit(fmt.Sprintf("failed to create args: %s", encodeErr))
 			return ""
 		}
+		var masked_words, maskErr = expander.EncodeToCmdArgs(node, expander.MappingFuncFromMap(env))
+		if maskErr != nil {
+			Exit(fmt.Sprintf("failed to create args: %s", maskErr))
+			return ""
+		}
 		// var words = strings.SplitN(str, " ", -1)
 
 		if len(words) < 1 {
 			Exit(fmt.Sprintf("expected at least 1 word in command; got in %d", len(words)))
 			return ""
 		}
-		all_words[i] = words
-		first_words = append(first_words, words[0])
+		all_words[i] = masked_words
+		first_words = append(first_words, masked_words[0])
 		// ctx = context.WithValue(ctx, "words", words)
 
 		stdin_closers[i] = os.Stdin
@@ -320,9 +346,9 @@ func externalPiped(env ValMap, strs Pipe, opts ...Options) string {
 					// were piping to is closed. That's fine, because that
 					// process might have finished its job. E.g. in `yes | head`
 					// head exits faster than yes.
-					fmt.Println("SIGPIPE received by", cmd)
+					fmt.Println("SIGPIPE received by", all_words[i])
 				} else {
-					Exit(fmt.Sprintf("command %q failed: %v", cmd, cmd_err))
+					Exit(fmt.Sprintf("command %q failed: %v", all_words[i], cmd_err))
 				}
 			}
 		}(i, cmd)
@@ -346,6 +372,8 @@ func ExternalPipedTrimmed(env ValMap, strs Pipe) string {
 	return externalPiped(env, strs, Options{TrimSpaces: true})
 }
 
+// External runs str and returns its stdout. It exits if the command fails,
+// the cmd package returns the errors instead.
 func External(env ValMap, str string) string {
 	return externalPiped(env, Pipe{str})
 }
@@ -1,7 +1,6 @@
 package piper
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -20,95 +19,139 @@ type external struct {
 	pipeline []string
 }
 
-func (ext *external) Read(stdout, stderr io.Writer) (retErr error) {
-	var ctx = context.TODO()
-
-	var cmds = make([]*exec.Cmd, len(ext.pipeline))
-	var stdin_closers = make([]io.WriteCloser, len(ext.pipeline))
-	var stdouts = make([]io.Writer, len(ext.pipeline))
-	var stderrs = make([]io.Writer, len(ext.pipeline))
-	for i := range ext.pipeline {
-		stdouts[i] = &bytes.Buffer{}
-		stderrs[i] = &bytes.Buffer{}
-	}
-	stdouts[len(stdouts)-1] = stdout
-	stderrs[len(stderrs)-1] = stderr
-
+// Read runs the pipeline, with os.Stdin as the stdin of the first command.
+func (ext *external) Read(stdout, stderr io.Writer) error {
 	var all_words = make([][]string, len(ext.pipeline))
 
 	for i, cmdStr := range ext.pipeline {
 		var p = parser.NewParser()
 		var node, err = p.Parse(strings.NewReader(cmdStr))
 		if err != nil {
-			panic(fmt.Sprintf("parsing command failed str=%q: %v", cmdStr, err))
+			return fmt.Errorf("parsing command failed str=%q: %v", cmdStr, err)
 		}
 		var words, encodeErr = expander.EncodeToCmdArgs(node, nil)
 		if encodeErr != nil {
-			panic(fmt.Sprintf("parsing command failed str=%q: %v", cmdStr, err))
+			return fmt.Errorf("failed to create args str=%q: %v", cmdStr, encodeErr)
 		}
 		// var words = strings.SplitN(cmdStr, " ", -1)
 
 		if len(words) < 1 {
-			panic(fmt.Sprintf("expected at least 1 word in command; got in %d", len(words)))
+			return fmt.Errorf("expected at least 1 word in command; got in %d", len(words))
 		}
 		all_words[i] = words
+	}
+
+	return Run(all_words, os.Stdin, stdout, stderr)
+}
+
+// Run runs a pipeline of commands, each given as its arguments. stdin is the
+// stdin of the first command, the stdout of each command is the stdin of the
+// next one, and stdout is the stdout of the last one. All commands write
+// their errors to stderr. Like bash with set -o pipefail, it returns the
+// error of the last command that fails, except for the broken pipes of
+// commands whose readers exited early.
+func Run(all_words [][]string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return RunContext(context.TODO(), all_words, stdin, stdout, stderr)
+}
+
+// RunContext is like Run, the commands are killed if ctx is done before
+// they exit.
+func RunContext(ctx context.Context, all_words [][]string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var cmds = make([]*exec.Cmd, len(all_words))
+	// the ends of the pipes between the commands, the parent closes them
+	// once the commands started, so that a reader sees EOF when its writer
+	// exits and a writer gets SIGPIPE when its reader exits.
+	var pipe_files []*os.File
+	defer func() {
+		for _, f := range pipe_files {
+			f.Close()
+		}
+	}()
+
+	// the commands write to stdout and stderr concurrently
+	var mu sync.Mutex
+	stdout = lockWriter(stdout, &mu)
+	stderr = lockWriter(stderr, &mu)
 
-		stdin_closers[i] = os.Stdin
+	for i, words := range all_words {
+		if len(words) < 1 {
+			return fmt.Errorf("expected at least 1 word in command %d of the pipeline", i+1)
+		}
 		cmds[i] = exec.CommandContext(ctx, words[0], words[1:]...)
-		cmds[i].Stdout = stdouts[i]
-		cmds[i].Stderr = stderrs[i]
+		cmds[i].Stdout = stdout
+		cmds[i].Stderr = stderr
 		if i == 0 {
-			cmds[i].Stdin = os.Stdin
-			// fmt.Printf("[debug] connecting stdin of %v to os.Stdin\n", cmds[i])
+			cmds[i].Stdin = stdin
 		}
 		if i > 0 {
-			var wc, pipe_err2 = cmds[i].StdinPipe()
-			if pipe_err2 != nil {
-				panic(pipe_err2)
+			var pr, pw, pipe_err = os.Pipe()
+			if pipe_err != nil {
+				return pipe_err
 			}
-			stdin_closers[i] = wc
-			cmds[i-1].Stdout = io.MultiWriter(wc, stdouts[i-1])
-			// fmt.Printf("[debug] connecting stdout of %v to stdin of %v\n", cmds[i-1], cmds[i])
+			pipe_files = append(pipe_files, pr, pw)
+			cmds[i].Stdin = pr
+			cmds[i-1].Stdout = pw
 		}
 	}
 
-	var wg sync.WaitGroup
+	var errs = make([]error, len(cmds))
+	var started = 0
 	for i, cmd := range cmds {
-		if retErr != nil {
-			return
+		if err := cmd.Start(); err != nil {
+			errs[i] = fmt.Errorf("%s: %w", strings.Join(cmd.Args, " "), err)
+			break
 		}
-		wg.Add(1)
-		go func(i int, cmd *exec.Cmd) {
-			defer func() {
-				// fmt.Println("[debug] finished", cmd)
-				wg.Done()
-				if i != len(cmds)-1 {
-					// TODO: what if it is already closed?
-					defer stdin_closers[i+1].Close()
-				}
-			}()
-
-			// fmt.Println("[debug] running", cmd)
-			if err := cmd.Run(); err != nil {
-				if err != nil {
-					// TODO: nicer errors, eg yaml
-					if strings.Contains(err.Error(), SigpipeErrorMessage) {
-						// Fine, no-op :)
-						// broken pipe just means that the stdin of the process we
-						// were piping to is closed. That's fine, because that
-						// process might have finished its job. E.g. in `yes | head`
-						// head exits faster than yes.
-						// fmt.Println("[debug] SIGPIPE received by", cmd)
-					} else {
-						retErr = err
-						return
-					}
-				}
+		started++
+	}
+	for _, f := range pipe_files {
+		f.Close()
+	}
+	pipe_files = nil
+
+	for i, cmd := range cmds[:started] {
+		if err := cmd.Wait(); err != nil {
+			// TODO: nicer errors, eg yaml
+			if strings.Contains(err.Error(), SigpipeErrorMessage) {
+				// Fine, no-op :)
+				// broken pipe just means that the stdin of the process we
+				// were piping to is closed. That's fine, because that
+				// process might have finished its job. E.g. in `yes | head`
+				// head exits faster than yes.
+				continue
 			}
-		}(i, cmd)
+			errs[i] = fmt.Errorf("%s: %w", strings.Join(cmd.Args, " "), err)
+		}
+	}
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i] != nil {
+			return errs[i]
+		}
+	}
+	return nil
+}
+
+// lockedWriter is a writer that is shared by the commands of a pipeline.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// lockWriter returns w guarded by mu. Files are returned as is, so that the
+// commands write to them directly, e.g. to see if stdout is a terminal.
+func lockWriter(w io.Writer, mu *sync.Mutex) io.Writer {
+	if w == nil {
+		return nil
+	}
+	if _, ok := w.(*os.File); ok {
+		return w
 	}
-	wg.Wait()
-	return
+	return &lockedWriter{mu: mu, w: w}
 }
 
 func (ext *external) External(cmd string) *external {
@@ -117,6 +160,8 @@ func (ext *external) External(cmd string) *external {
 	}
 }
 
+// External returns the pipeline of cmds. The cmd package builds pipelines
+// with variables.
 func External(cmds ...string) *external {
 	return &external{
 		pipeline: cmds,
@@ -0,0 +1,323 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/siadat/well/interpreter"
+	"github.com/siadat/well/syntax/ast"
+	"github.com/siadat/well/syntax/parser"
+	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/syntax/token"
+	"github.com/siadat/well/types"
+)
+
+// This package implements the read-eval-print loop of "well repl". Every
+// input is parsed, type checked and evaluated in one persistent environment,
+// so that the declarations of earlier inputs can be used by later ones.
+
+const (
+	prompt             = "well> "
+	continuationPrompt = "....> "
+)
+
+const help = `Enter declarations (let, function, external, requires) or expressions.
+Inputs with unclosed braces or parentheses continue on the next line.
+
+Commands:
+  :type expr   print the type of an expression without evaluating it
+  :env         print the variables and functions that are defined
+  :load file   evaluate the declarations of a Well file, main is not called
+  :help        print this help
+  :quit        exit, same as end of input
+`
+
+var declKeywords = map[string]bool{
+	"let":      true,
+	"function": true,
+	"external": true,
+	"requires": true,
+}
+
+type checker interface {
+	CheckNode(*parser.Parser, ast.Node) (map[ast.Expr]types.Type, error)
+	SetDebug(bool)
+}
+
+type repl struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	interp      *interpreter.Interpreter
+	env         interpreter.Environment
+	predeclared map[string]bool
+	checker     checker
+	fset        *scanner.FileSet
+	inputs      int
+	debug       bool
+}
+
+func NewRepl(stdout, stderr io.Writer) *repl {
+	var checker = types.NewChecker()
+	var env = interpreter.NewEnvironment()
+	var predeclared = make(map[string]bool)
+	for _, name := range env.Names() {
+		predeclared[name] = true
+	}
+	return &repl{
+		stdout:      stdout,
+		stderr:      stderr,
+		interp:      interpreter.NewInterpreter(stdout, stderr),
+		env:         env,
+		predeclared: predeclared,
+		checker:     &checker,
+		fset:        scanner.NewFileSet(),
+	}
+}
+
+func (r *repl) SetDebug(v bool) {
+	r.debug = v
+	r.interp.SetDebug(v)
+	r.checker.SetDebug(v)
+}
+
+// Run reads inputs from in until the end of in or ":quit". Errors in the
+// inputs are written to stderr, they do not stop the loop.
+func (r *repl) Run(in io.Reader) error {
+	var lines = bufio.NewScanner(in)
+	var input strings.Builder
+
+	fmt.Fprint(r.stdout, prompt)
+	for lines.Scan() {
+		input.WriteString(lines.Text())
+		input.WriteString("\n")
+		if incomplete(input.String()) {
+			fmt.Fprint(r.stdout, continuationPrompt)
+			continue
+		}
+
+		var src = input.String()
+		input.Reset()
+		if strings.TrimSpace(src) == ":quit" {
+			return nil
+		}
+		if err := r.Eval(src); err != nil {
+			fmt.Fprintln(r.stderr, err)
+		}
+		fmt.Fprint(r.stdout, prompt)
+	}
+	if err := lines.Err(); err != nil {
+		return err
+	}
+
+	// report the errors of an incomplete input
+	if strings.TrimSpace(input.String()) != "" {
+		if err := r.Eval(input.String()); err != nil {
+			fmt.Fprintln(r.stderr, err)
+		}
+	}
+	fmt.Fprintln(r.stdout)
+	return nil
+}
+
+// Eval evaluates a complete input and prints the value of expressions.
+func (r *repl) Eval(src string) (err error) {
+	defer func() {
+		// a bug in the interpreter should not end the session
+		if e := recover(); e != nil {
+			err = fmt.Errorf("internal error: %v", e)
+		}
+	}()
+
+	var trimmed = strings.TrimSpace(src)
+	switch {
+	case trimmed == "":
+		return nil
+	case strings.HasPrefix(trimmed, ":"):
+		return r.command(trimmed)
+	case isDecl(src):
+		return r.evalDecls(r.nextName(), src)
+	default:
+		var obj, err = r.evalExpr(src)
+		if err != nil {
+			return err
+		}
+		return r.print(obj)
+	}
+}
+
+func (r *repl) command(line string) error {
+	var name, arg = line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	switch name {
+	case ":type":
+		if arg == "" {
+			return fmt.Errorf("usage: :type expr")
+		}
+		var p, expr, err = r.parseExpr(arg)
+		if err != nil {
+			return err
+		}
+		typs, err := r.checker.CheckNode(p, expr)
+		if err != nil {
+			return err
+		}
+		var typ, ok = typs[expr]
+		if !ok {
+			fmt.Fprintln(r.stdout, "unknown")
+			return nil
+		}
+		fmt.Fprintln(r.stdout, typ)
+		return nil
+	case ":env":
+		for _, name := range r.env.Names() {
+			if r.predeclared[name] {
+				continue
+			}
+			var obj, err = r.env.Get(name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(r.stdout, "%s = %s\n", name, format(obj))
+		}
+		return nil
+	case ":load":
+		if arg == "" {
+			return fmt.Errorf("usage: :load file.well")
+		}
+		var src, err = os.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		return r.evalDecls(arg, string(src))
+	case ":help":
+		fmt.Fprint(r.stdout, help)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s, see :help", name)
+	}
+}
+
+func (r *repl) evalDecls(filename string, src string) error {
+	var p = parser.NewParser()
+	p.SetDebug(r.debug)
+	var root, err = p.ParseFile(r.fset, filename, strings.NewReader(src))
+	if err != nil {
+		return err
+	}
+	if _, err := r.checker.CheckNode(p, root); err != nil {
+		return err
+	}
+	for _, decl := range root.Decls {
+		if _, err := r.interp.EvalNode(p, decl, r.env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repl) evalExpr(src string) (interpreter.Object, error) {
+	var p, expr, err = r.parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.checker.CheckNode(p, expr); err != nil {
+		return nil, err
+	}
+	return r.interp.EvalNode(p, expr, r.env)
+}
+
+func (r *repl) parseExpr(src string) (*parser.Parser, ast.Expr, error) {
+	var p = parser.NewParser()
+	p.SetDebug(r.debug)
+	var expr, err = p.ParseExprFile(r.fset, r.nextName(), strings.NewReader(src))
+	return p, expr, err
+}
+
+// nextName returns the file name of the next input.
+func (r *repl) nextName() string {
+	r.inputs += 1
+	return fmt.Sprintf("<input %d>", r.inputs)
+}
+
+// print writes the value of an expression. The output of external commands
+// is copied as it is.
+func (r *repl) print(obj interpreter.Object) error {
+	switch obj := obj.(type) {
+	case nil:
+		return nil
+	case *interpreter.PipeStream:
+		defer obj.ReadCloser.Close()
+		var _, err = io.Copy(r.stdout, obj.ReadCloser)
+		return err
+	default:
+		var _, err = fmt.Fprintln(r.stdout, format(obj))
+		return err
+	}
+}
+
+// format returns strings quoted, so that they are not mistaken for numbers.
+func format(obj interpreter.Object) string {
+	switch obj := obj.(type) {
+	case *interpreter.String:
+		return fmt.Sprintf("%q", obj.String())
+	case *interpreter.PipeStream:
+		return "stream"
+	default:
+		return obj.String()
+	}
+}
+
+// isDecl reports whether src starts with a declaration keyword.
+func isDecl(src string) bool {
+	var s = scanner.NewScanner(strings.NewReader(src))
+	s.SetSkipWhitespace(true)
+	for {
+		var t, err = s.NextToken()
+		if err != nil {
+			return false
+		}
+		switch t.Typ {
+		case token.NEWLINE:
+			continue
+		case token.IDENTIFIER:
+			return declKeywords[t.Lit]
+		default:
+			return false
+		}
+	}
+}
+
+// incomplete reports whether src has unclosed braces, parentheses or raw
+// strings, in which case more lines are read before src is evaluated.
+func incomplete(src string) bool {
+	var s = scanner.NewScanner(strings.NewReader(src))
+	s.SetSkipWhitespace(true)
+	var depth = 0
+	for {
+		var t, err = s.NextToken()
+		if err != nil {
+			// a raw string can have newlines, the scanner only fails on
+			// an unterminated string at the end of the input
+			if t.Typ == token.ILLEGAL && strings.HasPrefix(t.Lit, "`") {
+				return true
+			}
+			// let the parser report it
+			return false
+		}
+		switch t.Typ {
+		case token.LBRACE, token.LPAREN:
+			depth += 1
+		case token.RBRACE, token.RPAREN:
+			depth -= 1
+		case token.EOF:
+			return depth > 0
+		}
+	}
+}
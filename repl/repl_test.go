@@ -0,0 +1,89 @@
+package repl_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/repl"
+)
+
+func TestRepl(tt *testing.T) {
+	var testCases = []struct {
+		input      string
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			input: "let x = 42\nx\n\"x is ${x}\"\n",
+			wantStdout: "well> " +
+				"well> 42\n" +
+				"well> \"x is 42\"\n" +
+				"well> \n",
+		},
+		{
+			input: "function f(a string) string {\n  return a\n}\nf(\"hi\")\n:type f\n:type 1.5\n:env\n",
+			wantStdout: "well> " +
+				"....> ....> well> \"hi\"\n" +
+				"well> Function\n" +
+				"well> Float\n" +
+				"well> f = function f\n" +
+				"well> \n",
+		},
+		{
+			input: "external greet(s string) => \"echo hello ${s}\"\ngreet(\"world\")\n",
+			wantStdout: "well> " +
+				"well> hello world\n" +
+				"well> \n",
+		},
+		{
+			input: "nope\n:quit\n1\n",
+			wantStdout: "well> " +
+				"well> ",
+			wantStderr: "nope\n" +
+				"⌃‾‾‾\n" +
+				"│\n" +
+				"╰─── at line 1 column 1: \"nope\" is missing: undefined object \"nope\"\n",
+		},
+		{
+			input: "let s = `a\nb`\ns\n",
+			wantStdout: "well> " +
+				"....> well> \"a\\nb\"\n" +
+				"well> \n",
+		},
+		{
+			input: "let x = \"abc\n",
+			wantStdout: "well> " +
+				"well> \n",
+			wantStderr: "parsing failed:\n" +
+				"let x = \"abc\n" +
+				"        ⌃\n" +
+				"        │\n" +
+				"        ╰─── at line 1 column 9: unterminated string, expected \"\n",
+		},
+		{
+			input: "let y = (\n",
+			wantStdout: "well> " +
+				"....> \n",
+			wantStderr: "parsing failed:\n" +
+				"\n" +
+				"⌃\n" +
+				"│\n" +
+				"╰─── at line 2 column 1: failed to parse primary expression, got EOF(:AnyLit:) at 10\n",
+		},
+	}
+	for i, tc := range testCases {
+		var stdout, stderr bytes.Buffer
+		var r = repl.NewRepl(&stdout, &stderr)
+		if err := r.Run(strings.NewReader(tc.input)); err != nil {
+			tt.Fatalf("test case %d failed: %s", i, err)
+		}
+		if diff := cmp.Diff(tc.wantStdout, stdout.String()); diff != "" {
+			tt.Fatalf("mismatching stdout (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+		if diff := cmp.Diff(tc.wantStderr, stderr.String()); diff != "" {
+			tt.Fatalf("mismatching stderr (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+	}
+}
@@ -7,12 +7,23 @@ import (
 )
 
 type Root struct {
-	Decls []Decl
+	Decls    []Decl
+	Comments []*Comment    // only set if the parser includes comments
+	File     *scanner.File // the positions of the nodes are in this file
+}
+
+// Comment is a // comment, including the slashes
+type Comment struct {
+	Text string
+
+	Position scanner.Pos
 }
 
 type FuncSignatureArg struct {
 	Name string
 	Type string
+
+	Position scanner.Pos
 }
 
 type FuncSignature struct {
@@ -21,6 +32,7 @@ type FuncSignature struct {
 	RetTypes  []string
 
 	Position scanner.Pos
+	EndPos   scanner.Pos // after the closing parenthesis or the return type
 }
 
 type LetDecl struct {
@@ -39,6 +51,19 @@ type FuncDecl struct {
 	Position scanner.Pos
 }
 
+// RequiresDecl declares a dependency of the program, e.g.
+//
+//	requires file "config.yaml"
+//	requires command "docker"
+type RequiresDecl struct {
+	Kind string // "file" or "command"
+	Name string
+	Lit  string
+
+	Position scanner.Pos
+	LitPos   scanner.Pos
+}
+
 type ExprStmt struct {
 	X Expr
 
@@ -62,6 +87,7 @@ type IfStmt struct {
 type BlockStmt struct {
 	Statements []Stmt
 	Position   scanner.Pos
+	Rbrace     scanner.Pos
 }
 
 type BinaryExpr struct {
@@ -82,6 +108,25 @@ type UnaryExpr struct {
 type ParenExpr struct {
 	Exprs []Expr
 
+	Position scanner.Pos
+	Rparen   scanner.Pos
+}
+
+// IndexExpr is an item of a list, e.g. args[0]
+type IndexExpr struct {
+	X     Expr
+	Index Expr
+
+	Position scanner.Pos
+	Lbrack   scanner.Pos
+	Rbrack   scanner.Pos
+}
+
+// SelectorExpr is a field of a record, e.g. db.host
+type SelectorExpr struct {
+	X   Expr
+	Sel *Ident
+
 	Position scanner.Pos
 }
 
@@ -110,20 +155,30 @@ type Ident struct {
 }
 
 type String struct {
-	Root      *strs_parser.Root
-	StringLit string
+	Root           *strs_parser.Root
+	StringLit      string
+	Interpolations []Interpolation // the expressions in the template, e.g. ${count + 1}
 
 	Position scanner.Pos
 }
 
+// Interpolation is an expression interpolated in a string. Its positions are
+// in the source of the string literal.
+type Interpolation struct {
+	Src string // the source between ${ and the flags, as it is in the template
+	X   Expr
+}
+
 type Integer struct {
 	Value int
+	Lit   string
 
 	Position scanner.Pos
 }
 
 type Float struct {
 	Value float64
+	Lit   string
 
 	Position scanner.Pos
 }
@@ -131,6 +186,7 @@ type Float struct {
 type Node interface {
 	node()
 	Pos() scanner.Pos
+	End() scanner.Pos // the position right after the node
 }
 
 type Expr interface {
@@ -149,8 +205,10 @@ type Decl interface {
 }
 
 func (*Root) node()          {}
+func (*Comment) node()       {}
 func (*LetDecl) node()       {}
 func (*FuncDecl) node()      {}
+func (*RequiresDecl) node()  {}
 func (*FuncSignature) node() {}
 func (*ExprStmt) node()      {}
 func (*ReturnStmt) node()    {}
@@ -163,13 +221,17 @@ func (*Float) node()         {}
 func (*BinaryExpr) node()    {}
 func (*UnaryExpr) node()     {}
 func (*ParenExpr) node()     {}
+func (*IndexExpr) node()     {}
+func (*SelectorExpr) node()  {}
 func (*AssignExpr) node()    {}
 func (*File) node()          {}
 func (*CallExpr) node()      {}
 
 func (e *Root) Pos() scanner.Pos          { return -1 }
+func (e *Comment) Pos() scanner.Pos       { return e.Position }
 func (e *LetDecl) Pos() scanner.Pos       { return e.Position }
 func (e *FuncDecl) Pos() scanner.Pos      { return e.Position }
+func (e *RequiresDecl) Pos() scanner.Pos  { return e.Position }
 func (e *FuncSignature) Pos() scanner.Pos { return e.Position }
 func (e *ExprStmt) Pos() scanner.Pos      { return e.Position }
 func (e *ReturnStmt) Pos() scanner.Pos    { return e.Position }
@@ -182,26 +244,99 @@ func (e *Float) Pos() scanner.Pos         { return e.Position }
 func (e *BinaryExpr) Pos() scanner.Pos    { return e.Position }
 func (e *UnaryExpr) Pos() scanner.Pos     { return e.Position }
 func (e *ParenExpr) Pos() scanner.Pos     { return e.Position }
+func (e *IndexExpr) Pos() scanner.Pos     { return e.Position }
+func (e *SelectorExpr) Pos() scanner.Pos  { return e.Position }
 func (e *AssignExpr) Pos() scanner.Pos    { return e.Position }
 func (e *File) Pos() scanner.Pos          { return -1 }
 func (e *CallExpr) Pos() scanner.Pos      { return e.Position }
 
-func (*Ident) expr()      {}
-func (*Integer) expr()    {}
-func (*String) expr()     {}
-func (*Float) expr()      {}
-func (*BinaryExpr) expr() {}
-func (*UnaryExpr) expr()  {}
-func (*ParenExpr) expr()  {}
-func (*AssignExpr) expr() {}
-func (*File) expr()       {}
-func (*CallExpr) expr()   {}
+// lenPos returns the position after s, if s starts at pos.
+func lenPos(pos scanner.Pos, s string) scanner.Pos {
+	return pos + scanner.Pos(len([]rune(s)))
+}
 
-func (*LetDecl) decl()  {}
-func (*FuncDecl) decl() {}
+func (e *Root) End() scanner.Pos {
+	if len(e.Decls) == 0 {
+		return -1
+	}
+	return e.Decls[len(e.Decls)-1].End()
+}
+func (e *Comment) End() scanner.Pos { return lenPos(e.Position, e.Text) }
+func (e *LetDecl) End() scanner.Pos { return e.Rhs.End() }
+func (e *FuncDecl) End() scanner.Pos {
+	if e.IsExternal {
+		if template := e.Template(); template != nil {
+			return template.End()
+		}
+	}
+	return e.Body.End()
+}
+func (e *RequiresDecl) End() scanner.Pos  { return lenPos(e.LitPos, e.Lit) }
+func (e *FuncSignature) End() scanner.Pos { return e.EndPos }
+func (e *ExprStmt) End() scanner.Pos      { return e.X.End() }
+func (e *ReturnStmt) End() scanner.Pos {
+	if e.Expr == nil {
+		return lenPos(e.Position, "return")
+	}
+	return e.Expr.End()
+}
+func (e *IfStmt) End() scanner.Pos {
+	if e.Else != nil {
+		return e.Else.End()
+	}
+	return e.Body.End()
+}
+func (e *BlockStmt) End() scanner.Pos    { return e.Rbrace + 1 }
+func (e *Ident) End() scanner.Pos        { return lenPos(e.Position, e.Name) }
+func (e *Integer) End() scanner.Pos      { return lenPos(e.Position, e.Lit) }
+func (e *String) End() scanner.Pos       { return lenPos(e.Position, e.StringLit) }
+func (e *Float) End() scanner.Pos        { return lenPos(e.Position, e.Lit) }
+func (e *BinaryExpr) End() scanner.Pos   { return e.Y.End() }
+func (e *UnaryExpr) End() scanner.Pos    { return e.X.End() }
+func (e *ParenExpr) End() scanner.Pos    { return e.Rparen + 1 }
+func (e *IndexExpr) End() scanner.Pos    { return e.Rbrack + 1 }
+func (e *SelectorExpr) End() scanner.Pos { return e.Sel.End() }
+func (e *AssignExpr) End() scanner.Pos   { return e.Expr.End() }
+func (e *File) End() scanner.Pos         { return -1 }
+func (e *CallExpr) End() scanner.Pos     { return e.Arg.End() }
+
+func (*Ident) expr()        {}
+func (*Integer) expr()      {}
+func (*String) expr()       {}
+func (*Float) expr()        {}
+func (*BinaryExpr) expr()   {}
+func (*UnaryExpr) expr()    {}
+func (*ParenExpr) expr()    {}
+func (*IndexExpr) expr()    {}
+func (*SelectorExpr) expr() {}
+func (*AssignExpr) expr()   {}
+func (*File) expr()         {}
+func (*CallExpr) expr()     {}
+
+func (*LetDecl) decl()      {}
+func (*FuncDecl) decl()     {}
+func (*RequiresDecl) decl() {}
 
 func (*LetDecl) stmt()    {}
 func (*ExprStmt) stmt()   {}
 func (*ReturnStmt) stmt() {}
 func (*IfStmt) stmt()     {}
 func (*BlockStmt) stmt()  {}
+
+// Template returns the command expression of an external function, i.e. the
+// expression on the right hand side of "=>". It returns nil for non-external
+// functions.
+func (e *FuncDecl) Template() Expr {
+	if !e.IsExternal || e.Body == nil || len(e.Body.Statements) != 1 {
+		return nil
+	}
+	var ret, ok = e.Body.Statements[0].(*ReturnStmt)
+	if !ok {
+		return nil
+	}
+	var call, isCall = ret.Expr.(*CallExpr)
+	if !isCall || len(call.Arg.Exprs) != 1 {
+		return nil
+	}
+	return call.Arg.Exprs[0]
+}
@@ -0,0 +1,78 @@
+package ast
+
+// Inspect traverses the tree in depth-first order. It calls f(node) for each
+// node, and visits the children of the node only if f returns true.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Root:
+		for _, decl := range node.Decls {
+			Inspect(decl, f)
+		}
+	case *LetDecl:
+		Inspect(node.Name, f)
+		Inspect(node.Rhs, f)
+	case *FuncDecl:
+		Inspect(node.Name, f)
+		Inspect(node.Signature, f)
+		Inspect(node.Body, f)
+	case *ExprStmt:
+		Inspect(node.X, f)
+	case *ReturnStmt:
+		Inspect(node.Expr, f)
+	case *IfStmt:
+		Inspect(node.Cond, f)
+		Inspect(node.Body, f)
+		Inspect(node.Else, f)
+	case *BlockStmt:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *BinaryExpr:
+		Inspect(node.X, f)
+		Inspect(node.Y, f)
+	case *UnaryExpr:
+		Inspect(node.X, f)
+	case *ParenExpr:
+		for _, expr := range node.Exprs {
+			Inspect(expr, f)
+		}
+	case *IndexExpr:
+		Inspect(node.X, f)
+		Inspect(node.Index, f)
+	case *SelectorExpr:
+		Inspect(node.X, f)
+		Inspect(node.Sel, f)
+	case *String:
+		for _, interpolation := range node.Interpolations {
+			Inspect(interpolation.X, f)
+		}
+	case *CallExpr:
+		Inspect(node.Fun, f)
+		Inspect(node.Arg, f)
+		Inspect(node.PipedArg, f)
+	case *AssignExpr:
+		Inspect(node.Expr, f)
+	}
+}
+
+// isNil reports whether node is nil, or a nil pointer stored in the
+// interface, e.g. the PipedArg of a call without piped arguments.
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *ParenExpr:
+		return node == nil
+	case *BlockStmt:
+		return node == nil
+	case *FuncSignature:
+		return node == nil
+	case *Ident:
+		return node == nil
+	}
+	return false
+}
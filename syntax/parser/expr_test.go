@@ -10,6 +10,7 @@ import (
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/parser"
 	"github.com/siadat/well/syntax/scanner"
+	strs_parser "github.com/siadat/well/syntax/strs/parser"
 	"github.com/siadat/well/syntax/token"
 )
 
@@ -21,23 +22,23 @@ func TestParseExpr(tt *testing.T) {
 		{
 			src: `1 + 2 * 3 * 4 + 5`,
 			want: &ast.BinaryExpr{
-				X: &ast.Integer{Value: 1},
-				Y: &ast.BinaryExpr{
-					X: &ast.BinaryExpr{
-						X: &ast.Integer{Value: 2, Position: IgnorePos},
-						Y: &ast.BinaryExpr{
-							X:        &ast.Integer{Value: 3, Position: IgnorePos},
-							Y:        &ast.Integer{Value: 4, Position: IgnorePos},
+				X: &ast.BinaryExpr{
+					X: &ast.Integer{Value: 1, Lit: "1"},
+					Y: &ast.BinaryExpr{
+						X: &ast.BinaryExpr{
+							X:        &ast.Integer{Value: 2, Lit: "2", Position: IgnorePos},
+							Y:        &ast.Integer{Value: 3, Lit: "3", Position: IgnorePos},
 							Op:       token.MUL,
 							Position: IgnorePos,
 						},
+						Y:        &ast.Integer{Value: 4, Lit: "4", Position: IgnorePos},
 						Op:       token.MUL,
 						Position: IgnorePos,
 					},
-					Y:        &ast.Integer{Value: 5, Position: IgnorePos},
 					Op:       token.ADD,
 					Position: IgnorePos,
 				},
+				Y:        &ast.Integer{Value: 5, Lit: "5", Position: IgnorePos},
 				Op:       token.ADD,
 				Position: IgnorePos,
 			},
@@ -46,26 +47,66 @@ func TestParseExpr(tt *testing.T) {
 			src: `1 * 2 + 3 + 4 * 5`,
 			want: &ast.BinaryExpr{
 				X: &ast.BinaryExpr{
-					X:        &ast.Integer{Value: 1},
-					Y:        &ast.Integer{Value: 2, Position: IgnorePos},
-					Op:       token.MUL,
-					Position: IgnorePos,
-				},
-				Y: &ast.BinaryExpr{
-					X: &ast.Integer{Value: 3, Position: IgnorePos},
-					Y: &ast.BinaryExpr{
-						X:        &ast.Integer{Value: 4, Position: IgnorePos},
-						Y:        &ast.Integer{Value: 5, Position: IgnorePos},
+					X: &ast.BinaryExpr{
+						X:        &ast.Integer{Value: 1, Lit: "1"},
+						Y:        &ast.Integer{Value: 2, Lit: "2", Position: IgnorePos},
 						Op:       token.MUL,
 						Position: IgnorePos,
 					},
+					Y:        &ast.Integer{Value: 3, Lit: "3", Position: IgnorePos},
 					Op:       token.ADD,
 					Position: IgnorePos,
 				},
+				Y: &ast.BinaryExpr{
+					X:        &ast.Integer{Value: 4, Lit: "4", Position: IgnorePos},
+					Y:        &ast.Integer{Value: 5, Lit: "5", Position: IgnorePos},
+					Op:       token.MUL,
+					Position: IgnorePos,
+				},
 				Op:       token.ADD,
 				Position: IgnorePos,
 			},
 		},
+		{
+			src: `10 - 3 - 2`,
+			want: &ast.BinaryExpr{
+				X: &ast.BinaryExpr{
+					X:        &ast.Integer{Value: 10, Lit: "10"},
+					Y:        &ast.Integer{Value: 3, Lit: "3", Position: 5},
+					Op:       token.SUB,
+					Position: 3,
+				},
+				Y:        &ast.Integer{Value: 2, Lit: "2", Position: 9},
+				Op:       token.SUB,
+				Position: 7,
+			},
+		},
+		{
+			src: `args[i + 1]`,
+			want: &ast.IndexExpr{
+				X: &ast.Ident{Name: "args"},
+				Index: &ast.BinaryExpr{
+					X:        &ast.Ident{Name: "i", Position: 5},
+					Y:        &ast.Integer{Value: 1, Lit: "1", Position: 9},
+					Op:       token.ADD,
+					Position: 7,
+				},
+				Lbrack: 4,
+				Rbrack: 10,
+			},
+		},
+		{
+			src: `db.port + 1`,
+			want: &ast.BinaryExpr{
+				X: &ast.SelectorExpr{
+					X:   &ast.Ident{Name: "db"},
+					Sel: &ast.Ident{Name: "port", Position: 3},
+				},
+				Y:        &ast.Integer{Value: 1, Lit: "1", Position: 10},
+				Op:       token.ADD,
+				Position: 8,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -86,3 +127,68 @@ func TestParseExpr(tt *testing.T) {
 		}
 	}
 }
+
+func TestExprEnd(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want scanner.Pos
+	}{
+		{`1 + 2 * 3`, 9},
+		{`-1.5`, 4},
+		{`x ~~ "«ö»"`, 10},
+		{`(a, b)`, 6},
+		{`f("x", 1)`, 9},
+		{`f() | g()`, 9},
+		{`xs[0]`, 5},
+	}
+	for i, tc := range testCases {
+		var got, err = parser.NewParser().ParseExpr(strings.NewReader(tc.src))
+		if err != nil {
+			tt.Fatalf("test case %d failed: %s", i, err)
+		}
+		if diff := cmp.Diff(tc.want, got.End()); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+	}
+}
+
+func TestParseInterpolations(tt *testing.T) {
+	var src = `"a ${n * 2} \"${f(\"x\")}\" ${n * 2}"`
+	var got, err = parser.NewParser().ParseExpr(strings.NewReader(src))
+	if err != nil {
+		tt.Fatalf("parsing failed: %s", err)
+	}
+	var want = []ast.Interpolation{
+		{
+			Src: "n * 2",
+			X: &ast.BinaryExpr{
+				X:        &ast.Ident{Name: "n", Position: 5},
+				Y:        &ast.Integer{Value: 2, Lit: "2", Position: 9},
+				Op:       token.MUL,
+				Position: 7,
+			},
+		},
+		{
+			Src: `f("x")`,
+			X: &ast.CallExpr{
+				Fun: &ast.Ident{Name: "f", Position: 16},
+				Arg: &ast.ParenExpr{
+					Exprs: []ast.Expr{
+						&ast.String{
+							Root:      &strs_parser.Root{Items: []strs_parser.CmdNode{strs_parser.Wrd{Lit: "x"}}},
+							StringLit: `"x"`,
+							Position:  18,
+						},
+					},
+					Position: 17,
+					Rparen:   23,
+				},
+				PipedArg: &ast.ParenExpr{Position: 16, Rparen: 16},
+				Position: 16,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got.(*ast.String).Interpolations); diff != "" {
+		tt.Fatalf("mismatching results\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
@@ -1,15 +1,19 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/siadat/well/diagnostics"
 	"github.com/siadat/well/erroring"
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/scanner"
 	strs_parser "github.com/siadat/well/syntax/strs/parser"
+	strs_scanner "github.com/siadat/well/syntax/strs/scanner"
 	"github.com/siadat/well/syntax/token"
 )
 
@@ -19,6 +23,10 @@ type Parser struct {
 	scanner         *scanner.Scanner
 	debug           bool
 	includeComments bool
+	comments        []*ast.Comment
+	errors          ErrorList
+	prevTyp         token.Token // the type of the token before the current one
+	prevEnd         scanner.Pos // the end of the token before the current one
 }
 
 type ParseError struct {
@@ -29,24 +37,122 @@ func (e ParseError) Error() string {
 	return e.err.Error()
 }
 
+func (e ParseError) Unwrap() error {
+	return e.err
+}
+
+// strError is a syntax error in the template of a string literal. Its
+// positions are in the .well source.
+type strError struct {
+	msg    string
+	pos    scanner.Pos
+	opener scanner.Pos // the unclosed «, ‹, " or ', or -1
+	ch     rune        // the rune at opener
+}
+
+func (e strError) Error() string {
+	return e.msg
+}
+
+// Error is a syntax error. Its message marks the position in the source,
+// the other fields are there for tools that show errors differently, e.g.
+// editors.
+type Error struct {
+	Filename string
+	Pos      scanner.Pos
+	End      scanner.Pos // the end of the offending token
+	Line     int         // 1-based
+	Column   int         // 1-based, in runes
+	Msg      string
+
+	marked     string
+	diagnostic diagnostics.Diagnostic
+}
+
+func (e Error) Error() string {
+	return e.marked
+}
+
+func (e Error) Diagnostics() []diagnostics.Diagnostic {
+	return []diagnostics.Diagnostic{e.diagnostic}
+}
+
+// ErrorList is returned by Parse, it contains all syntax errors in the order
+// they appear in the source.
+type ErrorList []Error
+
+func (list ErrorList) Error() string {
+	var marked []string
+	for _, e := range list {
+		marked = append(marked, e.marked)
+	}
+	return fmt.Sprintf("parsing failed:\n%s", strings.Join(marked, "\n"))
+}
+
+func (list ErrorList) Diagnostics() []diagnostics.Diagnostic {
+	var diags []diagnostics.Diagnostic
+	for _, e := range list {
+		diags = append(diags, e.diagnostic)
+	}
+	return diags
+}
+
+// newError returns an error at the current token.
+func (p *Parser) newError(msg string) Error {
+	var t = p.scanner.CurrToken()
+	var end = t.Pos
+	if t.Typ != token.EOF {
+		end += scanner.Pos(len([]rune(t.Lit)))
+	}
+	return p.newErrorAt(t.Pos, end, msg)
+}
+
+// newErrorAt returns an error at pos, whose offending token ends at end.
+func (p *Parser) newErrorAt(pos, end scanner.Pos, msg string) Error {
+	var line, column = p.GetLineColAt(pos)
+	var d = diagnostics.New(diagnostics.CodeSyntax, pos, end, p.GetLineColAt, msg)
+	d.File = p.scanner.File().Name()
+	return Error{
+		Filename: d.File,
+		Pos:      pos,
+		End:      end,
+		Line:     line + 1,
+		Column:   column + 1,
+		Msg:      msg,
+		marked:   strings.Join(p.MarkAt(pos, msg, false), "\n"),
+
+		diagnostic: d,
+	}
+}
+
+// newStrError returns the error of a template, which also marks the
+// unclosed opener, if any.
+func (p *Parser) newStrError(e strError) Error {
+	var err = p.newErrorAt(e.pos, e.pos+1, e.msg)
+	if e.opener >= 0 {
+		var msg = fmt.Sprintf("%c is opened here", e.ch)
+		err.marked += "\n" + strings.Join(p.MarkAt(e.opener, msg, false), "\n")
+		err.diagnostic.Related = append(err.diagnostic.Related, diagnostics.NewRelated(e.opener, e.opener+1, p.GetLineColAt, msg))
+	}
+	return err
+}
+
 func (p *Parser) proceed() scanner.Token {
+	var prev = p.scanner.CurrToken()
+	p.prevTyp = prev.Typ
+	p.prevEnd = prev.Pos + scanner.Pos(len([]rune(prev.Lit)))
 	var t, err = p.scanner.NextToken()
 	p.checkErr(err)
 
-	if p.includeComments {
-		return t
-	}
-
-For:
-	for {
-		// This is experimental, not tested
-		switch t.Typ {
-		case token.COMMENT:
-			t, err = p.scanner.NextToken()
-			p.checkErr(err)
-		default:
-			break For
-		}
+	// Comments are not part of the syntax tree, they are collected
+	// separately, e.g. for the formatter.
+	for t.Typ == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{
+			Text:     t.Lit,
+			Position: t.Pos,
+		})
+		t, err = p.scanner.NextToken()
+		p.checkErr(err)
 	}
 
 	return t
@@ -56,6 +162,11 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// File returns the file being parsed.
+func (p *Parser) File() *scanner.File {
+	return p.scanner.File()
+}
+
 func (p *Parser) GetLineColAt(pos scanner.Pos) (int, int) {
 	return p.scanner.GetLineColAt(pos)
 }
@@ -68,8 +179,15 @@ func (p *Parser) MarkAt(at scanner.Pos, msg string, showWhitespaces bool) []stri
 	return p.scanner.MarkAt(at, msg, showWhitespaces)
 }
 
-func (p *Parser) init(src io.Reader) error {
-	p.scanner = scanner.NewScanner(src)
+func (p *Parser) MarkSpan(at, end scanner.Pos, msg string, showWhitespaces bool) []string {
+	return p.scanner.MarkSpan(at, end, msg, showWhitespaces)
+}
+
+func (p *Parser) init(fset *scanner.FileSet, filename string, src io.Reader) error {
+	p.comments = nil
+	p.errors = nil
+	p.prevTyp = token.NEWLINE
+	p.scanner = scanner.NewFileScanner(fset, filename, src)
 	p.scanner.SetSkipWhitespace(true)
 	p.scanner.SetIncludeComments(p.includeComments)
 	p.scanner.SetDebug(p.debug)
@@ -93,46 +211,127 @@ func (p *Parser) SetDebug(debug bool) {
 	}
 }
 
+// Parse parses a Well file. If there are syntax errors, it returns an
+// ErrorList and the declarations that could be parsed.
 func (p *Parser) Parse(src io.Reader) (*ast.Root, error) {
-	if err := p.init(src); err != nil {
+	return p.ParseFile(scanner.NewFileSet(), "", src)
+}
+
+// ParseFile is like Parse, but it adds the file to fset, so that positions
+// in the AST and in errors identify the file.
+func (p *Parser) ParseFile(fset *scanner.FileSet, filename string, src io.Reader) (*ast.Root, error) {
+	if err := p.init(fset, filename, src); err != nil {
 		return nil, err
 	}
 
-	var result, err = erroring.CallAndRecover[ParseError](func() *ast.Root {
-		return &ast.Root{Decls: p.parseDecls()}
-	})
-	if err != nil {
-		var lines = p.Mark(err.Error(), false)
-		return nil, fmt.Errorf("parsing failed:\n%s", strings.Join(lines, "\n"))
+	var decls = p.parseDecls()
+	var root = &ast.Root{Decls: decls, Comments: p.comments, File: p.scanner.File()}
+	if len(p.errors) > 0 {
+		return root, p.errors
 	}
-	return result, nil
+	return root, nil
 }
 
+// ParseExpr parses a single expression, optionally followed by newlines.
 func (p *Parser) ParseExpr(src io.Reader) (ast.Expr, error) {
-	if err := p.init(src); err != nil {
+	return p.ParseExprFile(scanner.NewFileSet(), "", src)
+}
+
+// ParseExprFile is like ParseExpr, but it adds the source to fset.
+func (p *Parser) ParseExprFile(fset *scanner.FileSet, filename string, src io.Reader) (ast.Expr, error) {
+	if err := p.init(fset, filename, src); err != nil {
 		return nil, err
 	}
 
 	var result, err = erroring.CallAndRecover[ParseError](func() ast.Expr {
-		return p.parseExpr(nil, token.LowestPrecedence)
+		var expr = p.parseExpr(nil, token.LowestPrecedence)
+		for p.scanner.CurrToken().Typ == token.NEWLINE {
+			p.proceed()
+		}
+		if t := p.scanner.CurrToken(); t.Typ != token.EOF {
+			panic(ParseError{fmt.Errorf("unexpected %s after the expression", t)})
+		}
+		return expr
 	})
 	if err != nil {
-		var lines = p.Mark(err.Error(), false)
-		return nil, fmt.Errorf("parsing expression failed: %s", strings.Join(lines, "\n"))
+		var e = p.errorOf(err)
+		e.marked = fmt.Sprintf("parsing expression failed: %s", e.marked)
+		return nil, e
 	}
 	return result, nil
 }
 
+// errorOf returns the Error of a recovered ParseError.
+func (p *Parser) errorOf(err error) Error {
+	var serr strError
+	if errors.As(err, &serr) {
+		return p.newStrError(serr)
+	}
+	return p.newError(err.Error())
+}
+
+// recoverable calls f, and records the error if f fails. It reports whether
+// f succeeded.
+func (p *Parser) recoverable(f func()) bool {
+	var _, err = erroring.CallAndRecover[ParseError](func() struct{} {
+		f()
+		return struct{}{}
+	})
+	if err != nil {
+		p.errors = append(p.errors, p.errorOf(err))
+		return false
+	}
+	return true
+}
+
+// atDeclStart reports whether the current token starts a top level
+// declaration at the beginning of a line.
+func (p *Parser) atDeclStart(keywords ...string) bool {
+	var t = p.scanner.CurrToken()
+	if t.Typ != token.IDENTIFIER || p.prevTyp != token.NEWLINE {
+		return false
+	}
+	for _, keyword := range keywords {
+		if t.Lit == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// skipUntil skips tokens until f returns true or the end of the input.
+// Scanner errors in the skipped tokens are recorded too.
+func (p *Parser) skipUntil(f func() bool) {
+	for !p.scanner.Eof() && !f() {
+		p.recoverable(func() { p.proceed() })
+	}
+}
+
 // func (p *Parser) fixPipeBinaryExprs(node ast.Node) ast.Node {
 // 	switch node := node.(type) {
 // 	  case
 // 	}
 // }
 
+var declKeywords = []string{"let", "function", "external", "requires"}
+
 func (p *Parser) parseDecls() []ast.Decl {
 	var nodes []ast.Decl
 	for {
-		var node = p.parseDecl()
+		var start = p.scanner.CurrToken().Pos
+		var node ast.Decl
+		var ok = p.recoverable(func() {
+			node = p.parseDecl()
+		})
+		if !ok {
+			// resynchronise at the next declaration, making sure at least one
+			// token is skipped
+			if p.scanner.CurrToken().Pos == start && !p.scanner.Eof() {
+				p.recoverable(func() { p.proceed() })
+			}
+			p.skipUntil(func() bool { return p.atDeclStart(declKeywords...) })
+			continue
+		}
 		if node != nil {
 			nodes = append(nodes, node)
 		}
@@ -152,6 +351,8 @@ func (p *Parser) parseDecl() ast.Decl {
 		return p.parseFuncDecl()
 	case "external":
 		return p.parseExternalFuncDecl()
+	case "requires":
+		return p.parseRequiresDecl()
 	}
 
 	switch t.Typ {
@@ -175,14 +376,18 @@ func (p *Parser) parsePrimaryExpr() ast.Expr {
 			if p.debug {
 				fmt.Printf("failed to unquote %q\n", t.Lit)
 			}
-			panic(ParseError{fmt.Errorf("failed to unquote string: %v", err)})
+			panic(ParseError{strError{msg: fmt.Sprintf("failed to unquote string: %v", err), pos: t.Pos, opener: -1}})
 		}
 		var raw = t.Lit[0] == '`'
-		return &ast.String{
-			Root:      MustParseStr(v, raw, p.debug),
+		var str = &ast.String{
+			Root:      p.parseStr(t, v, raw),
 			StringLit: t.Lit,
 			Position:  t.Pos,
 		}
+		if !raw {
+			str.Interpolations = p.parseInterpolations(t, v)
+		}
+		return str
 	case token.IDENTIFIER:
 		p.proceed()
 
@@ -215,6 +420,7 @@ func (p *Parser) parsePrimaryExpr() ast.Expr {
 		p.checkErr(err)
 		return &ast.Integer{
 			Value:    int(d),
+			Lit:      t.Lit,
 			Position: t.Pos,
 		}
 	case token.FLOAT:
@@ -224,6 +430,7 @@ func (p *Parser) parsePrimaryExpr() ast.Expr {
 		p.checkErr(err)
 		return &ast.Float{
 			Value:    f,
+			Lit:      t.Lit,
 			Position: t.Pos,
 		}
 	case token.LPAREN:
@@ -243,6 +450,7 @@ func (p *Parser) parseParenExpr() *ast.ParenExpr {
 	return &ast.ParenExpr{
 		Exprs:    exprs,
 		Position: pos,
+		Rparen:   p.prevEnd - 1,
 	}
 }
 
@@ -271,20 +479,6 @@ func (p *Parser) parseExpr(lhs ast.Expr, minPrec token.Precedence) ast.Expr {
 			return lhs
 		}
 
-		if tk.Typ == token.PIPE {
-			var leftMost = minPrec == token.LowestPrecedence
-			if !leftMost {
-				// Pipe operator should be left-associative (the rest are right associative),
-				// by which I mean
-				//     a + b + c   is equal to   (a + (b + c))
-				// but
-				//     a | b | c   is equal to   ((a | b) | c)
-				//
-				// Behave as if prec has decreased:
-				return lhs
-			}
-		}
-
 		switch tk.Typ {
 		case token.LPAREN:
 			var paren = p.parseParenExpr()
@@ -294,11 +488,38 @@ func (p *Parser) parseExpr(lhs ast.Expr, minPrec token.Precedence) ast.Expr {
 				PipedArg: &ast.ParenExpr{Exprs: nil},
 				Position: lhs.Pos(),
 			}
+		case token.LBRACK:
+			p.proceed()
+			var index = p.parseExpr(nil, token.LowestPrecedence)
+			p.expect(token.RBRACK, "]")
+			var rbrack = p.scanner.CurrToken().Pos
+			p.proceed()
+			lhs = &ast.IndexExpr{
+				X:        lhs,
+				Index:    index,
+				Position: lhs.Pos(),
+				Lbrack:   pos,
+				Rbrack:   rbrack,
+			}
+		case token.PERIOD:
+			p.proceed()
+			var name = p.expectType(token.IDENTIFIER)
+			p.proceed()
+			lhs = &ast.SelectorExpr{
+				X:        lhs,
+				Sel:      &ast.Ident{Name: name.Lit, Position: name.Pos},
+				Position: lhs.Pos(),
+			}
 		default:
 			// other kinds
 			p.proceed()
 
-			var rhs = p.parseExpr(nil, prec)
+			// Binary operators are left-associative, e.g.
+			//     a - b - c   is equal to   ((a - b) - c)
+			//     a | b | c   is equal to   ((a | b) | c)
+			// so the right hand side only takes operators that bind
+			// tighter.
+			var rhs = p.parseExpr(nil, prec+1)
 
 			var rhsCallExpr, isCallExpr = rhs.(*ast.CallExpr)
 			if tk.Typ == token.PIPE && isCallExpr {
@@ -364,15 +585,41 @@ For:
 			p.proceed()
 			continue For
 		}
-		var stmt = p.parseStmt()
-		stmts = append(stmts, stmt)
+		if p.atDeclStart("function", "external", "requires") {
+			// the closing brace is probably missing
+			break For
+		}
+
+		var ok = p.recoverable(func() {
+			stmts = append(stmts, p.parseStmt())
+		})
+		if !ok {
+			// resynchronise at the next line, skipping nested blocks
+			var depth = 0
+			p.skipUntil(func() bool {
+				switch p.scanner.CurrToken().Typ {
+				case token.LBRACE:
+					depth++
+				case token.RBRACE:
+					if depth == 0 {
+						return true
+					}
+					depth--
+				case token.NEWLINE:
+					return depth == 0
+				}
+				return false
+			})
+		}
 	}
 
+	var rbrace = p.scanner.CurrToken().Pos
 	p.expect(token.RBRACE, "}")
 	p.proceed()
 	return &ast.BlockStmt{
 		Statements: stmts,
 		Position:   pos,
+		Rbrace:     rbrace,
 	}
 }
 
@@ -437,6 +684,36 @@ func (p *Parser) parseExternalFuncDecl() ast.Decl {
 	}
 }
 
+func (p *Parser) parseRequiresDecl() ast.Decl {
+	// requires file "config.yaml"
+	// requires command "docker"
+
+	var pos = p.scanner.CurrToken().Pos
+	p.expect(token.IDENTIFIER, "requires")
+	p.proceed()
+
+	var kind = p.expectType(token.IDENTIFIER)
+	switch kind.Lit {
+	case "file", "command":
+	default:
+		panic(ParseError{fmt.Errorf("expected \"file\" or \"command\", got %s", kind)})
+	}
+	p.proceed()
+
+	var lit = p.expectType(token.STRING)
+	var name, err = strconv.Unquote(lit.Lit)
+	p.checkErr(err)
+	p.proceed()
+
+	return &ast.RequiresDecl{
+		Kind:     kind.Lit,
+		Name:     name,
+		Lit:      lit.Lit,
+		LitPos:   lit.Pos,
+		Position: pos,
+	}
+}
+
 func (p *Parser) parseFuncDecl() ast.Decl {
 	var pos = p.scanner.CurrToken().Pos
 	p.expect(token.IDENTIFIER, "function")
@@ -495,6 +772,7 @@ func (p *Parser) parseStmt() ast.Stmt {
 }
 
 func (p *Parser) parseFuncSignatureArg() ast.FuncSignatureArg {
+	var pos = p.scanner.CurrToken().Pos
 	var name = p.expectType(token.IDENTIFIER)
 	p.proceed()
 
@@ -504,6 +782,8 @@ func (p *Parser) parseFuncSignatureArg() ast.FuncSignatureArg {
 	return ast.FuncSignatureArg{
 		Name: name.Lit,
 		Type: typ.Lit, // TODO: allow types to have constrains, e.g. regular expression or glob
+
+		Position: pos,
 	}
 }
 
@@ -542,6 +822,7 @@ func (p *Parser) parseExternalFuncSignature() ast.FuncSignature {
 		Args:     args,
 		RetTypes: []string{"string"},
 		Position: pos,
+		EndPos:   p.prevEnd,
 	}
 }
 
@@ -570,17 +851,12 @@ func (p *Parser) parseFuncSignature() ast.FuncSignature {
 		Args:     args,
 		RetTypes: retTypes,
 		Position: pos,
+		EndPos:   p.prevEnd,
 	}
 }
 
 func MustParseStr(s string, raw bool, debug bool) *strs_parser.Root {
-	if raw {
-		return &strs_parser.Root{
-			Items: []strs_parser.CmdNode{strs_parser.Wrd{Lit: s}},
-		}
-	}
-	var p = strs_parser.NewParser()
-	var root, err = p.Parse(strings.NewReader(s))
+	var root, err = parseTemplate(s, raw)
 	if err != nil {
 		if debug {
 			fmt.Printf("failed parsing %q\n", s)
@@ -590,6 +866,142 @@ func MustParseStr(s string, raw bool, debug bool) *strs_parser.Root {
 	return root
 }
 
+// parseStr is like MustParseStr, but the errors are positioned in the
+// source of the string literal t, whose unquoted value is v.
+func (p *Parser) parseStr(t scanner.Token, v string, raw bool) *strs_parser.Root {
+	var root, err = parseTemplate(v, raw)
+	var perr *strs_parser.Error
+	if errors.As(err, &perr) {
+		var offsets = literalOffsets(t.Lit)
+		var at = func(i int) scanner.Pos {
+			if i >= len(offsets) {
+				i = len(offsets) - 1
+			}
+			return t.Pos + scanner.Pos(offsets[i])
+		}
+		var e = strError{msg: perr.Msg, pos: at(perr.Pos), opener: -1}
+		if perr.Opener >= 0 {
+			e.opener = at(perr.Opener)
+			e.ch = []rune(v)[perr.Opener]
+		}
+		panic(ParseError{e})
+	}
+	if err != nil {
+		panic(ParseError{strError{msg: fmt.Sprintf("failed to parse str %q: %v", v, err), pos: t.Pos, opener: -1}})
+	}
+	return root
+}
+
+// parseTemplate parses the unquoted value of a string literal. A raw string
+// is a single word, its value is not a template.
+func parseTemplate(v string, raw bool) (*strs_parser.Root, error) {
+	if raw {
+		return &strs_parser.Root{
+			Items: []strs_parser.CmdNode{strs_parser.Wrd{Lit: v}},
+		}, nil
+	}
+	return strs_parser.NewParser().Parse(strings.NewReader(v))
+}
+
+// parseInterpolations parses the expressions interpolated in the template v
+// of the string literal t, e.g. count + 1 in "${count + 1}". An expression
+// that is interpolated more than once is returned once. The positions of the
+// nodes are in the source of t.
+func (p *Parser) parseInterpolations(t scanner.Token, v string) []ast.Interpolation {
+	var offsets = literalOffsets(t.Lit)
+	var s = strs_scanner.NewScanner(strings.NewReader(v))
+	var interpolations []ast.Interpolation
+	var seen = map[string]bool{}
+	for {
+		var tok, err = s.NextToken()
+		if err != nil || tok.Typ == strs_scanner.EOF || tok.Typ == strs_scanner.ILLEGAL_TOKEN {
+			return interpolations
+		}
+		if tok.Typ != strs_scanner.EXPR {
+			continue
+		}
+		var src, _ = strs_scanner.SplitExpr(tok.Lit)
+		if seen[src] {
+			continue
+		}
+		seen[src] = true
+
+		var start = tok.Pos + len("${")
+		var at = func(pos scanner.Pos) scanner.Pos {
+			var i = start + int(pos)
+			if i >= len(offsets) {
+				i = len(offsets) - 1
+			}
+			return t.Pos + scanner.Pos(offsets[i])
+		}
+
+		var sub = NewParser()
+		sub.SetDebug(p.debug)
+		var x, parseErr = sub.ParseExpr(strings.NewReader(src))
+		if parseErr != nil {
+			var e = parseErr.(Error)
+			var msg = fmt.Sprintf("invalid expression %q: %s", src, e.Msg)
+			panic(ParseError{strError{msg: msg, pos: at(e.Pos), opener: -1}})
+		}
+		ast.Inspect(x, func(node ast.Node) bool {
+			movePositions(node, at)
+			return true
+		})
+		interpolations = append(interpolations, ast.Interpolation{Src: src, X: x})
+	}
+}
+
+// movePositions sets the positions of node to at(pos).
+func movePositions(node ast.Node, at func(scanner.Pos) scanner.Pos) {
+	switch node := node.(type) {
+	case *ast.Ident:
+		node.Position = at(node.Position)
+	case *ast.Integer:
+		node.Position = at(node.Position)
+	case *ast.Float:
+		node.Position = at(node.Position)
+	case *ast.String:
+		node.Position = at(node.Position)
+	case *ast.BinaryExpr:
+		node.Position = at(node.Position)
+	case *ast.UnaryExpr:
+		node.Position = at(node.Position)
+	case *ast.ParenExpr:
+		node.Position = at(node.Position)
+		node.Rparen = at(node.Rparen)
+	case *ast.IndexExpr:
+		node.Position = at(node.Position)
+		node.Lbrack = at(node.Lbrack)
+		node.Rbrack = at(node.Rbrack)
+	case *ast.SelectorExpr:
+		node.Position = at(node.Position)
+	case *ast.CallExpr:
+		node.Position = at(node.Position)
+	case *ast.AssignExpr:
+		node.Position = at(node.Position)
+	}
+}
+
+// literalOffsets returns the offset in runes in the quoted literal lit of
+// each rune of its unquoted value, followed by the offset of the closing
+// quote.
+func literalOffsets(lit string) []int {
+	var offsets []int
+	var quote = lit[0]
+	var body = lit[1 : len(lit)-1]
+	var offset = 1
+	for len(body) > 0 {
+		offsets = append(offsets, offset)
+		var _, _, tail, err = strconv.UnquoteChar(body, quote)
+		if err != nil {
+			break
+		}
+		offset += utf8.RuneCountInString(body[:len(body)-len(tail)])
+		body = tail
+	}
+	return append(offsets, offset)
+}
+
 func (p *Parser) parseIfStmt() *ast.IfStmt {
 	var pos = p.scanner.CurrToken().Pos
 	p.expect(token.IDENTIFIER, "if")
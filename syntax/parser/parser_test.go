@@ -37,16 +37,19 @@ func TestParser(tt *testing.T) {
 						Signature: &ast.FuncSignature{
 							Args: []ast.FuncSignatureArg{
 								{
-									Name: "s",
-									Type: "string",
+									Name:     "s",
+									Type:     "string",
+									Position: 18,
 								},
 								{
-									Name: "i",
-									Type: "int",
+									Name:     "i",
+									Type:     "int",
+									Position: 28,
 								},
 							},
 							RetTypes: nil,
 							Position: 17,
+							EndPos:   34,
 						},
 						Body: &ast.BlockStmt{
 							Statements: []ast.Stmt{
@@ -57,6 +60,7 @@ func TestParser(tt *testing.T) {
 									},
 									Rhs: &ast.Integer{
 										Value:    3,
+										Lit:      "3",
 										Position: 49,
 									},
 									Position: 41,
@@ -67,6 +71,7 @@ func TestParser(tt *testing.T) {
 								},
 							},
 							Position: 35,
+							Rbrace:   65,
 						},
 						Position: 4,
 					},
@@ -101,6 +106,7 @@ func TestParser(tt *testing.T) {
 							Args:     nil,
 							RetTypes: []string{"string"},
 							Position: IgnorePos,
+							EndPos:   IgnorePos,
 						},
 						Body: &ast.BlockStmt{
 							Statements: []ast.Stmt{
@@ -111,6 +117,7 @@ func TestParser(tt *testing.T) {
 									},
 									Rhs: &ast.Integer{
 										Value:    3,
+										Lit:      "3",
 										Position: IgnorePos,
 									},
 									Position: IgnorePos,
@@ -130,6 +137,7 @@ func TestParser(tt *testing.T) {
 												},
 											},
 											Position: IgnorePos,
+											Rparen:   IgnorePos,
 										},
 										PipedArg: &ast.ParenExpr{
 											Exprs:    nil,
@@ -158,6 +166,7 @@ func TestParser(tt *testing.T) {
 												},
 											},
 											Position: IgnorePos,
+											Rparen:   IgnorePos,
 										},
 										PipedArg: &ast.ParenExpr{
 											Exprs:    nil,
@@ -181,6 +190,7 @@ func TestParser(tt *testing.T) {
 									Body: &ast.BlockStmt{
 										Statements: nil,
 										Position:   IgnorePos,
+										Rbrace:     IgnorePos,
 									},
 									Else: &ast.IfStmt{
 										Cond: &ast.BinaryExpr{
@@ -196,10 +206,12 @@ func TestParser(tt *testing.T) {
 										Body: &ast.BlockStmt{
 											Statements: nil,
 											Position:   IgnorePos,
+											Rbrace:     IgnorePos,
 										},
 										Else: &ast.BlockStmt{
 											Statements: nil,
 											Position:   IgnorePos,
+											Rbrace:     IgnorePos,
 										},
 										Position: IgnorePos,
 									},
@@ -208,15 +220,15 @@ func TestParser(tt *testing.T) {
 								&ast.ExprStmt{
 									X: &ast.CallExpr{
 										Fun: &ast.Ident{Name: "head", Position: 228},
-										Arg: &ast.ParenExpr{Position: 232},
+										Arg: &ast.ParenExpr{Position: 232, Rparen: 233},
 										PipedArg: &ast.ParenExpr{Exprs: []ast.Expr{
 											&ast.CallExpr{
 												Fun: &ast.Ident{Name: "jq", Position: 221},
-												Arg: &ast.ParenExpr{Position: 223},
+												Arg: &ast.ParenExpr{Position: 223, Rparen: 224},
 												PipedArg: &ast.ParenExpr{Exprs: []ast.Expr{
 													&ast.CallExpr{
 														Fun:      &ast.Ident{Name: "curl", Position: 212},
-														Arg:      &ast.ParenExpr{Position: 216},
+														Arg:      &ast.ParenExpr{Position: 216, Rparen: 217},
 														PipedArg: &ast.ParenExpr{},
 														Position: 212,
 													},
@@ -237,12 +249,37 @@ func TestParser(tt *testing.T) {
 								},
 							},
 							Position: IgnorePos,
+							Rbrace:   IgnorePos,
 						},
 						Position: IgnorePos,
 					},
 				},
 			},
 		},
+		{
+			src: `
+			requires file "config.yaml"
+			requires command "docker"
+			`,
+			want: &ast.Root{
+				Decls: []ast.Decl{
+					&ast.RequiresDecl{
+						Kind:     "file",
+						Name:     "config.yaml",
+						Lit:      `"config.yaml"`,
+						LitPos:   18,
+						Position: 4,
+					},
+					&ast.RequiresDecl{
+						Kind:     "command",
+						Name:     "docker",
+						Lit:      `"docker"`,
+						LitPos:   52,
+						Position: 35,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -254,6 +291,10 @@ func TestParser(tt *testing.T) {
 		if err != nil {
 			tt.Fatalf("test case failed\nsrc:\n%s\nerr:\n%s", src, err)
 		}
+		if got.File == nil || got.File.Size() != len([]rune(tc.src)) {
+			tt.Fatalf("missing file in the root of\n%s", src)
+		}
+		got.File = nil
 
 		var cmpOpt = cmp.FilterValues(func(p1, p2 scanner.Pos) bool { return p1 == IgnorePos || p2 == IgnorePos || p1 == p2 }, cmp.Ignore())
 
@@ -263,3 +304,105 @@ func TestParser(tt *testing.T) {
 		}
 	}
 }
+
+func TestParserErrors(tt *testing.T) {
+	var testCases = []struct {
+		src      string
+		want     []parser.Error
+		wantDecl []string // names of the declarations that could be parsed
+	}{
+		{
+			src: "let a = \n" +
+				"function f() {\n" +
+				"\tlet x = )\n" +
+				"\tprintln(\"ok\")\n" +
+				"\tif x == {\n" +
+				"\t\tfoo(\n" +
+				"\t}\n" +
+				"\tlet y = 1\n" +
+				"}\n" +
+				"external e() => \n" +
+				"function g() {\n" +
+				"\tlet z = 1\n" +
+				"function h() {\n" +
+				"}\n" +
+				"let ok = 1\n",
+			want: []parser.Error{
+				{Pos: 8, End: 9, Line: 1, Column: 9, Msg: `failed to parse primary expression, got NEWLINE("\n") at 8`},
+				{Pos: 33, End: 34, Line: 3, Column: 10, Msg: `failed to parse primary expression, got RPAREN(")") at 33`},
+				{Pos: 59, End: 60, Line: 5, Column: 10, Msg: `failed to parse primary expression, got LBRACE("{") at 59`},
+				{Pos: 100, End: 101, Line: 10, Column: 17, Msg: `failed to parse primary expression, got NEWLINE("\n") at 100`},
+				{Pos: 127, End: 135, Line: 13, Column: 1, Msg: `expected "}", got IDENTIFIER("function") at 127`},
+			},
+			wantDecl: []string{"f", "h", "ok"},
+		},
+		{
+			src: "function f() {\n\tprintln(1)\n",
+			want: []parser.Error{
+				{Pos: 27, End: 27, Line: 3, Column: 1, Msg: `expected "}", got EOF(:AnyLit:) at 27`},
+			},
+		},
+		{
+			src: "let x = \"a \\t ›\"\n" +
+				"let y = \"sh -c «echo \\\"a\"\n",
+			want: []parser.Error{
+				{Pos: 14, End: 15, Line: 1, Column: 15, Msg: `unexpected ›, it is not opened, use \› for a literal ›`},
+				{Pos: 41, End: 42, Line: 2, Column: 25, Msg: `unclosed "`},
+			},
+		},
+		{
+			src: "let x = \"a\nb\"\n" +
+				"let ok = `a\nb`\n",
+			want: []parser.Error{
+				{Pos: 8, End: 9, Line: 1, Column: 9, Msg: `failed to unquote string: invalid syntax`},
+			},
+			wantDecl: []string{"ok"},
+		},
+		{
+			src: "let ok = 1\n" +
+				"let x = \"abc",
+			want: []parser.Error{
+				{Pos: 19, End: 23, Line: 2, Column: 9, Msg: `unterminated string, expected "`},
+			},
+			wantDecl: []string{"ok"},
+		},
+		{
+			src: "let x = \"${1 +}\"\n" +
+				"let ok = \"${n + 1}\"\n",
+			want: []parser.Error{
+				{Pos: 14, End: 15, Line: 1, Column: 15, Msg: `invalid expression "1 +": failed to parse primary expression, got EOF(:AnyLit:) at 3`},
+			},
+			wantDecl: []string{"ok"},
+		},
+	}
+
+	for ti, tc := range testCases {
+		var p = parser.NewParser()
+		var root, err = p.Parse(strings.NewReader(tc.src))
+		var errs, ok = err.(parser.ErrorList)
+		if !ok {
+			tt.Fatalf("expected an error list (test case %d), got: %v", ti, err)
+		}
+
+		var got []parser.Error
+		for _, e := range errs {
+			got = append(got, parser.Error{Pos: e.Pos, End: e.End, Line: e.Line, Column: e.Column, Msg: e.Msg})
+		}
+		if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(parser.Error{})); diff != "" {
+			tt.Fatalf("mismatching errors (test case %d)\nerr:\n%s\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, err, diff)
+		}
+
+		var gotDecl []string
+		for _, decl := range root.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				gotDecl = append(gotDecl, decl.Name.Name)
+			case *ast.LetDecl:
+				gotDecl = append(gotDecl, decl.Name.Name)
+			}
+		}
+		if diff := cmp.Diff(tc.wantDecl, gotDecl); diff != "" {
+			tt.Fatalf("mismatching declarations (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
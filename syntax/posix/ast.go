@@ -0,0 +1,158 @@
+package posix
+
+// File is a parsed shell script
+type File struct {
+	Stmts []Stmt
+}
+
+type Pos struct {
+	Offset int
+	Line   int // 1-based
+	Column int // 1-based
+}
+
+// Comment is a "# ..." comment on its own line
+type Comment struct {
+	Text string
+
+	Position Pos
+}
+
+// Assign is a "name=value" statement
+type Assign struct {
+	Name  string
+	Value *Word
+
+	Position Pos
+}
+
+// Command is a simple command, e.g. `ls -la "$dir"`
+type Command struct {
+	Words []*Word
+
+	Position Pos
+}
+
+// Pipeline is one or more commands connected with "|"
+type Pipeline struct {
+	Cmds []*Command
+
+	Position Pos
+}
+
+// IfClause is "if cond; then ...; elif cond; then ...; else ...; fi".
+// Elifs are represented as an IfClause in Else.
+type IfClause struct {
+	Cond *Pipeline
+	Then []Stmt
+	Else []Stmt
+
+	Position Pos
+}
+
+// FuncDecl is "name() { ... }"
+type FuncDecl struct {
+	Name string
+	Body []Stmt
+
+	Position Pos
+}
+
+// Word is a shell word, made of one or more parts with no space between
+// them, e.g. foo"bar $baz"'qux'
+type Word struct {
+	Parts []WordPart
+
+	Position Pos
+}
+
+// Lit is an unquoted literal, with backslash escapes already removed
+type Lit struct {
+	Value string
+}
+
+// SglQuoted is a '...' string
+type SglQuoted struct {
+	Value string
+}
+
+// AnsiCQuoted is a $'...' string, with escapes already decoded
+type AnsiCQuoted struct {
+	Value string
+}
+
+// DblQuoted is a "..." string
+type DblQuoted struct {
+	Parts []WordPart
+}
+
+// ParamExp is $name, ${name} or $1
+type ParamExp struct {
+	Name string
+}
+
+type Stmt interface {
+	Pos() Pos
+	stmt()
+}
+
+type WordPart interface {
+	wordPart()
+}
+
+func (s *Comment) Pos() Pos  { return s.Position }
+func (s *Assign) Pos() Pos   { return s.Position }
+func (s *Pipeline) Pos() Pos { return s.Position }
+func (s *IfClause) Pos() Pos { return s.Position }
+func (s *FuncDecl) Pos() Pos { return s.Position }
+
+func (*Comment) stmt()  {}
+func (*Assign) stmt()   {}
+func (*Pipeline) stmt() {}
+func (*IfClause) stmt() {}
+func (*FuncDecl) stmt() {}
+
+func (Lit) wordPart()         {}
+func (SglQuoted) wordPart()   {}
+func (AnsiCQuoted) wordPart() {}
+func (DblQuoted) wordPart()   {}
+func (ParamExp) wordPart()    {}
+
+// Lit returns the value of the word if it has no parameter expansions.
+func (w *Word) Lit() (string, bool) {
+	var s, ok = partsLit(w.Parts)
+	return s, ok
+}
+
+// IsUnquoted reports whether the word is a single unquoted literal, e.g. a
+// reserved word like "if" or "then".
+func (w *Word) IsUnquoted(value string) bool {
+	if len(w.Parts) != 1 {
+		return false
+	}
+	var lit, ok = w.Parts[0].(Lit)
+	return ok && lit.Value == value
+}
+
+func partsLit(parts []WordPart) (string, bool) {
+	var s string
+	for _, part := range parts {
+		switch part := part.(type) {
+		case Lit:
+			s += part.Value
+		case SglQuoted:
+			s += part.Value
+		case AnsiCQuoted:
+			s += part.Value
+		case DblQuoted:
+			var inner, ok = partsLit(part.Parts)
+			if !ok {
+				return "", false
+			}
+			s += inner
+		default:
+			return "", false
+		}
+	}
+	return s, true
+}
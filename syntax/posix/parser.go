@@ -0,0 +1,281 @@
+package posix
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/siadat/well/erroring"
+)
+
+// This package parses the subset of POSIX sh that well convert can
+// translate: simple commands, pipelines, if/elif/else, functions,
+// assignments, comments and quoting.
+
+type Parser struct {
+	scanner *scanner
+	tok     token
+	peeked  *token
+	debug   bool
+}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+func (p *Parser) SetDebug(v bool) {
+	p.debug = v
+}
+
+func (p *Parser) Parse(src io.Reader) (*File, error) {
+	var b, err = ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	p.scanner = newScanner(string(b))
+	p.peeked = nil
+
+	return erroring.CallAndRecover[Error](func() *File {
+		p.proceed()
+		var stmts = p.parseStmts()
+		if p.tok.typ != tokEOF {
+			panic(p.unexpected())
+		}
+		return &File{Stmts: stmts}
+	})
+}
+
+func (p *Parser) proceed() {
+	if p.peeked != nil {
+		p.tok = *p.peeked
+		p.peeked = nil
+		return
+	}
+	p.tok = p.scanner.nextToken()
+}
+
+func (p *Parser) peek() token {
+	if p.peeked == nil {
+		var t = p.scanner.nextToken()
+		p.peeked = &t
+	}
+	return *p.peeked
+}
+
+func (p *Parser) isReserved(words ...string) bool {
+	if p.tok.typ != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if p.tok.word.IsUnquoted(w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) expectReserved(word string) {
+	if !p.isReserved(word) {
+		panic(newError(p.tok.pos, "expected %q, got %s", word, p.describe(p.tok)))
+	}
+	p.proceed()
+}
+
+func (p *Parser) describe(t token) string {
+	if t.typ == tokWord {
+		if lit, ok := t.word.Lit(); ok {
+			return "word " + lit
+		}
+	}
+	return t.typ.String()
+}
+
+func (p *Parser) unexpected() error {
+	return newError(p.tok.pos, "unexpected %s", p.describe(p.tok))
+}
+
+func (p *Parser) skipSeparators() {
+	for p.tok.typ == tokNewline || p.tok.typ == tokSemi {
+		p.proceed()
+	}
+}
+
+// parseStmts parses statements until EOF or until one of the given reserved
+// words, which is not consumed.
+func (p *Parser) parseStmts(until ...string) []Stmt {
+	var stmts []Stmt
+	for {
+		p.skipSeparators()
+		if p.tok.typ == tokEOF || p.isReserved(until...) {
+			return stmts
+		}
+		stmts = append(stmts, p.parseStmt())
+	}
+}
+
+var (
+	assignRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=`)
+	nameRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func (p *Parser) parseStmt() Stmt {
+	var pos = p.tok.pos
+	switch p.tok.typ {
+	case tokComment:
+		var c = &Comment{Text: p.tok.lit, Position: pos}
+		p.proceed()
+		return c
+	case tokWord:
+		// handled below
+	case tokLparen:
+		panic(newError(pos, "subshells are not supported"))
+	default:
+		panic(p.unexpected())
+	}
+
+	switch {
+	case p.isReserved("if"):
+		p.proceed()
+		return p.parseIfRest(pos)
+	case p.isReserved("while", "until", "for"):
+		panic(newError(pos, "loops are not supported"))
+	case p.isReserved("case"):
+		panic(newError(pos, "case statements are not supported"))
+	case p.isReserved("{"):
+		panic(newError(pos, "command groups are not supported"))
+	case p.isReserved("!"):
+		panic(newError(pos, "negated pipelines are not supported"))
+	case p.isReserved("then", "elif", "else", "fi", "}"):
+		panic(p.unexpected())
+	case p.isReserved("function"):
+		panic(newError(pos, "use name() { ... } to declare functions"))
+	}
+
+	if p.peek().typ == tokLparen {
+		return p.parseFuncDecl()
+	}
+
+	if assign := p.parseAssign(); assign != nil {
+		return assign
+	}
+
+	return p.parsePipeline()
+}
+
+func (p *Parser) parseAssign() *Assign {
+	var word = p.tok.word
+	var first, ok = word.Parts[0].(Lit)
+	if !ok {
+		return nil
+	}
+	var m = assignRe.FindStringSubmatch(first.Value)
+	if m == nil {
+		return nil
+	}
+
+	var value = &Word{Position: word.Position}
+	if rest := first.Value[len(m[0]):]; rest != "" {
+		value.Parts = append(value.Parts, Lit{Value: rest})
+	}
+	value.Parts = append(value.Parts, word.Parts[1:]...)
+
+	var pos = p.tok.pos
+	p.proceed()
+	if p.tok.typ == tokWord {
+		panic(newError(pos, "assignments before a command are not supported"))
+	}
+	p.endOfStmt()
+	return &Assign{Name: m[1], Value: value, Position: pos}
+}
+
+func (p *Parser) parseFuncDecl() *FuncDecl {
+	var pos = p.tok.pos
+	var name, ok = p.tok.word.Lit()
+	if !ok || len(p.tok.word.Parts) != 1 || !nameRe.MatchString(name) {
+		panic(newError(pos, "invalid function name"))
+	}
+	p.proceed()
+	if p.tok.typ != tokLparen {
+		panic(p.unexpected())
+	}
+	p.proceed()
+	if p.tok.typ != tokRparen {
+		panic(p.unexpected())
+	}
+	p.proceed()
+	for p.tok.typ == tokNewline {
+		p.proceed()
+	}
+	p.expectReserved("{")
+	var body = p.parseStmts("}")
+	p.expectReserved("}")
+	p.endOfStmt()
+	return &FuncDecl{Name: name, Body: body, Position: pos}
+}
+
+// parseIfRest parses what comes after "if" or "elif".
+func (p *Parser) parseIfRest(pos Pos) *IfClause {
+	var clause = &IfClause{Position: pos}
+	clause.Cond = p.parsePipeline()
+	p.skipSeparators()
+	p.expectReserved("then")
+	clause.Then = p.parseStmts("elif", "else", "fi")
+
+	switch {
+	case p.isReserved("elif"):
+		var elifPos = p.tok.pos
+		p.proceed()
+		clause.Else = []Stmt{p.parseIfRest(elifPos)}
+		return clause
+	case p.isReserved("else"):
+		p.proceed()
+		clause.Else = p.parseStmts("fi")
+	}
+	p.expectReserved("fi")
+	p.endOfStmt()
+	return clause
+}
+
+func (p *Parser) parsePipeline() *Pipeline {
+	var pipeline = &Pipeline{Position: p.tok.pos}
+	for {
+		pipeline.Cmds = append(pipeline.Cmds, p.parseCommand())
+		if p.tok.typ != tokPipe {
+			break
+		}
+		p.proceed()
+		for p.tok.typ == tokNewline {
+			p.proceed()
+		}
+	}
+	p.endOfStmt()
+	return pipeline
+}
+
+func (p *Parser) parseCommand() *Command {
+	var cmd = &Command{Position: p.tok.pos}
+	for p.tok.typ == tokWord {
+		cmd.Words = append(cmd.Words, p.tok.word)
+		p.proceed()
+	}
+	if len(cmd.Words) == 0 {
+		panic(newError(p.tok.pos, "expected a command, got %s", p.describe(p.tok)))
+	}
+	return cmd
+}
+
+// endOfStmt reports the operators that cannot follow a statement in the
+// supported subset.
+func (p *Parser) endOfStmt() {
+	switch p.tok.typ {
+	case tokNewline, tokSemi, tokEOF, tokComment:
+		return
+	case tokAndAnd, tokOrOr:
+		panic(newError(p.tok.pos, "%s lists are not supported", p.tok.lit))
+	case tokAmp:
+		panic(newError(p.tok.pos, "background jobs are not supported"))
+	case tokRedirect:
+		panic(newError(p.tok.pos, "redirections are not supported"))
+	}
+	panic(p.unexpected())
+}
@@ -0,0 +1,170 @@
+package posix_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kr/pretty"
+	"github.com/siadat/well/syntax/posix"
+)
+
+func TestParser(tt *testing.T) {
+	var testCases = []struct {
+		src     string
+		want    *posix.File
+		wantErr string
+	}{
+		{
+			src: `# hi
+x="a $b"'c'd
+greet() {
+	echo $1 | tr a-z A-Z
+}
+if [ "$x" = y ]; then echo $'\t'; elif test -n x; then :; else echo no; fi
+`,
+			want: &posix.File{Stmts: []posix.Stmt{
+				&posix.Comment{Text: "# hi", Position: posix.Pos{Offset: 0, Line: 1, Column: 1}},
+				&posix.Assign{
+					Name: "x",
+					Value: &posix.Word{
+						Parts: []posix.WordPart{
+							posix.DblQuoted{Parts: []posix.WordPart{posix.Lit{Value: "a "}, posix.ParamExp{Name: "b"}}},
+							posix.SglQuoted{Value: "c"},
+							posix.Lit{Value: "d"},
+						},
+						Position: posix.Pos{Offset: 5, Line: 2, Column: 1},
+					},
+					Position: posix.Pos{Offset: 5, Line: 2, Column: 1},
+				},
+				&posix.FuncDecl{
+					Name: "greet",
+					Body: []posix.Stmt{
+						&posix.Pipeline{
+							Cmds: []*posix.Command{
+								{
+									Words: []*posix.Word{
+										{Parts: []posix.WordPart{posix.Lit{Value: "echo"}}, Position: posix.Pos{Offset: 29, Line: 4, Column: 2}},
+										{Parts: []posix.WordPart{posix.ParamExp{Name: "1"}}, Position: posix.Pos{Offset: 34, Line: 4, Column: 7}},
+									},
+									Position: posix.Pos{Offset: 29, Line: 4, Column: 2},
+								},
+								{
+									Words: []*posix.Word{
+										{Parts: []posix.WordPart{posix.Lit{Value: "tr"}}, Position: posix.Pos{Offset: 39, Line: 4, Column: 12}},
+										{Parts: []posix.WordPart{posix.Lit{Value: "a-z"}}, Position: posix.Pos{Offset: 42, Line: 4, Column: 15}},
+										{Parts: []posix.WordPart{posix.Lit{Value: "A-Z"}}, Position: posix.Pos{Offset: 46, Line: 4, Column: 19}},
+									},
+									Position: posix.Pos{Offset: 39, Line: 4, Column: 12},
+								},
+							},
+							Position: posix.Pos{Offset: 29, Line: 4, Column: 2},
+						},
+					},
+					Position: posix.Pos{Offset: 18, Line: 3, Column: 1},
+				},
+				&posix.IfClause{
+					Cond: &posix.Pipeline{
+						Cmds: []*posix.Command{{
+							Words: []*posix.Word{
+								{Parts: []posix.WordPart{posix.Lit{Value: "["}}, Position: posix.Pos{Offset: 55, Line: 6, Column: 4}},
+								{Parts: []posix.WordPart{posix.DblQuoted{Parts: []posix.WordPart{posix.ParamExp{Name: "x"}}}}, Position: posix.Pos{Offset: 57, Line: 6, Column: 6}},
+								{Parts: []posix.WordPart{posix.Lit{Value: "="}}, Position: posix.Pos{Offset: 62, Line: 6, Column: 11}},
+								{Parts: []posix.WordPart{posix.Lit{Value: "y"}}, Position: posix.Pos{Offset: 64, Line: 6, Column: 13}},
+								{Parts: []posix.WordPart{posix.Lit{Value: "]"}}, Position: posix.Pos{Offset: 66, Line: 6, Column: 15}},
+							},
+							Position: posix.Pos{Offset: 55, Line: 6, Column: 4},
+						}},
+						Position: posix.Pos{Offset: 55, Line: 6, Column: 4},
+					},
+					Then: []posix.Stmt{
+						&posix.Pipeline{
+							Cmds: []*posix.Command{{
+								Words: []*posix.Word{
+									{Parts: []posix.WordPart{posix.Lit{Value: "echo"}}, Position: posix.Pos{Offset: 74, Line: 6, Column: 23}},
+									{Parts: []posix.WordPart{posix.AnsiCQuoted{Value: "\t"}}, Position: posix.Pos{Offset: 79, Line: 6, Column: 28}},
+								},
+								Position: posix.Pos{Offset: 74, Line: 6, Column: 23},
+							}},
+							Position: posix.Pos{Offset: 74, Line: 6, Column: 23},
+						},
+					},
+					Else: []posix.Stmt{
+						&posix.IfClause{
+							Cond: &posix.Pipeline{
+								Cmds: []*posix.Command{{
+									Words: []*posix.Word{
+										{Parts: []posix.WordPart{posix.Lit{Value: "test"}}, Position: posix.Pos{Offset: 91, Line: 6, Column: 40}},
+										{Parts: []posix.WordPart{posix.Lit{Value: "-n"}}, Position: posix.Pos{Offset: 96, Line: 6, Column: 45}},
+										{Parts: []posix.WordPart{posix.Lit{Value: "x"}}, Position: posix.Pos{Offset: 99, Line: 6, Column: 48}},
+									},
+									Position: posix.Pos{Offset: 91, Line: 6, Column: 40},
+								}},
+								Position: posix.Pos{Offset: 91, Line: 6, Column: 40},
+							},
+							Then: []posix.Stmt{
+								&posix.Pipeline{
+									Cmds: []*posix.Command{{
+										Words: []*posix.Word{
+											{Parts: []posix.WordPart{posix.Lit{Value: ":"}}, Position: posix.Pos{Offset: 107, Line: 6, Column: 56}},
+										},
+										Position: posix.Pos{Offset: 107, Line: 6, Column: 56},
+									}},
+									Position: posix.Pos{Offset: 107, Line: 6, Column: 56},
+								},
+							},
+							Else: []posix.Stmt{
+								&posix.Pipeline{
+									Cmds: []*posix.Command{{
+										Words: []*posix.Word{
+											{Parts: []posix.WordPart{posix.Lit{Value: "echo"}}, Position: posix.Pos{Offset: 115, Line: 6, Column: 64}},
+											{Parts: []posix.WordPart{posix.Lit{Value: "no"}}, Position: posix.Pos{Offset: 120, Line: 6, Column: 69}},
+										},
+										Position: posix.Pos{Offset: 115, Line: 6, Column: 64},
+									}},
+									Position: posix.Pos{Offset: 115, Line: 6, Column: 64},
+								},
+							},
+							Position: posix.Pos{Offset: 86, Line: 6, Column: 35},
+						},
+					},
+					Position: posix.Pos{Offset: 52, Line: 6, Column: 1},
+				},
+			}},
+		},
+		{
+			src:     "ls\necho a && echo b",
+			wantErr: "2:8: && lists are not supported",
+		},
+		{
+			src:     `echo "$(date)"`,
+			wantErr: "1:7: command substitution is not supported",
+		},
+		{
+			src:     `if [ x ]; then echo`,
+			wantErr: `1:20: expected "fi", got EOF`,
+		},
+		{
+			src:     `echo 'unterminated`,
+			wantErr: "1:6: unterminated quoted string",
+		},
+	}
+
+	for ti, tc := range testCases {
+		var p = posix.NewParser()
+		var got, err = p.Parse(strings.NewReader(tc.src))
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.wantErr, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("test case %d failed\nsrc:\n%s\nerr:\n%s", ti, tc.src, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			pretty.Println("got:", got)
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
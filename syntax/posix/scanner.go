@@ -0,0 +1,412 @@
+package posix
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This scanner only knows about the subset of POSIX sh that the parser
+// supports. Everything else (command substitution, globs, redirections,
+// etc.) is reported as an error with its position, instead of being
+// silently misinterpreted.
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokWord
+	tokNewline
+	tokSemi     // ;
+	tokPipe     // |
+	tokAndAnd   // &&
+	tokOrOr     // ||
+	tokAmp      // &
+	tokLparen   // (
+	tokRparen   // )
+	tokRedirect // < > >> etc
+	tokComment  // # ...
+)
+
+func (t tokenType) String() string {
+	return map[tokenType]string{
+		tokEOF:      "EOF",
+		tokWord:     "word",
+		tokNewline:  "newline",
+		tokSemi:     "';'",
+		tokPipe:     "'|'",
+		tokAndAnd:   "'&&'",
+		tokOrOr:     "'||'",
+		tokAmp:      "'&'",
+		tokLparen:   "'('",
+		tokRparen:   "')'",
+		tokRedirect: "redirection",
+		tokComment:  "comment",
+	}[t]
+}
+
+type token struct {
+	typ  tokenType
+	lit  string
+	word *Word
+	pos  Pos
+}
+
+type scanner struct {
+	src    []rune
+	offset int
+	line   int
+	column int
+}
+
+func newScanner(src string) *scanner {
+	return &scanner{
+		src:    []rune(src),
+		line:   1,
+		column: 1,
+	}
+}
+
+func (s *scanner) peek(n int) rune {
+	if s.offset+n >= len(s.src) {
+		return 0
+	}
+	return s.src[s.offset+n]
+}
+
+func (s *scanner) next() rune {
+	var ch = s.peek(0)
+	if ch == 0 {
+		return 0
+	}
+	s.offset += 1
+	if ch == '\n' {
+		s.line += 1
+		s.column = 1
+	} else {
+		s.column += 1
+	}
+	return ch
+}
+
+func (s *scanner) pos() Pos {
+	return Pos{Offset: s.offset, Line: s.line, Column: s.column}
+}
+
+func isMeta(ch rune) bool {
+	switch ch {
+	case ' ', '\t', '\r', '\n', ';', '|', '&', '(', ')', '<', '>':
+		return true
+	}
+	return false
+}
+
+func isNameFirst(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isNameMiddle(ch rune) bool {
+	return isNameFirst(ch) || '0' <= ch && ch <= '9'
+}
+
+func (s *scanner) nextToken() token {
+	for {
+		switch s.peek(0) {
+		case ' ', '\t', '\r':
+			s.next()
+			continue
+		case '\\':
+			if s.peek(1) == '\n' { // line continuation
+				s.next()
+				s.next()
+				continue
+			}
+		}
+		break
+	}
+
+	var pos = s.pos()
+	var ch = s.peek(0)
+	switch ch {
+	case 0:
+		return token{typ: tokEOF, pos: pos}
+	case '\n':
+		s.next()
+		return token{typ: tokNewline, lit: "\n", pos: pos}
+	case ';':
+		s.next()
+		if s.peek(0) == ';' {
+			panic(newError(pos, "case statements are not supported"))
+		}
+		return token{typ: tokSemi, lit: ";", pos: pos}
+	case '|':
+		s.next()
+		if s.peek(0) == '|' {
+			s.next()
+			return token{typ: tokOrOr, lit: "||", pos: pos}
+		}
+		return token{typ: tokPipe, lit: "|", pos: pos}
+	case '&':
+		s.next()
+		if s.peek(0) == '&' {
+			s.next()
+			return token{typ: tokAndAnd, lit: "&&", pos: pos}
+		}
+		return token{typ: tokAmp, lit: "&", pos: pos}
+	case '(':
+		s.next()
+		return token{typ: tokLparen, lit: "(", pos: pos}
+	case ')':
+		s.next()
+		return token{typ: tokRparen, lit: ")", pos: pos}
+	case '<', '>':
+		var start = s.offset
+		for s.peek(0) == '<' || s.peek(0) == '>' || s.peek(0) == '&' || s.peek(0) == '|' {
+			s.next()
+		}
+		return token{typ: tokRedirect, lit: string(s.src[start:s.offset]), pos: pos}
+	case '#':
+		var start = s.offset
+		for s.peek(0) != '\n' && s.peek(0) != 0 {
+			s.next()
+		}
+		return token{typ: tokComment, lit: string(s.src[start:s.offset]), pos: pos}
+	default:
+		var word = s.readWord()
+		return token{typ: tokWord, word: word, pos: pos}
+	}
+}
+
+func (s *scanner) readWord() *Word {
+	var word = &Word{Position: s.pos()}
+	var lit strings.Builder
+	var flush = func() {
+		if lit.Len() > 0 {
+			word.Parts = append(word.Parts, Lit{Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	if s.peek(0) == '~' {
+		panic(newError(s.pos(), "tilde expansion is not supported"))
+	}
+
+	for {
+		var pos = s.pos()
+		var ch = s.peek(0)
+		switch {
+		case ch == 0 || isMeta(ch):
+			flush()
+			return word
+		case ch == '\\':
+			s.next()
+			switch s.peek(0) {
+			case 0:
+				lit.WriteRune('\\')
+			case '\n':
+				s.next() // line continuation
+			default:
+				lit.WriteRune(s.next())
+			}
+		case ch == '\'':
+			flush()
+			s.next()
+			word.Parts = append(word.Parts, SglQuoted{Value: s.readUntil(pos, '\'')})
+		case ch == '"':
+			flush()
+			word.Parts = append(word.Parts, s.readDblQuoted())
+		case ch == '$' && s.peek(1) == '\'':
+			flush()
+			s.next()
+			s.next()
+			word.Parts = append(word.Parts, AnsiCQuoted{Value: s.readAnsiC(pos)})
+		case ch == '$':
+			if part, ok := s.readParam(); ok {
+				flush()
+				word.Parts = append(word.Parts, part)
+			} else {
+				lit.WriteRune('$')
+			}
+		case ch == '`':
+			panic(newError(pos, "command substitution is not supported"))
+		case ch == '*' || ch == '?':
+			panic(newError(pos, "glob patterns are not supported, quote %q to use it literally", ch))
+		default:
+			lit.WriteRune(s.next())
+		}
+	}
+}
+
+func (s *scanner) readUntil(opener Pos, ender rune) string {
+	var start = s.offset
+	for s.peek(0) != ender {
+		if s.peek(0) == 0 {
+			panic(newError(opener, "unterminated quoted string"))
+		}
+		s.next()
+	}
+	var value = string(s.src[start:s.offset])
+	s.next() // skip ender
+	return value
+}
+
+func (s *scanner) readDblQuoted() DblQuoted {
+	var opener = s.pos()
+	s.next() // skip "
+
+	var dq DblQuoted
+	var lit strings.Builder
+	var flush = func() {
+		if lit.Len() > 0 {
+			dq.Parts = append(dq.Parts, Lit{Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for {
+		var pos = s.pos()
+		switch ch := s.peek(0); ch {
+		case 0:
+			panic(newError(opener, "unterminated quoted string"))
+		case '"':
+			s.next()
+			flush()
+			return dq
+		case '\\':
+			s.next()
+			switch s.peek(0) {
+			case '$', '`', '"', '\\':
+				lit.WriteRune(s.next())
+			case '\n':
+				s.next() // line continuation
+			default:
+				lit.WriteRune('\\')
+			}
+		case '$':
+			if part, ok := s.readParam(); ok {
+				flush()
+				dq.Parts = append(dq.Parts, part)
+			} else {
+				lit.WriteRune('$')
+			}
+		case '`':
+			panic(newError(pos, "command substitution is not supported"))
+		default:
+			lit.WriteRune(s.next())
+		}
+	}
+}
+
+// readParam reads $name, ${name} or $1. It returns false if the $ is a
+// literal dollar sign, e.g. in "costs 5$".
+func (s *scanner) readParam() (WordPart, bool) {
+	var pos = s.pos()
+	switch ch := s.peek(1); {
+	case ch == '{':
+		s.next()
+		s.next()
+		var start = s.offset
+		for isNameMiddle(s.peek(0)) {
+			s.next()
+		}
+		var name = string(s.src[start:s.offset])
+		if name == "" || s.peek(0) != '}' {
+			panic(newError(pos, "only ${name} parameter expansions are supported"))
+		}
+		s.next()
+		return ParamExp{Name: name}, true
+	case isNameFirst(ch):
+		s.next()
+		var start = s.offset
+		for isNameMiddle(s.peek(0)) {
+			s.next()
+		}
+		return ParamExp{Name: string(s.src[start:s.offset])}, true
+	case '0' <= ch && ch <= '9':
+		s.next()
+		s.next()
+		return ParamExp{Name: string(ch)}, true
+	case ch == '(':
+		panic(newError(pos, "command substitution is not supported"))
+	case strings.ContainsRune("@*#?$!-", ch):
+		panic(newError(pos, "special parameter $%c is not supported", ch))
+	default:
+		s.next()
+		return nil, false
+	}
+}
+
+// readAnsiC reads the body of $'...' and decodes its escape sequences.
+func (s *scanner) readAnsiC(opener Pos) string {
+	var b strings.Builder
+	for {
+		var pos = s.pos()
+		switch ch := s.next(); ch {
+		case 0:
+			panic(newError(opener, "unterminated quoted string"))
+		case '\'':
+			return b.String()
+		case '\\':
+			var esc = s.next()
+			switch esc {
+			case 'a':
+				b.WriteRune('\a')
+			case 'b':
+				b.WriteRune('\b')
+			case 'e', 'E':
+				b.WriteRune('\x1b')
+			case 'f':
+				b.WriteRune('\f')
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			case 'v':
+				b.WriteRune('\v')
+			case '\\', '\'', '"', '?':
+				b.WriteRune(esc)
+			case 'x':
+				b.WriteByte(byte(s.readNumber(pos, 16, 2)))
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				var start = s.offset - 1
+				for s.offset-start < 3 && '0' <= s.peek(0) && s.peek(0) <= '7' {
+					s.next()
+				}
+				var n, _ = strconv.ParseUint(string(s.src[start:s.offset]), 8, 8)
+				b.WriteByte(byte(n))
+			default:
+				b.WriteRune('\\')
+				b.WriteRune(esc)
+			}
+		default:
+			b.WriteRune(ch)
+		}
+	}
+}
+
+func (s *scanner) readNumber(pos Pos, base int, maxLen int) rune {
+	var start = s.offset
+	for s.offset-start < maxLen && strings.ContainsRune("0123456789abcdefABCDEF", s.peek(0)) {
+		s.next()
+	}
+	var n, err = strconv.ParseUint(string(s.src[start:s.offset]), base, 32)
+	if err != nil {
+		panic(newError(pos, "invalid escape sequence: %v", err))
+	}
+	return rune(n)
+}
+
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+func newError(pos Pos, f string, args ...any) Error {
+	return Error{Pos: pos, Msg: fmt.Sprintf(f, args...)}
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Position is a human readable position. Line and Column are 1-based,
+// Column counts runes.
+type Position struct {
+	Filename string
+	Offset   int // rune offset in the file
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns "file:line:column", "line:column" if there is no file
+// name, or "-" if the position is invalid.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// File is a source file that belongs to a FileSet. A Pos in the file is the
+// base of the file plus the rune offset in the file.
+type File struct {
+	name  string
+	base  Pos
+	size  int   // in runes
+	lines []int // the offset of the first rune of each line
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Base() Pos {
+	return f.base
+}
+
+// Size is the number of runes in the file.
+func (f *File) Size() int {
+	return f.size
+}
+
+// Pos returns the Pos of a rune offset in the file.
+func (f *File) Pos(offset int) Pos {
+	return f.base + Pos(offset)
+}
+
+// Offset returns the rune offset of a Pos in the file.
+func (f *File) Offset(p Pos) int {
+	return int(p - f.base)
+}
+
+// LineCol returns the 0-based line and column of p, in O(log n) where n is
+// the number of lines.
+func (f *File) LineCol(p Pos) (int, int) {
+	var offset = f.Offset(p)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > f.size {
+		offset = f.size
+	}
+	var line = sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return line, offset - f.lines[line]
+}
+
+// Contains reports whether p is in the file, the end of the file included.
+func (f *File) Contains(p Pos) bool {
+	return p >= f.base && int(p-f.base) <= f.size
+}
+
+func (f *File) Position(p Pos) Position {
+	var line, column = f.LineCol(p)
+	return Position{
+		Filename: f.name,
+		Offset:   f.Offset(p),
+		Line:     line + 1,
+		Column:   column + 1,
+	}
+}
+
+// FileSet assigns non-overlapping ranges of Pos to files, so that a Pos
+// identifies the file as well as the position in it. The first file starts
+// at 0, so positions in a single file are plain rune offsets.
+type FileSet struct {
+	files []*File
+	base  Pos
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// AddFile adds a file with the given content.
+func (s *FileSet) AddFile(name string, src []rune) *File {
+	var f = &File{
+		name:  name,
+		base:  s.base,
+		size:  len(src),
+		lines: []int{0},
+	}
+	for i, r := range src {
+		if r == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	// +1, so that the end of a file is not the start of the next one
+	s.base += Pos(len(src) + 1)
+	s.files = append(s.files, f)
+	return f
+}
+
+// File returns the file that contains p, or nil.
+func (s *FileSet) File(p Pos) *File {
+	var i = sort.Search(len(s.files), func(i int) bool { return s.files[i].base > p }) - 1
+	if i < 0 || !s.files[i].Contains(p) {
+		return nil
+	}
+	return s.files[i]
+}
+
+// Position returns the position of p, or an invalid position if p is not
+// in any file.
+func (s *FileSet) Position(p Pos) Position {
+	var f = s.File(p)
+	if f == nil {
+		return Position{}
+	}
+	return f.Position(p)
+}
@@ -0,0 +1,93 @@
+package scanner_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/syntax/token"
+)
+
+func TestFileSet(tt *testing.T) {
+	var fset = scanner.NewFileSet()
+	var s1 = scanner.NewFileScanner(fset, "a.well", strings.NewReader("let a = 1\nlet b = 2\n"))
+	var s2 = scanner.NewFileScanner(fset, "deploy.well", strings.NewReader("// ö\n\nlet c = 3"))
+
+	var testCases = []struct {
+		pos  scanner.Pos
+		want string
+	}{
+		{0, "a.well:1:1"},
+		{14, "a.well:2:5"},
+		{20, "a.well:3:1"},
+		{s2.File().Base(), "deploy.well:1:1"},
+		{s2.File().Base() + 2, "deploy.well:1:3"},
+		{s2.File().Base() + 10, "deploy.well:3:5"},
+		{s2.File().Base() + 100, "-"},
+	}
+	for i, tc := range testCases {
+		var got = fset.Position(tc.pos).String()
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+	}
+
+	if s1.File().Base() != 0 {
+		tt.Fatalf("want the first file at base 0, got %d", s1.File().Base())
+	}
+
+	var got []scanner.Token
+	for {
+		var t, err = s2.NextToken()
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if t.Typ == token.EOF {
+			break
+		}
+		if t.Typ == token.IDENTIFIER {
+			got = append(got, t)
+		}
+	}
+	var want = []scanner.Token{
+		{token.IDENTIFIER, "let", s2.File().Base() + 6},
+		{token.IDENTIFIER, "c", s2.File().Base() + 10},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		tt.Fatalf("mismatching results\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestMarkSpan(tt *testing.T) {
+	var s = scanner.NewScanner(strings.NewReader("let x = f(1, 2)\nlet y = {\n}"))
+	var testCases = []struct {
+		at, end scanner.Pos
+		want    []string
+	}{
+		{
+			at: 8, end: 15,
+			want: []string{
+				"let x = f(1, 2)",
+				"        ⌃‾‾‾‾‾‾",
+				"        │",
+				"        ╰─── at line 1 column 9: msg",
+			},
+		},
+		{
+			at: 24, end: 27,
+			want: []string{
+				"let y = {",
+				"        ⌃",
+				"        │",
+				"        ╰─── at line 2 column 9: msg",
+			},
+		},
+	}
+	for i, tc := range testCases {
+		var got = s.MarkSpan(tc.at, tc.end, "msg", false)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", i, diff)
+		}
+	}
+}
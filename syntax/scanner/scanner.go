@@ -9,7 +9,8 @@ import (
 )
 
 type Scanner struct {
-	src []rune
+	src  []rune
+	file *File
 
 	currToken    Token
 	currRune     rune
@@ -23,6 +24,7 @@ type Scanner struct {
 	debug bool
 }
 
+// Pos is a rune offset in a FileSet, see File.Pos.
 type Pos int
 
 type Token struct {
@@ -42,7 +44,15 @@ func (t Token) ShortString() string {
 	return fmt.Sprintf("%s(%s) at %d", t.Typ, token.LiteralStringer(t.Lit), t.Pos)
 }
 
+// NewScanner returns a scanner for a source that is not part of any other
+// FileSet, i.e. positions are rune offsets in src.
 func NewScanner(src io.Reader) *Scanner {
+	return NewFileScanner(NewFileSet(), "", src)
+}
+
+// NewFileScanner adds the source to the file set, and returns a scanner
+// for it.
+func NewFileScanner(fset *FileSet, filename string, src io.Reader) *Scanner {
 	var s, err = io.ReadAll(src)
 	if err != nil {
 		panic(err)
@@ -50,10 +60,16 @@ func NewScanner(src io.Reader) *Scanner {
 	var scanner = &Scanner{
 		src: []rune(string(s)),
 	}
+	scanner.file = fset.AddFile(filename, scanner.src)
 	scanner.readRune()
 	return scanner
 }
 
+// File returns the file being scanned.
+func (s *Scanner) File() *File {
+	return s.file
+}
+
 const EndOfInput = 0
 
 func (p *Scanner) SetDebug(debug bool) {
@@ -87,6 +103,7 @@ func (s *Scanner) readRune() {
 
 func (s *Scanner) NextToken() (Token, error) {
 	var t, err = s.nextToken()
+	t.Pos = s.file.Pos(int(t.Pos))
 	s.currToken = t
 	if err != nil {
 		s.readRune() // skip
@@ -328,6 +345,17 @@ func (s *Scanner) readString(ender rune) (Token, error) {
 				string(s.src[position:s.position]),
 				Pos(position),
 			}, nil
+		case EndOfInput:
+			if s.position < len(s.src) {
+				// a NUL character in the string
+				s.readRune()
+				continue
+			}
+			return Token{
+				token.ILLEGAL,
+				string(s.src[position:]),
+				Pos(position),
+			}, fmt.Errorf("unterminated string, expected %c", ender)
 		default:
 			s.readRune()
 		}
@@ -427,8 +455,23 @@ func (s *Scanner) readNumber() (Token, error) {
 }
 
 func (s *Scanner) MarkAt(at Pos, msg string, showWhitespaces bool) []string {
+	return s.MarkSpan(at, at, msg, showWhitespaces)
+}
+
+// MarkSpan is like MarkAt, but it also underlines the runes up to end. Spans
+// that end on a later line are underlined up to the end of the first line.
+func (s *Scanner) MarkSpan(at, end Pos, msg string, showWhitespaces bool) []string {
 	var lines = strings.Split(string(s.src), "\n")
 	var line, column = s.GetLineColAt(at)
+	var width = 1
+	if endLine, endColumn := s.GetLineColAt(end); endLine > line {
+		width = len([]rune(lines[line])) - column
+	} else if endColumn > column {
+		width = endColumn - column
+	}
+	if width < 1 {
+		width = 1
+	}
 
 	var prefix = ""
 	var linestr = lines[line]
@@ -454,7 +497,7 @@ func (s *Scanner) MarkAt(at Pos, msg string, showWhitespaces bool) []string {
 	}
 	return []string{
 		fmt.Sprintf("%s%s", prefix, linestr),
-		fmt.Sprintf("%s%s⌃", prefix, indent.String()),
+		fmt.Sprintf("%s%s⌃%s", prefix, indent.String(), strings.Repeat("‾", width-1)),
 		fmt.Sprintf("%s%s│", prefix, indent.String()),
 		fmt.Sprintf("%s%s╰─── at line %d column %d: %s", prefix, indent.String(), line+1, column+1, msg),
 	}
@@ -520,20 +563,11 @@ func FormatSrc(src string, showWhitespaces bool) string {
 	return src
 }
 
+// GetLineColAt returns the 0-based line and column of pos.
 func (s *Scanner) GetLineColAt(pos Pos) (int, int) {
-	var line = 0
-	var column = 0
-	for i := 0; i < int(pos) && i < len(s.src); i++ {
-		if s.src[i] == '\n' {
-			line += 1
-			column = 0
-		} else {
-			column += 1
-		}
-	}
-	return line, column
+	return s.file.LineCol(pos)
 }
 
 func (s *Scanner) getCurrPosition() (int, int) {
-	return s.GetLineColAt(Pos(s.position))
+	return s.GetLineColAt(s.file.Pos(s.position))
 }
@@ -136,3 +136,45 @@ func TestIdentifier(tt *testing.T) {
 		}
 	}
 }
+
+func TestUnterminatedString(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want scanner.Token
+		err  string
+	}{
+		{
+			src:  `"abc`,
+			want: scanner.Token{token.ILLEGAL, `"abc`, 0},
+			err:  `unterminated string, expected "`,
+		},
+		{
+			src:  `"abc\`,
+			want: scanner.Token{token.ILLEGAL, `"abc\`, 0},
+			err:  `unterminated string, expected "`,
+		},
+		{
+			src:  "`abc",
+			want: scanner.Token{token.ILLEGAL, "`abc", 0},
+			err:  "unterminated string, expected `",
+		},
+		{
+			src:  "\"a\x00b\"",
+			want: scanner.Token{token.STRING, "\"a\x00b\"", 0},
+		},
+	}
+
+	for ti, tc := range testCases {
+		var s = scanner.NewScanner(strings.NewReader(tc.src))
+		var got, err = s.NextToken()
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+			tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching token (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+		if next, _ := s.NextToken(); next.Typ != token.EOF {
+			tt.Fatalf("expected EOF after the string (test case %d), got %s", ti, next.ShortString())
+		}
+	}
+}
@@ -33,6 +33,10 @@ func TestEncodeToCmdArgs(tt *testing.T) {
 			want:   []string{"echo", "Hello sina!"},
 			values: map[string]interface{}{"name": "sina"},
 		},
+		{
+			src:  `echo it\'s «a \"quoted\" word»`,
+			want: []string{"echo", "it's", `a "quoted" word`},
+		},
 		{
 			src:    `jq «.${key:%q} | .»`,
 			want:   []string{"jq", `."a long key" | .`},
@@ -48,6 +52,21 @@ func TestEncodeToCmdArgs(tt *testing.T) {
 			want:   []string{"jq", `. a long key `},
 			values: map[string]interface{}{"key": "a long key"},
 		},
+		{
+			src:    `ls ${flags|"-l -a"} ${dir:%q|"my dir"} ${set+"-v"}${unset+"-q"}`,
+			want:   []string{"ls", "-l", "-a", "my dir", "-v"},
+			values: map[string]interface{}{"set": ""},
+		},
+		{
+			src:    `rm -- ${files} ${none}-f ${files:%q}`,
+			want:   []string{"rm", "--", "my file.txt", "", "b", "-f", "my file.txt", "", "b"},
+			values: map[string]interface{}{"files": []string{"my file.txt", "", "b"}, "none": []string{}},
+		},
+		{
+			src:    `sh -c «ls ${files:%Q}» «${files:", "}» -I${dirs}/x`,
+			want:   []string{"sh", "-c", `ls 'a b' 'it\'s'`, "a b, it's", "-Ia", "b/x"},
+			values: map[string]interface{}{"files": []string{"a b", "it's"}, "dirs": []string{"a", "b"}},
+		},
 		{
 			src:  `abc « «1» ««2»» »`,
 			want: []string{"abc", ` "1" "\"2\"" `},
@@ -93,3 +112,45 @@ func TestEncodeToCmdArgs(tt *testing.T) {
 		}
 	}
 }
+
+func FuzzExpandPrinted(f *testing.F) {
+	for _, src := range []string{
+		`ls -lash "./some dir"`,
+		`sh -c «echo ‹${name:%q}› \«x\» 'it\'s' ${list}»`,
+		`a\b\ \$ ${x|"\"d\""} ${list:%Q", "?"msg"} ${z.w:%s+"-v"}`,
+		`${x:0}`,
+	} {
+		f.Add(src)
+	}
+	var mapping = func(name string) interface{} {
+		if strings.HasPrefix(name, "list") {
+			return []string{"a b", "", name}
+		}
+		return name + " value"
+	}
+	f.Fuzz(func(tt *testing.T, src string) {
+		var root, err = parser.NewParser().Parse(strings.NewReader(src))
+		if err != nil {
+			return
+		}
+		printed, err := parser.Print(root)
+		if err != nil {
+			tt.Fatalf("print failed src=%q: %v", src, err)
+		}
+		reparsed, err := parser.NewParser().Parse(strings.NewReader(printed))
+		if err != nil {
+			tt.Fatalf("parsing the printed source failed src=%q printed=%q: %v", src, printed, err)
+		}
+
+		var want, wantErr = expander.EncodeToCmdArgs(root, mapping)
+		var got, gotErr = expander.EncodeToCmdArgs(reparsed, mapping)
+		if diff := cmp.Diff(want, got); diff != "" || (wantErr == nil) != (gotErr == nil) {
+			tt.Fatalf("mismatching args src=%q printed=%q errors=%v, %v\ndiff guide:\n  - want\n  + got\ndiff:\n%s", src, printed, wantErr, gotErr, diff)
+		}
+		wantStr, wantErr := expander.EncodeToString(root, mapping, expander.Basic)
+		gotStr, gotErr := expander.EncodeToString(reparsed, mapping, expander.Basic)
+		if wantStr != gotStr || (wantErr == nil) != (gotErr == nil) {
+			tt.Fatalf("mismatching strings src=%q printed=%q: %q (%v) and %q (%v)", src, printed, wantStr, wantErr, gotStr, gotErr)
+		}
+	})
+}
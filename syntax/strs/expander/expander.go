@@ -2,6 +2,7 @@ package expander
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
@@ -22,63 +23,30 @@ func MappingFuncFromMap(m map[string]interface{}) func(string) interface{} {
 	}
 }
 
-type QuotingVariant int
-
-const (
-	// Just use backslash to escape ' and "
-	Basic QuotingVariant = iota
-	// BashAnsiCVariant returns $'it\'s great' instead of 'it\'s great'.
-	// The dollar sign is required for bash, otherwise it won't work.
-	// https://stackoverflow.com/questions/6697753/difference-between-single-and-double-quotes-in-bash/42082956#42082956
-	// TODO: This mode must also replace ` with \`, but so far I decided not to support it.
-	// TODO: Remove this variant. I don't want to support Bash syntax. Anything you do with Bash should be possible with Well.
-	BashAnsiCVariant
-)
-
-var quotingVariant = Basic // BashAnsiCVariant
-
-// TODO: this is a toy implemntation, please rewrite, see also: strconv.Quote
-func EscapeQuote(s string, typ scanner.CmdTokenType) (string, error) {
-	switch typ {
-	case scanner.LDOUBLE_GUILLEMET, scanner.DOUBLE_QUOTE:
-		return fmt.Sprintf("%q", s), nil
-	case scanner.LSINGLE_GUILLEMET, scanner.SINGLE_QUOTE:
-		return EscapeSinglequote(s), nil
-	default:
-		return "", fmt.Errorf("unsupported quote %s", typ)
-	}
-}
-
-func EscapeSinglequote(s string) string {
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	s = strings.ReplaceAll(s, `'`, `\'`)
-	switch quotingVariant {
-	case BashAnsiCVariant:
-		return fmt.Sprintf("$'%s'", s)
-	case Basic:
-		return fmt.Sprintf("'%s'", s)
-	default:
-		panic(fmt.Sprintf("unsupported quotingVariant %d", quotingVariant))
-	}
-}
-
-func ParseAndEncodeToString(src string, mapping func(string) interface{}, debug bool) (string, error) {
+func ParseAndEncodeToString(src string, mapping func(string) interface{}, target Target, debug bool) (string, error) {
 	var p = parser.NewParser()
 	p.SetDebug(debug)
 	var node, parseErr = p.Parse(strings.NewReader(src))
 	if parseErr != nil {
 		return "", parseErr
 	}
-
-	var s, convertErr = convertToExecNode(node, true, mapping)
-	if convertErr != nil {
-		return "", convertErr
-	}
-	return s.Value(), nil
+	return EncodeToString(node, mapping, target)
 }
 
-func EncodeToString(root *parser.Root, mapping func(string) interface{}) (string, error) {
-	var s, err = convertToExecNode(root, true, mapping)
+// EncodeToString renders root with its containers quoted for target.
+func EncodeToString(root *parser.Root, mapping func(string) interface{}, target Target) (string, error) {
+	if target == JSONArgv {
+		var args, err = EncodeToCmdArgs(root, mapping)
+		if err != nil {
+			return "", err
+		}
+		if args == nil {
+			args = []string{}
+		}
+		var byts, _ = json.Marshal(args) // strings cannot fail
+		return string(byts), nil
+	}
+	var s, err = convertToExecNode(root, true, mapping, target)
 	if err != nil {
 		return "", err
 	}
@@ -86,8 +54,28 @@ func EncodeToString(root *parser.Root, mapping func(string) interface{}) (string
 }
 
 type Variable struct {
-	Name string
-	Type string
+	Name     string
+	Type     string
+	Optional bool // the variable has a default or an alternate value
+}
+
+// UndefinedError is returned when a variable is not set, i.e. the mapping
+// returns nil, and it has no default or alternate value.
+type UndefinedError struct {
+	Name     string
+	Required bool   // the variable has a ? modifier
+	Message  string // of the ? modifier
+}
+
+func (e *UndefinedError) Error() string {
+	switch {
+	case e.Message != "":
+		return fmt.Sprintf("variable %s is not set: %s", e.Name, e.Message)
+	case e.Required:
+		return fmt.Sprintf("variable %s is not set", e.Name)
+	default:
+		return fmt.Sprintf("variable %s is <nil>", e.Name)
+	}
 }
 
 func GetVariables(src string) ([]Variable, error) {
@@ -98,9 +86,9 @@ func GetVariables(src string) ([]Variable, error) {
 	}
 
 	var variables []Variable
-	var f = func(name, opts string) {
+	var f = func(v parser.Var) {
 		var typ string
-		switch opts {
+		switch v.Opts {
 		case "":
 			typ = "string"
 		case "%s":
@@ -112,7 +100,14 @@ func GetVariables(src string) ([]Variable, error) {
 		case "%d":
 			typ = "int"
 		}
-		variables = append(variables, Variable{name, typ})
+		if v.Sep != nil {
+			typ = "[]" + typ
+		}
+		variables = append(variables, Variable{
+			Name:     v.Name,
+			Type:     typ,
+			Optional: v.Modifier == parser.Default || v.Modifier == parser.Alternate,
+		})
 	}
 	var err = findVars(root, f)
 	if err != nil {
@@ -134,26 +129,39 @@ func EncodeToCmdArgs(root *parser.Root, mapping func(string) interface{}) ([]str
 	// is parsed as (.) and (" hello world ") and we need to join the two, because
 	// there's no space between them, and return (." hello world ") as 1 arg.
 	var currArgBuf bytes.Buffer
+	// keepArg is true if the current arg is an item of a list, which is an
+	// argument even if it is empty
+	var keepArg bool
 
 	var growArg = func(fragment string) {
 		currArgBuf.WriteString(fragment)
 	}
 
 	var commitArg = func() {
-		if currArgBuf.String() == "" {
+		if currArgBuf.String() == "" && !keepArg {
 			// nothing to commit
 			return
 		}
 		args = append(args, currArgBuf.String())
 		currArgBuf.Reset()
+		keepArg = false
 	}
 
 	for _, item := range root.Items {
-		var arg, err = convertToExecNode(item, false, mapping)
+		var arg, err = convertToExecNode(item, false, mapping, Basic)
 		if err != nil {
 			return nil, err
 		}
-		switch arg.(type) {
+		switch arg := arg.(type) {
+		case ExecList:
+			// each item is an argument, items are not split on whitespace
+			for i, item := range arg.Items {
+				if i > 0 {
+					commitArg()
+				}
+				growArg(item)
+				keepArg = true
+			}
 		case ExecVar:
 			var words = WhitespaceRe.Split(arg.Value(), -1)
 			for i, w := range words {
@@ -170,14 +178,12 @@ func EncodeToCmdArgs(root *parser.Root, mapping func(string) interface{}) ([]str
 	}
 
 	// last arg
-	if currArgBuf.String() != "" {
-		commitArg()
-	}
+	commitArg()
 
 	return args, nil
 }
 
-func findVars(node parser.CmdNode, onFound func(string, string)) error {
+func findVars(node parser.CmdNode, onFound func(parser.Var)) error {
 	switch item := node.(type) {
 	case *parser.Root:
 		for _, item := range item.Items {
@@ -200,33 +206,69 @@ func findVars(node parser.CmdNode, onFound func(string, string)) error {
 	case parser.Wrd:
 		return nil
 	case parser.Var:
-		onFound(item.Name, item.Opts)
+		onFound(item)
+		return nil
+	case parser.Expr:
+		// expressions are not variables
 		return nil
 	default:
 		panic(fmt.Sprintf("unsupported encoding for node type %T", item))
 	}
 }
 
-func convertToExecNode(node parser.CmdNode, escapeOuter bool, mapping func(string) interface{}) (ExecNode, error) {
+func convertToExecNode(node parser.CmdNode, escapeOuter bool, mapping func(string) interface{}, target Target) (ExecNode, error) {
 	// fmt.Printf("[---] convertToExecNode: %#v (escapeOuter=%v)\n", node, escapeOuter)
 	switch item := node.(type) {
 	case *parser.Root:
 		var args []string
 		for _, item := range item.Items {
-			var arg, err = convertToExecNode(item, escapeOuter, mapping)
+			var arg, err = convertToExecNode(item, escapeOuter, mapping, target)
 			if err != nil {
 				return nil, err
 			}
-			args = append(args, arg.Value())
+			switch arg := arg.(type) {
+			case ExecList:
+				// quote the items, so that the result has the same
+				// arguments. The interpreter only needs the items that
+				// would otherwise be split or dropped quoted, a shell also
+				// needs its metacharacters quoted.
+				var items []string
+				for _, item := range arg.Items {
+					if !arg.Quoted && (target != Basic || item == "" || WhitespaceRe.MatchString(item)) {
+						item, err = EscapeQuote(item, scanner.DOUBLE_QUOTE, target)
+						if err != nil {
+							return nil, err
+						}
+					}
+					items = append(items, item)
+				}
+				args = append(args, strings.Join(items, " "))
+			case ExecVar:
+				if target == Basic {
+					args = append(args, arg.Value())
+					continue
+				}
+				var quoted, err = quoteFields(arg.Value(), target)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, quoted)
+			default:
+				args = append(args, arg.Value())
+			}
 		}
 		return ExecWrd{strings.Join(args, "")}, nil
 	case parser.ContainerNode:
 		var args []string
-		for _, item := range item.Items {
-			var arg, err = convertToExecNode(item, true, mapping)
+		for _, child := range item.Items {
+			var arg, err = convertToExecNode(child, true, mapping, target)
 			if err != nil {
 				return nil, err
 			}
+			if list, ok := arg.(ExecList); ok {
+				args = append(args, strings.Join(list.Items, listSep(child)))
+				continue
+			}
 			args = append(args, arg.Value())
 		}
 
@@ -234,9 +276,9 @@ func convertToExecNode(node parser.CmdNode, escapeOuter bool, mapping func(strin
 		if !escapeOuter {
 			return ExecWrd{Lit: s}, nil
 		} else {
-			var s, err = EscapeQuote(s, item.Type)
+			var s, err = EscapeQuote(s, item.Type, target)
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
 			return ExecWrd{Lit: s}, nil
 		}
@@ -245,17 +287,101 @@ func convertToExecNode(node parser.CmdNode, escapeOuter bool, mapping func(strin
 	case parser.Wrd:
 		return ExecWrd{Lit: item.Lit}, nil
 	case parser.Var:
-		var val = mapping(item.Name)
-		if val == nil {
-			return nil, fmt.Errorf("variable %s is %v", item.Name, val)
+		var val, err = modify(item, mapping(item.Name))
+		if err != nil {
+			return nil, err
 		}
-		return varFormatter(val, item.Opts, escapeOuter)
+		if list, ok := val.([]string); ok {
+			// the items are formatted one by one, e.g. %q quotes each item
+			var items = make([]string, 0, len(list))
+			for _, v := range list {
+				var item, err = varFormatter(v, item.Opts, escapeOuter, target)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item.Value())
+			}
+			var quoted = escapeOuter && (item.Opts == "%q" || item.Opts == "%Q")
+			return ExecList{Items: items, Quoted: quoted}, nil
+		}
+		return varFormatter(val, item.Opts, escapeOuter, target)
+	case parser.Expr:
+		// the mapping returns the value of the expression, given its source,
+		// an error if the expression has no value, or nil if it does not
+		// evaluate expressions
+		var val = mapping(item.Src)
+		switch val := val.(type) {
+		case nil:
+			return nil, fmt.Errorf("cannot evaluate ${%s}, expressions are only supported in Well programs", item.Src)
+		case error:
+			return nil, fmt.Errorf("cannot evaluate ${%s}: %w", item.Src, val)
+		}
+		var v = parser.Var{Name: item.Src, Opts: item.Opts, Sep: item.Sep}
+		return convertToExecNode(v, escapeOuter, func(string) interface{} { return val }, target)
 	default:
 		panic(fmt.Sprintf("unsupported encoding for node type %T", item))
 	}
 }
 
-func varFormatter(v interface{}, flags string, escapeOuter bool) (ExecNode, error) {
+// quoteFields quotes each of the whitespace separated fields of an unquoted
+// value for target, so that a shell splits it into the same arguments as
+// EncodeToCmdArgs, and none of its metacharacters, e.g. ; or $(, run.
+func quoteFields(s string, target Target) (string, error) {
+	var fields = WhitespaceRe.Split(s, -1)
+	for i, field := range fields {
+		if field == "" {
+			continue
+		}
+		var quoted, err = EscapeQuote(field, scanner.DOUBLE_QUOTE, target)
+		if err != nil {
+			return "", err
+		}
+		fields[i] = quoted
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// listSep returns the separator of the items of a list variable in a
+// container.
+func listSep(node parser.CmdNode) string {
+	var sep *string
+	switch node := node.(type) {
+	case parser.Var:
+		sep = node.Sep
+	case parser.Expr:
+		sep = node.Sep
+	}
+	if sep == nil {
+		return " "
+	}
+	return *sep
+}
+
+// modify returns the value of v, given the value of its variable, which is
+// nil if the variable is not set.
+func modify(v parser.Var, val interface{}) (interface{}, error) {
+	switch v.Modifier {
+	case parser.Default:
+		if val == nil {
+			return v.Value, nil
+		}
+	case parser.Required:
+		if val == nil {
+			return nil, &UndefinedError{Name: v.Name, Required: true, Message: v.Value}
+		}
+	case parser.Alternate:
+		if val == nil {
+			return "", nil
+		}
+		return v.Value, nil
+	}
+	if val == nil {
+		return nil, &UndefinedError{Name: v.Name}
+	}
+	return val, nil
+}
+
+func varFormatter(v interface{}, flags string, escapeOuter bool, target Target) (ExecNode, error) {
 	// fmt.Printf("[===] varFormatter:%#v flags=%q\n", v, flags)
 	switch flags {
 	case "":
@@ -271,7 +397,7 @@ func varFormatter(v interface{}, flags string, escapeOuter bool) (ExecNode, erro
 				Items: []parser.CmdNode{
 					parser.Wrd{Lit: fmt.Sprintf("%s", v)},
 				},
-			}, escapeOuter, nil)
+			}, escapeOuter, nil, target)
 	case "%Q":
 		return convertToExecNode(
 			parser.ContainerNode{
@@ -279,10 +405,10 @@ func varFormatter(v interface{}, flags string, escapeOuter bool) (ExecNode, erro
 				Items: []parser.CmdNode{
 					parser.Wrd{Lit: fmt.Sprintf("%s", v)},
 				},
-			}, escapeOuter, nil)
+			}, escapeOuter, nil, target)
 	case "%-":
 		return ExecVar{Lit: fmt.Sprintf("%s", v)}, nil
 	default:
-		panic(fmt.Sprintf("unsupported variable flags %q", flags))
+		return nil, fmt.Errorf("unsupported variable flags %q", flags)
 	}
 }
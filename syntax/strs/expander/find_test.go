@@ -16,7 +16,21 @@ func TestGetVariables(tt *testing.T) {
 		{
 			src: `echo "Hello ${your_name}!"`,
 			want: []expander.Variable{
-				{"your_name", "string"},
+				{Name: "your_name", Type: "string"},
+			},
+		},
+		{
+			src: `ls ${flags|"-l"} ${dir:%q?"where?"} ${v:%d+"-v"}`,
+			want: []expander.Variable{
+				{Name: "flags", Type: "string", Optional: true},
+				{Name: "dir", Type: "string"},
+				{Name: "v", Type: "int", Optional: true},
+			},
+		},
+		{
+			src: `rm «${files:%q" "}»`,
+			want: []expander.Variable{
+				{Name: "files", Type: "[]string"},
 			},
 		},
 	}
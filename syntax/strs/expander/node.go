@@ -1,5 +1,7 @@
 package expander
 
+import "strings"
+
 type ExecWrd struct {
 	Lit string
 }
@@ -14,15 +16,24 @@ type ExecVar struct {
 	Lit string
 }
 
+// ExecList is a list variable outside of a container, each item is an
+// argument.
+type ExecList struct {
+	Items  []string
+	Quoted bool // the items are quoted, e.g. with %q
+}
+
 type ExecNode interface {
 	node()
 	Value() string
 }
 
-func (ExecWrd) node() {}
-func (ExecVar) node() {}
-func (ExecWhs) node() {}
+func (ExecWrd) node()  {}
+func (ExecVar) node()  {}
+func (ExecWhs) node()  {}
+func (ExecList) node() {}
 
-func (e ExecWrd) Value() string { return e.Lit }
-func (e ExecVar) Value() string { return e.Lit }
-func (e ExecWhs) Value() string { return e.Lit }
+func (e ExecWrd) Value() string  { return e.Lit }
+func (e ExecVar) Value() string  { return e.Lit }
+func (e ExecWhs) Value() string  { return e.Lit }
+func (e ExecList) Value() string { return strings.Join(e.Items, " ") }
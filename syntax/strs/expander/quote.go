@@ -0,0 +1,211 @@
+package expander
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/siadat/well/syntax/strs/scanner"
+)
+
+// Target is the language a rendered string is quoted for. Double containers
+// (« and ") and single containers (‹ and ') are quoted with the double and
+// single quotes of the target, if it has both.
+type Target int
+
+const (
+	// Basic escapes with backslashes, double containers are quoted like Go
+	// strings. It is the quoting of the Well interpreter.
+	Basic Target = iota
+	// POSIX quotes for sh. Double containers escape \ $ ` and ", single
+	// containers close the quote around '\''.
+	POSIX
+	// Bash is like POSIX, but single containers are ANSI-C quoted, e.g.
+	// $'it\'s\n'.
+	Bash
+	// Zsh is the same as POSIX.
+	Zsh
+	// Fish escapes \ and ' in single quotes, and \ $ and " in double quotes.
+	Fish
+	// PowerShell doubles the single quotes in single containers, and escapes
+	// ` $ and the double quotes with a backtick in double containers.
+	PowerShell
+	// Cmd quotes for batch files. Quotes are doubled, so that cmd.exe never
+	// sees an unquoted metacharacter, and backslashes are escaped as parsed
+	// by CommandLineToArgvW. Strings with newlines cannot be quoted.
+	Cmd
+	// JSONArgv renders the arguments of a command as a JSON array instead of
+	// a string. Nested containers are quoted like Basic, i.e. the arguments
+	// are the same as the ones "guillemets exec" runs.
+	JSONArgv
+)
+
+var targetNames = map[Target]string{
+	Basic:      "basic",
+	POSIX:      "posix",
+	Bash:       "bash",
+	Zsh:        "zsh",
+	Fish:       "fish",
+	PowerShell: "powershell",
+	Cmd:        "cmd",
+	JSONArgv:   "json-argv",
+}
+
+func (t Target) String() string {
+	if name, ok := targetNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Target(%d)", int(t))
+}
+
+// Targets returns the names of all targets.
+func Targets() []string {
+	var names = make([]string, len(targetNames))
+	for target, name := range targetNames {
+		names[target] = name
+	}
+	return names
+}
+
+// ParseTarget returns the target with the given name.
+func ParseTarget(name string) (Target, error) {
+	for target, targetName := range targetNames {
+		if targetName == name {
+			return target, nil
+		}
+	}
+	return Basic, fmt.Errorf("unknown target %q, expected one of %s", name, strings.Join(Targets(), ", "))
+}
+
+// EscapeQuote quotes s for target, using the double quotes of the target for
+// double containers and the single quotes for single containers.
+func EscapeQuote(s string, typ scanner.CmdTokenType, target Target) (string, error) {
+	var double bool
+	switch typ {
+	case scanner.LDOUBLE_GUILLEMET, scanner.DOUBLE_QUOTE:
+		double = true
+	case scanner.LSINGLE_GUILLEMET, scanner.SINGLE_QUOTE:
+		double = false
+	default:
+		return "", fmt.Errorf("unsupported quote %s", typ)
+	}
+
+	switch target {
+	case Basic, JSONArgv:
+		if double {
+			return fmt.Sprintf("%q", s), nil
+		}
+		return EscapeSinglequote(s), nil
+	case POSIX, Zsh:
+		if double {
+			return posixDoubleQuote(s), nil
+		}
+		return posixSingleQuote(s), nil
+	case Bash:
+		if double {
+			return posixDoubleQuote(s), nil
+		}
+		return ansiCQuote(s), nil
+	case Fish:
+		if double {
+			return `"` + escape(s, `\"$`, `\`) + `"`, nil
+		}
+		return `'` + escape(s, `\'`, `\`) + `'`, nil
+	case PowerShell:
+		if double {
+			return `"` + escape(s, "`$\"“”„", "`") + `"`, nil
+		}
+		return `'` + escape(s, `'‘’‚‛`, `'`) + `'`, nil
+	case Cmd:
+		return cmdQuote(s)
+	default:
+		return "", fmt.Errorf("unsupported target %s", target)
+	}
+}
+
+// EscapeSinglequote quotes s for Basic.
+func EscapeSinglequote(s string) string {
+	return `'` + escape(s, `\'`, `\`) + `'`
+}
+
+// escape returns s with prefix before each of the runes in chars.
+func escape(s string, chars string, prefix string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteString(prefix)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func posixDoubleQuote(s string) string {
+	return `"` + escape(s, "\\$`\"", `\`) + `"`
+}
+
+func posixSingleQuote(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `'\''`) + `'`
+}
+
+// ansiCQuote returns a bash $'...' string. Control characters are escaped,
+// so that the result is on one line.
+func ansiCQuote(s string) string {
+	var b strings.Builder
+	b.WriteString(`$'`)
+	for i := 0; i < len(s); {
+		var r, size = utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+			// \x reads at most 2 hex digits, whatever follows
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	b.WriteString(`'`)
+	return b.String()
+}
+
+// cmdQuote quotes s as a single argument of a command in a batch file.
+func cmdQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", fmt.Errorf("cannot quote a newline for cmd")
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	var backslashes = 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			backslashes += 1
+			b.WriteRune(r)
+			continue
+		case '"':
+			// the backslashes before a quote escape each other, and a
+			// doubled quote is a literal quote that keeps cmd.exe inside
+			// the quoted string
+			b.WriteString(strings.Repeat(`\`, backslashes))
+			b.WriteString(`""`)
+		case '%':
+			b.WriteString(`%%`)
+		default:
+			b.WriteRune(r)
+		}
+		backslashes = 0
+	}
+	// the closing quote must not be escaped by trailing backslashes
+	b.WriteString(strings.Repeat(`\`, backslashes))
+	b.WriteByte('"')
+	return b.String(), nil
+}
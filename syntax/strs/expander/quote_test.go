@@ -0,0 +1,127 @@
+package expander_test
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/syntax/strs/expander"
+)
+
+var quoteInputs = []string{
+	``,
+	`plain`,
+	`it's`,
+	`a "quoted" word`,
+	`$HOME ${HOME} $(date) ` + "`date`",
+	`back\slash\ \\ and trailing\`,
+	"new\nline\ttab\rreturn \x01 \x7f",
+	`glob * ? [a] ~ ! # & | ; < > ( ) { }`,
+	`‘smart’ “quotes” „low‟ «guillemets» ‹single›`,
+	`100% %PATH% ^caret`,
+}
+
+func TestEncodeToStringTargets(tt *testing.T) {
+	var testCases = []struct {
+		src    string
+		target expander.Target
+		want   string
+		err    string
+	}{
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.Basic, want: `echo "it's $HOME" 'it\'s'`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.POSIX, want: `echo "it's \$HOME" 'it'\''s'`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.Bash, want: `echo "it's \$HOME" $'it\'s'`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.Zsh, want: `echo "it's \$HOME" 'it'\''s'`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.Fish, want: `echo "it's \$HOME" 'it\'s'`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.PowerShell, want: "echo \"it's `$HOME\" 'it''s'"},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.Cmd, want: `echo "it's $HOME" "it's"`},
+		{src: `echo «it\'s ${x}» ‹it\'s›`, target: expander.JSONArgv, want: `["echo","it's $HOME","it's"]`},
+		{src: `echo «${w}» «50%»`, target: expander.Cmd, want: `echo "a\\""b\\" "50%%"`},
+		{src: `echo «${y}»`, target: expander.Bash, want: `echo "a\\b"`},
+		{src: `echo ‹${y}›`, target: expander.Bash, want: `echo $'a\\b'`},
+		{src: `echo ‹${z}›`, target: expander.Bash, want: `echo $'1\n2\x01'`},
+		{src: `echo «${z}»`, target: expander.Cmd, err: `cannot quote a newline for cmd`},
+		{src: `sh -c «echo «${x}»»`, target: expander.POSIX, want: `sh -c "echo \"\\\$HOME\""`},
+		{src: ``, target: expander.JSONArgv, want: `[]`},
+		{src: `echo ${l}`, target: expander.Basic, want: "echo $(id) a;b it's `id`"},
+		{src: `echo ${l}`, target: expander.POSIX, want: "echo \"\\$(id)\" \"a;b\" \"it's\" \"\\`id\\`\""},
+		{src: `echo ${l}`, target: expander.JSONArgv, want: "[\"echo\",\"$(id)\",\"a;b\",\"it's\",\"`id`\"]"},
+	}
+
+	var values = map[string]interface{}{"x": "$HOME", "y": `a\b`, "z": "1\n2\x01", "w": `a\"b\`, "l": []string{"$(id)", "a;b", "it's", "`id`"}}
+	for ti, tc := range testCases {
+		var got, err = expander.ParseAndEncodeToString(tc.src, expander.MappingFuncFromMap(values), tc.target, false)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("render failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+// TestTargetsInShells checks that the shells read the quoted strings back as
+// the original strings, an unquoted variable as its whitespace separated
+// fields, and a list variable as its items. The shells that are not installed are skipped.
+func TestTargetsInShells(tt *testing.T) {
+	var shells = []struct {
+		target   expander.Target
+		argv     []string
+		srcs     []string
+		unquoted []string // printf concatenates the fields
+		lists    []string // printf prints each item followed by a dot
+	}{
+		{expander.POSIX, []string{"sh", "-c"}, []string{`printf %s «${s}»`, `printf %s ‹${s}›`, `sh -c «printf %s «${s}»»`}, []string{`printf %s ${s}`}, []string{`printf %s. ${l}`}},
+		{expander.Bash, []string{"bash", "-c"}, []string{`printf %s «${s}»`, `printf %s ‹${s}›`, `bash -c «printf %s ‹${s}›»`}, []string{`printf %s ${s}`}, []string{`printf %s. ${l}`}},
+		{expander.Zsh, []string{"zsh", "-c"}, []string{`printf %s «${s}»`, `printf %s ‹${s}›`}, []string{`printf %s ${s}`}, []string{`printf %s. ${l}`}},
+		{expander.Fish, []string{"fish", "-c"}, []string{`printf %s «${s}»`, `printf %s ‹${s}›`}, []string{`printf %s ${s}`}, []string{`printf %s. ${l}`}},
+		{expander.PowerShell, []string{"pwsh", "-NoProfile", "-Command"}, []string{`[Console]::Out.Write(«${s}»)`, `[Console]::Out.Write(‹${s}›)`}, nil, nil},
+	}
+
+	var run = func(tt *testing.T, path string, argv []string, target expander.Target, src, s, want string) {
+		var values = map[string]interface{}{"s": s, "l": []string{s, "$(id)", "a;b", "it's", "`id`", ""}}
+		var script, err = expander.ParseAndEncodeToString(src, expander.MappingFuncFromMap(values), target, false)
+		if err != nil {
+			tt.Fatalf("render failed (target %s, src %q, input %q): %v", target, src, s, err)
+		}
+		var cmd = exec.Command(path, append(argv[1:], script)...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			tt.Fatalf("running %s failed: %v\nscript: %s\nstderr: %s", argv[0], err, script, stderr.String())
+		}
+		if diff := cmp.Diff(want, stdout.String()); diff != "" {
+			tt.Fatalf("mismatching %s output\nscript: %s\ndiff guide:\n  - want\n  + got\ndiff:\n%s", argv[0], script, diff)
+		}
+	}
+
+	for _, shell := range shells {
+		var path, err = exec.LookPath(shell.argv[0])
+		if err != nil {
+			tt.Logf("skipped %s: %v", shell.target, err)
+			continue
+		}
+		for _, s := range quoteInputs {
+			for _, src := range shell.srcs {
+				run(tt, path, shell.argv, shell.target, src, s, s)
+			}
+			for _, src := range shell.unquoted {
+				var want = strings.Join(expander.WhitespaceRe.Split(s, -1), "")
+				run(tt, path, shell.argv, shell.target, src, s, want)
+			}
+			for _, src := range shell.lists {
+				var want = s + ".$(id).a;b.it's.`id`.."
+				run(tt, path, shell.argv, shell.target, src, s, want)
+			}
+		}
+	}
+}
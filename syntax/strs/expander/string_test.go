@@ -1,12 +1,24 @@
 package expander_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/siadat/well/syntax/strs/expander"
+	"github.com/siadat/well/syntax/strs/parser"
 )
 
+// errorMsg returns the message of err, without the marked source of syntax
+// errors.
+func errorMsg(err error) string {
+	var syntaxErr *parser.Error
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Msg
+	}
+	return err.Error()
+}
+
 func TestEncodeToString(tt *testing.T) {
 	var testCases = []struct {
 		src    string
@@ -24,15 +36,19 @@ func TestEncodeToString(tt *testing.T) {
 		},
 		{
 			src: `unclosed open «guillemet`,
-			err: `unclosed container`,
+			err: `unclosed «`,
 		},
 		{
 			src: `double guillemet ‹closed››`,
-			err: `unexpected token RSINGLE_GUILLEMET("›")`,
+			err: `unexpected ›, it is not opened, use \› for a literal ›`,
 		},
 		{
 			src: `double quote "closed""`,
-			err: `unclosed container`,
+			err: `unclosed "`,
+		},
+		{
+			src: `mismatched «guillemets›`,
+			err: `unexpected ›, expected » to close «`,
 		},
 		{
 			src:    `echo "Hello ${name}!"`,
@@ -49,6 +65,63 @@ func TestEncodeToString(tt *testing.T) {
 			err:    `variable key is <nil>`,
 			values: map[string]interface{}{},
 		},
+		{
+			src:    `echo ${n + 1}`,
+			err:    `cannot evaluate ${n + 1}, expressions are only supported in Well programs`,
+			values: map[string]interface{}{"n": "1"},
+		},
+		{
+			src:    `echo ${f()}`,
+			err:    `cannot evaluate ${f()}: it has no value`,
+			values: map[string]interface{}{"f()": errors.New("it has no value")},
+		},
+		{
+			src:    `hello ${key|"world"} ${key:%q|"a \"b\""} ${set|"unused"}`,
+			want:   `hello world "a \"b\"" value`,
+			values: map[string]interface{}{"set": "value"},
+		},
+		{
+			src:    `hello ${key?"pass --key"}`,
+			err:    `variable key is not set: pass --key`,
+			values: map[string]interface{}{},
+		},
+		{
+			src:    `hello ${key?""}`,
+			err:    `variable key is not set`,
+			values: map[string]interface{}{},
+		},
+		{
+			src:    `ls ${set+"-l"}${key+"-a"} ${set:%q?"unused"}`,
+			want:   `ls -l "value"`,
+			values: map[string]interface{}{"set": "value"},
+		},
+		{
+			src:    `psql -h ${db.host:%q}`,
+			want:   `psql -h "localhost"`,
+			values: map[string]interface{}{"db.host": "localhost"},
+		},
+		{
+			src: `hello ${db.}`,
+			err: `expected identifier after ., got }`,
+		},
+		{
+			src:    `rm ${files} «${files}» «${files:%q"; "}» ${files:%Q}`,
+			want:   `rm "my file" "" b "my file  b" "\"my file\"; \"\"; \"b\"" 'my file' '' 'b'`,
+			values: map[string]interface{}{"files": []string{"my file", "", "b"}},
+		},
+		{
+			src:    `rm ${files}`,
+			want:   `rm `,
+			values: map[string]interface{}{"files": []string{}},
+		},
+		{
+			src: `hello ${key|world}`,
+			err: `expected " got w`,
+		},
+		{
+			src: `hello ${key|"world}`,
+			err: `unclosed variable value`,
+		},
 		{
 			src:  `hello {key}`,
 			want: `hello {key}`, // allow raw { and }
@@ -80,13 +153,13 @@ func TestEncodeToString(tt *testing.T) {
 
 	for _, tc := range testCases {
 		var src = tc.src
-		var got, err = expander.ParseAndEncodeToString(src, expander.MappingFuncFromMap(tc.values), true)
+		var got, err = expander.ParseAndEncodeToString(src, expander.MappingFuncFromMap(tc.values), expander.Basic, true)
 		if tc.err == "" {
 			if err != nil {
 				tt.Fatalf("expected no error, got: %v", err)
 			}
 		} else {
-			if err == nil || err.Error() != tc.err {
+			if err == nil || errorMsg(err) != tc.err {
 				tt.Fatalf("expected error %q, got: %v", tc.err, err)
 			}
 		}
@@ -2,7 +2,6 @@ package parser
 
 import (
 	"bytes"
-	"fmt"
 
 	"github.com/siadat/well/syntax/strs/scanner"
 )
@@ -19,10 +18,31 @@ type Whs struct {
 
 // Var is a var node
 type Var struct {
-	Name string
-	Opts string
+	Name     string
+	Opts     string
+	Modifier Modifier
+	Value    string  // the unquoted value of the modifier
+	Sep      *string // the separator of the elements of a list, a space if nil
 }
 
+// Expr is a Well expression, e.g. ${count + 1}. It is evaluated by the
+// program that expands the template, which maps its source to its value.
+type Expr struct {
+	Src  string  // the source of the expression, e.g. count + 1
+	Opts string  // the flags, e.g. %q
+	Sep  *string // the separator of the elements of a list, a space if nil
+}
+
+// Modifier changes the value of a variable depending on whether it is set.
+type Modifier rune
+
+const (
+	NoModifier Modifier = 0
+	Default    Modifier = '|' // ${name|"value"} is value if name is not set
+	Required   Modifier = '?' // ${name?"message"} fails with message if name is not set
+	Alternate  Modifier = '+' // ${name+"value"} is value if name is set, and empty otherwise
+)
+
 type ContainerNode struct {
 	Type  scanner.CmdTokenType
 	Items []CmdNode
@@ -41,52 +61,97 @@ func (Wrd) node()           {}
 func (ContainerNode) node() {}
 func (Root) node()          {}
 func (Var) node()           {}
+func (Expr) node()          {}
 func (Whs) node()           {}
 
+// The String methods return the source of the nodes, see Print. Nodes that
+// cannot be printed are written as is.
+
 func (w Wrd) String() string {
-	switch w.Lit {
-	case "«", "»", "‹", "›", "$":
-		return `\` + w.Lit
-	default:
-		return w.Lit
+	if s, err := Print(w); err == nil {
+		return s
 	}
+	return w.Lit
 }
 
 func (c ContainerNode) String() string {
+	if s, err := Print(c); err == nil {
+		return s
+	}
 	var buf bytes.Buffer
-
+	buf.WriteRune(openers[c.Type])
 	for _, item := range c.Items {
-		fmt.Fprintf(&buf, item.String())
-	}
-
-	switch c.Type {
-	case scanner.DOUBLE_QUOTE: // "
-		return `"` + buf.String() + `"`
-	case scanner.SINGLE_QUOTE: // "
-		return `'` + buf.String() + `'`
-	case scanner.LDOUBLE_GUILLEMET: // «
-		return `«` + buf.String() + `»`
-	case scanner.LSINGLE_GUILLEMET: // ‹
-		return `‹` + buf.String() + `›`
-	default:
-		panic(fmt.Sprintf("unsupported container type %s", c.Type))
+		buf.WriteString(item.String())
 	}
+	buf.WriteRune(closers[c.Type])
+	return buf.String()
 }
 
 func (r Root) String() string {
+	if s, err := Print(r); err == nil {
+		return s
+	}
 	var buf bytes.Buffer
-
 	for _, item := range r.Items {
-		fmt.Fprintf(&buf, item.String())
+		buf.WriteString(item.String())
 	}
-	return `"` + buf.String() + `"`
+	return buf.String()
 }
 
 func (v Var) String() string {
-	if v.Opts == "" {
-		return fmt.Sprintf("${%s}", v.Name)
+	return "$" + v.source()
+}
+
+func (e Expr) String() string {
+	return "$" + e.source()
+}
+
+// source returns e without its $.
+func (e Expr) source() string {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	buf.WriteString(e.Src)
+	if e.Opts != "" || e.Sep != nil {
+		buf.WriteString(":")
+		buf.WriteString(e.Opts)
+	}
+	if e.Sep != nil {
+		writeQuoted(&buf, *e.Sep)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// source returns v without its $.
+func (v Var) source() string {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	buf.WriteString(v.Name)
+	if v.Opts != "" || v.Sep != nil {
+		buf.WriteString(":")
+		buf.WriteString(v.Opts)
+	}
+	if v.Sep != nil {
+		writeQuoted(&buf, *v.Sep)
+	}
+	if v.Modifier != NoModifier {
+		buf.WriteRune(rune(v.Modifier))
+		writeQuoted(&buf, v.Value)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// writeQuoted writes the double quoted value of a modifier or a separator.
+func writeQuoted(buf *bytes.Buffer, s string) {
+	buf.WriteString(`"`)
+	for _, ch := range s {
+		if ch == '"' || ch == '\\' {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(ch)
 	}
-	return fmt.Sprintf("${%s:%%%s}", v.Name, v.Opts)
+	buf.WriteString(`"`)
 }
 
 func (w Whs) String() string {
@@ -19,6 +19,8 @@ ${abc:%q}
     \$ literal dollar
 	\› literal guillemet
 	‹hello «1» ›
+	${a|"\"x\" \\"} ${b:%q?"message"} ${c+"-v"}
+	${list:%Q"\" "} ${list:""|"a"}
 
 
 multiple newlines`,
@@ -32,7 +34,7 @@ multiple newlines`,
 		if err != nil {
 			tt.Fatalf("test case failed src=%q: %v", src, err)
 		}
-		if diff := cmp.Diff(`"`+src+`"`, got.String()); diff != "" {
+		if diff := cmp.Diff(src, got.String()); diff != "" {
 			pretty.Println("got:", got)
 			tt.Fatalf("case failed src=%q (-want +got):\n%s", src, diff)
 		}
@@ -8,8 +8,6 @@ import (
 	"github.com/siadat/well/syntax/strs/scanner"
 )
 
-// TODO: implement a pretty printer
-
 type CmdParser struct {
 	src     io.Reader
 	root    *Root
@@ -25,7 +23,7 @@ func NewParser() *CmdParser {
 func (p *CmdParser) Parse(src io.Reader) (*Root, error) {
 	p.scanner = scanner.NewScanner(src)
 	p.scanner.SetDebug(p.debug)
-	var nodes, err = p.parseContainerNodes(0, scanner.EOF)
+	var nodes, err = p.parseContainerNodes(0, nil)
 	p.root = &Root{
 		Items: nodes,
 	}
@@ -37,7 +35,74 @@ func (p *CmdParser) SetDebug(v bool) {
 	p.debug = v
 }
 
-func (p *CmdParser) parseContainerNodes(indent int, until scanner.CmdTokenType) ([]CmdNode, error) {
+// Error is a syntax error in a template. Its message marks the offending
+// rune, and the opening quote that is not closed, if any.
+type Error struct {
+	Msg    string
+	Pos    int // the offset in runes of the offending rune
+	Opener int // the offset in runes of the unclosed «, ‹, " or ', or -1
+
+	src []rune
+}
+
+func (e *Error) Error() string {
+	var lines = mark(e.src, e.Pos, e.Msg)
+	if e.Opener >= 0 {
+		lines = append(lines, mark(e.src, e.Opener, fmt.Sprintf("%c is opened here", e.src[e.Opener]))...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *CmdParser) newError(pos int, opener *scanner.CmdToken, format string, args ...interface{}) *Error {
+	var e = &Error{
+		Msg:    fmt.Sprintf(format, args...),
+		Pos:    pos,
+		Opener: -1,
+		src:    p.scanner.Source(),
+	}
+	if opener != nil {
+		e.Opener = opener.Pos
+	}
+	return e
+}
+
+// mark returns the line of src at pos, marked like syntax/scanner.MarkAt.
+func mark(src []rune, pos int, msg string) []string {
+	var lineStart, line = 0, 0
+	for i := 0; i < pos && i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStart = i + 1
+			line += 1
+		}
+	}
+	var lineEnd = lineStart
+	for lineEnd < len(src) && src[lineEnd] != '\n' {
+		lineEnd += 1
+	}
+
+	var indent strings.Builder
+	for _, ch := range src[lineStart:pos] {
+		if ch == '\t' {
+			indent.WriteRune(ch)
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	return []string{
+		string(src[lineStart:lineEnd]),
+		fmt.Sprintf("%s⌃", indent.String()),
+		fmt.Sprintf("%s│", indent.String()),
+		fmt.Sprintf("%s╰─── at line %d column %d: %s", indent.String(), line+1, pos-lineStart+1, msg),
+	}
+}
+
+// parseContainerNodes parses the items of the container opened by opener,
+// up to its closing token. The root has no opener, its items end at EOF.
+func (p *CmdParser) parseContainerNodes(indent int, opener *scanner.CmdToken) ([]CmdNode, error) {
+	var until = scanner.EOF
+	if opener != nil {
+		until = scanner.GetRight(opener.Typ)
+	}
 	var nodes []CmdNode
 	for {
 		var t, err = p.scanner.NextToken()
@@ -47,51 +112,129 @@ func (p *CmdParser) parseContainerNodes(indent int, until scanner.CmdTokenType)
 		if t.Typ == until {
 			return nodes, nil
 		}
-		var n, err2 = p.tokenToNode(indent, until, t)
-		if err2 != nil {
-			return nil, err2
-		}
-		if n != nil {
-			nodes = append(nodes, n)
-		}
-		if p.scanner.Eof() {
+		if t.Typ == scanner.EOF {
 			// we should never see EOF before seeing `until'
-			return nodes, fmt.Errorf("unclosed container")
+			return nodes, p.newError(t.Pos, opener, "unclosed %s", opener.Lit)
 		}
+		var n, err2 = p.tokenToNode(indent, opener, t)
+		if err2 != nil {
+			return nodes, err2
+		}
+		nodes = append(nodes, n)
 	}
 }
 
-func (p *CmdParser) tokenToNode(indent int, until scanner.CmdTokenType, t scanner.CmdToken) (CmdNode, error) {
+func (p *CmdParser) tokenToNode(indent int, opener *scanner.CmdToken, t scanner.CmdToken) (CmdNode, error) {
 	switch t.Typ {
-	case scanner.EOF:
-		return nil, nil
 	case scanner.WORD:
 		return Wrd{Lit: t.Lit}, nil
 	case scanner.SPACE:
 		return Whs{Lit: t.Lit}, nil
 	case scanner.ARG:
-		var segments = strings.SplitN(t.Lit, ":", 2)
-		var name, flags string
-		if len(segments) == 2 {
-			name, flags = segments[0], segments[1]
-		} else {
-			name = t.Lit
-		}
-		return Var{Name: name, Opts: flags}, nil
+		return parseVar(t.Lit), nil
+	case scanner.EXPR:
+		return parseExpr(t.Lit), nil
 	case scanner.SINGLE_QUOTE, scanner.DOUBLE_QUOTE,
 		scanner.LDOUBLE_GUILLEMET, scanner.LSINGLE_GUILLEMET:
 
 		var container = ContainerNode{
 			Type: t.Typ,
 		}
-		var right = scanner.GetRight(t.Typ)
-		var nodes, err = p.parseContainerNodes(indent+1, right)
+		var nodes, err = p.parseContainerNodes(indent+1, &t)
 		container.Items = nodes
 		if err != nil {
 			return nil, err // TODO: return nil?
 		}
 		return container, nil
+	case scanner.ILLEGAL_TOKEN:
+		return nil, p.newError(t.Pos, nil, "%s", t.Lit)
+	case scanner.RDOUBLE_GUILLEMET, scanner.RSINGLE_GUILLEMET:
+		if opener != nil {
+			return nil, p.newError(t.Pos, opener, "unexpected %s, expected %s to close %s", t.Lit, closer(opener.Typ), opener.Lit)
+		}
+		return nil, p.newError(t.Pos, nil, "unexpected %s, it is not opened, use \\%s for a literal %s", t.Lit, t.Lit, t.Lit)
 	default:
-		return nil, fmt.Errorf("unexpected token %s", t)
+		return nil, p.newError(t.Pos, opener, "unexpected token %s", t)
+	}
+}
+
+// closer returns the literal that closes a container.
+func closer(typ scanner.CmdTokenType) string {
+	switch typ {
+	case scanner.LDOUBLE_GUILLEMET:
+		return "»"
+	case scanner.LSINGLE_GUILLEMET:
+		return "›"
+	case scanner.DOUBLE_QUOTE:
+		return `"`
+	case scanner.SINGLE_QUOTE:
+		return "'"
+	default:
+		panic(fmt.Sprintf("unsupported container type %s", typ))
+	}
+}
+
+// parseVar parses the literal of an ARG token, e.g. name:%q", "|"value".
+// The scanner has already checked its syntax.
+func parseVar(lit string) Var {
+	var v Var
+	var end = strings.IndexAny(lit, ":|?+")
+	if end == -1 {
+		v.Name = lit
+		return v
+	}
+	v.Name, lit = lit[:end], lit[end:]
+
+	if strings.HasPrefix(lit, ":") {
+		end = strings.IndexAny(lit, `"|?+`)
+		if end == -1 {
+			end = len(lit)
+		}
+		v.Opts, lit = lit[1:end], lit[end:]
+		if strings.HasPrefix(lit, `"`) {
+			var sep string
+			sep, lit = unquoteValue(lit)
+			v.Sep = &sep
+		}
+	}
+
+	if lit != "" {
+		v.Modifier = Modifier(lit[0])
+		v.Value, _ = unquoteValue(lit[1:])
+	}
+	return v
+}
+
+// parseExpr parses the literal of an EXPR token, e.g. count + 1:%q.
+func parseExpr(lit string) Expr {
+	var e Expr
+	var rest string
+	e.Src, rest = scanner.SplitExpr(lit)
+	var end = strings.IndexByte(rest, '"')
+	if end == -1 {
+		e.Opts = rest
+		return e
+	}
+	e.Opts = rest[:end]
+	var sep, _ = unquoteValue(rest[end:])
+	e.Sep = &sep
+	return e
+}
+
+// unquoteValue returns the value of the double quoted string at the start of
+// s, and the rest of s.
+func unquoteValue(s string) (string, string) {
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return value.String(), s[i+1:]
+		}
+		if i < len(s) {
+			value.WriteByte(s[i])
+		}
 	}
+	return value.String(), ""
 }
@@ -36,9 +36,9 @@ func TestParser(tt *testing.T) {
 				[]parser.CmdNode{
 					parser.Wrd{`echo`},
 					parser.Whs{` `},
-					parser.Var{`nameA`, ``},
+					parser.Var{Name: `nameA`},
 					parser.Whs{` `},
-					parser.Var{`nameB`, ``},
+					parser.Var{Name: `nameB`},
 				},
 			},
 		},
@@ -53,7 +53,7 @@ func TestParser(tt *testing.T) {
 						Items: []parser.CmdNode{
 							parser.Wrd{`Hello`},
 							parser.Whs{` `},
-							parser.Var{`name`, ``},
+							parser.Var{Name: `name`},
 							parser.Wrd{`!`},
 						},
 					},
@@ -70,7 +70,7 @@ func TestParser(tt *testing.T) {
 						Type: scanner.LDOUBLE_GUILLEMET,
 						Items: []parser.CmdNode{
 							parser.Wrd{`.`},
-							parser.Var{`key`, `%q`},
+							parser.Var{Name: `key`, Opts: `%q`},
 							parser.Whs{` `},
 							parser.Wrd{`|`},
 							parser.Whs{` `},
@@ -86,7 +86,7 @@ func TestParser(tt *testing.T) {
 				[]parser.CmdNode{
 					parser.Wrd{`one`},
 					parser.Whs{` `},
-					parser.Var{`var`, ``},
+					parser.Var{Name: `var`},
 					parser.Whs{` `},
 					parser.Wrd{`three`},
 				},
@@ -98,7 +98,7 @@ func TestParser(tt *testing.T) {
 				[]parser.CmdNode{
 					parser.Wrd{`one`},
 					parser.Whs{` `},
-					parser.Var{`var`, `%q`},
+					parser.Var{Name: `var`, Opts: `%q`},
 					parser.Whs{` `},
 					parser.Wrd{`three`},
 				},
@@ -113,7 +113,7 @@ func TestParser(tt *testing.T) {
 					parser.ContainerNode{
 						Type: scanner.LDOUBLE_GUILLEMET,
 						Items: []parser.CmdNode{
-							parser.Var{`var`, `%q`},
+							parser.Var{Name: `var`, Opts: `%q`},
 							parser.Whs{` `},
 							parser.ContainerNode{
 								Type: scanner.LDOUBLE_GUILLEMET,
@@ -139,6 +139,48 @@ func TestParser(tt *testing.T) {
 				},
 			},
 		},
+		{
+			src: `cp ${src|"a \"b\" \\ c"} ${dst:%q?"where: to?"}${flag+""}`,
+			want: &parser.Root{
+				[]parser.CmdNode{
+					parser.Wrd{`cp`},
+					parser.Whs{` `},
+					parser.Var{Name: `src`, Modifier: parser.Default, Value: `a "b" \ c`},
+					parser.Whs{` `},
+					parser.Var{Name: `dst`, Opts: `%q`, Modifier: parser.Required, Value: `where: to?`},
+					parser.Var{Name: `flag`, Modifier: parser.Alternate},
+				},
+			},
+		},
+		{
+			src: `rm «${files:%q"|\""|""}» ${dirs:", "}`,
+			want: &parser.Root{
+				[]parser.CmdNode{
+					parser.Wrd{`rm`},
+					parser.Whs{` `},
+					parser.ContainerNode{
+						Type: scanner.LDOUBLE_GUILLEMET,
+						Items: []parser.CmdNode{
+							parser.Var{Name: `files`, Opts: `%q`, Sep: sep(`|"`), Modifier: parser.Default},
+						},
+					},
+					parser.Whs{` `},
+					parser.Var{Name: `dirs`, Sep: sep(`, `)},
+				},
+			},
+		},
+		{
+			src: `echo ${count + 1} ${join(names, ","):%q", "}`,
+			want: &parser.Root{
+				[]parser.CmdNode{
+					parser.Wrd{`echo`},
+					parser.Whs{` `},
+					parser.Expr{Src: `count + 1`},
+					parser.Whs{` `},
+					parser.Expr{Src: `join(names, ",")`, Opts: `%q`, Sep: sep(`, `)},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -153,3 +195,47 @@ func TestParser(tt *testing.T) {
 		}
 	}
 }
+
+func sep(s string) *string {
+	return &s
+}
+
+func TestParseErrors(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want string
+	}{
+		{
+			src: "sh -c «echo\n\t‹a» b",
+			want: strings.Join([]string{
+				"\t‹a» b",
+				"\t  ⌃",
+				"\t  │",
+				"\t  ╰─── at line 2 column 4: unexpected », expected › to close ‹",
+				"\t‹a» b",
+				"\t⌃",
+				"\t│",
+				"\t╰─── at line 2 column 2: ‹ is opened here",
+			}, "\n"),
+		},
+		{
+			src: `echo ${}`,
+			want: strings.Join([]string{
+				"echo ${}",
+				"       ⌃",
+				"       │",
+				"       ╰─── at line 1 column 8: expected identifier or expression, got }",
+			}, "\n"),
+		},
+	}
+
+	for ti, tc := range testCases {
+		var _, err = parser.NewParser().Parse(strings.NewReader(tc.src))
+		if err == nil {
+			tt.Fatalf("expected an error (test case %d)", ti)
+		}
+		if diff := cmp.Diff(tc.want, err.Error()); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siadat/well/syntax/strs/scanner"
+)
+
+// Print returns the source of n. The source of a node returned by Parse
+// parses back to the same node. Other nodes parse back to nodes that expand
+// the same way, e.g. a word with a « is split in three words.
+//
+// A backslash is only an escape character before «, », ‹, ›, $, ' and ", so
+// there is no way to write a backslash that is followed by a variable, a
+// quoted string, or the end of the quoted string it is in. Print returns an
+// error for them, and for other nodes that cannot be written, e.g. a word
+// with a whitespace.
+func Print(n CmdNode) (string, error) {
+	var p printer
+	if err := p.print(n); err != nil {
+		return "", err
+	}
+	return p.buf.String(), nil
+}
+
+type printer struct {
+	buf strings.Builder
+
+	// backslash is true if the last rune is a backslash that is not an escape
+	// character, and so it cannot be followed by a special rune.
+	backslash bool
+}
+
+// isSpecial reports whether ch is escaped with a backslash in words.
+func isSpecial(ch rune) bool {
+	switch ch {
+	case '«', '»', '‹', '›', '$', '\'', '"':
+		return true
+	}
+	return false
+}
+
+func isWhitespace(ch rune) bool {
+	switch ch {
+	case ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+func (p *printer) print(n CmdNode) error {
+	switch n := n.(type) {
+	case *Root:
+		return p.printItems(n.Items)
+	case Root:
+		return p.printItems(n.Items)
+	case ContainerNode:
+		var closer, ok = closers[n.Type]
+		if !ok {
+			return fmt.Errorf("unsupported container type %s", n.Type)
+		}
+		if err := p.writeSpecial(openers[n.Type], "a backslash before a variable or a quoted string is not supported"); err != nil {
+			return err
+		}
+		if err := p.printItems(n.Items); err != nil {
+			return err
+		}
+		return p.writeSpecial(closer, "a backslash at the end of a quoted string is not supported")
+	case Wrd:
+		for _, ch := range n.Lit {
+			switch {
+			case ch == 0:
+				return fmt.Errorf("unsupported NUL in word %q", n.Lit)
+			case isWhitespace(ch):
+				return fmt.Errorf("unsupported whitespace in word %q", n.Lit)
+			case isSpecial(ch):
+				p.buf.WriteRune('\\')
+				p.buf.WriteRune(ch)
+				p.backslash = false
+			default:
+				p.buf.WriteRune(ch)
+				p.backslash = ch == '\\'
+			}
+		}
+		return nil
+	case Whs:
+		for _, ch := range n.Lit {
+			if !isWhitespace(ch) {
+				return fmt.Errorf("unsupported %q in whitespace %q", ch, n.Lit)
+			}
+		}
+		p.buf.WriteString(n.Lit)
+		if n.Lit != "" {
+			p.backslash = false
+		}
+		return nil
+	case Var:
+		if err := checkVar(n); err != nil {
+			return err
+		}
+		if err := p.writeSpecial('$', "a backslash before a variable or a quoted string is not supported"); err != nil {
+			return err
+		}
+		p.buf.WriteString(n.source())
+		return nil
+	case Expr:
+		if err := checkExpr(n); err != nil {
+			return err
+		}
+		if err := p.writeSpecial('$', "a backslash before a variable or a quoted string is not supported"); err != nil {
+			return err
+		}
+		p.buf.WriteString(n.source())
+		return nil
+	default:
+		return fmt.Errorf("unsupported node %T", n)
+	}
+}
+
+func (p *printer) printItems(items []CmdNode) error {
+	for _, item := range items {
+		if err := p.print(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSpecial writes ch, which is not escaped, or fails with msg if it
+// would be escaped by the backslash before it.
+func (p *printer) writeSpecial(ch rune, msg string) error {
+	if p.backslash {
+		return fmt.Errorf("%s", msg)
+	}
+	p.buf.WriteRune(ch)
+	return nil
+}
+
+var openers = map[scanner.CmdTokenType]rune{
+	scanner.DOUBLE_QUOTE:      '"',
+	scanner.SINGLE_QUOTE:      '\'',
+	scanner.LDOUBLE_GUILLEMET: '«',
+	scanner.LSINGLE_GUILLEMET: '‹',
+}
+
+var closers = map[scanner.CmdTokenType]rune{
+	scanner.DOUBLE_QUOTE:      '"',
+	scanner.SINGLE_QUOTE:      '\'',
+	scanner.LDOUBLE_GUILLEMET: '»',
+	scanner.LSINGLE_GUILLEMET: '›',
+}
+
+// checkVar returns an error if v cannot be written as ${...}.
+func checkVar(v Var) error {
+	for _, part := range strings.Split(v.Name, ".") {
+		if !isIdentifier(part) {
+			return fmt.Errorf("invalid variable name %q", v.Name)
+		}
+	}
+	if !validOpts(v.Opts) {
+		return fmt.Errorf("invalid format %q of variable %s", v.Opts, v.Name)
+	}
+	switch v.Modifier {
+	case NoModifier, Default, Required, Alternate:
+	default:
+		return fmt.Errorf("invalid modifier %q of variable %s", rune(v.Modifier), v.Name)
+	}
+	if strings.ContainsRune(v.Value, 0) || v.Sep != nil && strings.ContainsRune(*v.Sep, 0) {
+		return fmt.Errorf("unsupported NUL in variable %s", v.Name)
+	}
+	return nil
+}
+
+func isIdentifier(s string) bool {
+	for i, ch := range s {
+		switch {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', ch == '_':
+		case '0' <= ch && ch <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// checkExpr returns an error if e cannot be written as ${...}, e.g. if its
+// source has an unclosed parenthesis, or if it is a variable name.
+func checkExpr(e Expr) error {
+	var s = scanner.NewScanner(strings.NewReader("$" + e.source()))
+	var t, _ = s.NextToken()
+	if t.Typ != scanner.EXPR {
+		return fmt.Errorf("invalid expression %q", e.Src)
+	}
+	if src, _ := scanner.SplitExpr(t.Lit); src != e.Src {
+		return fmt.Errorf("invalid expression %q", e.Src)
+	}
+	if !validOpts(e.Opts) {
+		return fmt.Errorf("invalid format %q of expression %s", e.Opts, e.Src)
+	}
+	if e.Sep != nil && strings.ContainsRune(*e.Sep, 0) {
+		return fmt.Errorf("unsupported NUL in expression %s", e.Src)
+	}
+	return nil
+}
+
+// validOpts reports whether opts can be written as the flags of a variable.
+func validOpts(opts string) bool {
+	if strings.ContainsAny(opts, "}\"|?+\x00") {
+		return false
+	}
+	return strings.HasPrefix(opts, "%") || len([]rune(opts)) <= 1
+}
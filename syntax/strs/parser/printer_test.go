@@ -0,0 +1,133 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/syntax/strs/parser"
+	"github.com/siadat/well/syntax/strs/scanner"
+)
+
+func TestPrint(tt *testing.T) {
+	var sep = func(s string) *string { return &s }
+	var testCases = []struct {
+		node parser.CmdNode
+		want string
+		err  string
+	}{
+		{
+			node: &parser.Root{Items: []parser.CmdNode{
+				parser.Wrd{Lit: "echo"},
+				parser.Whs{Lit: " "},
+				parser.ContainerNode{Type: scanner.LDOUBLE_GUILLEMET, Items: []parser.CmdNode{
+					parser.Wrd{Lit: "a«b»$c"},
+					parser.Whs{Lit: " "},
+					parser.Var{Name: "name", Opts: "%q"},
+				}},
+			}},
+			want: `echo «a\«b\»\$c ${name:%q}»`,
+		},
+		{
+			node: parser.Var{Name: "db.host", Opts: "%%d", Sep: sep(`", "`), Modifier: parser.Default, Value: `\`},
+			want: `${db.host:%%d"\", \""|"\\"}`,
+		},
+		{
+			// a backslash before a rune that is not special is literal
+			node: &parser.Root{Items: []parser.CmdNode{
+				parser.Wrd{Lit: `a\b\`},
+				parser.Whs{Lit: " "},
+				parser.Wrd{Lit: `\`},
+			}},
+			want: `a\b\ \`,
+		},
+		{
+			node: &parser.Root{Items: []parser.CmdNode{
+				parser.ContainerNode{Type: scanner.LSINGLE_GUILLEMET, Items: []parser.CmdNode{
+					parser.Wrd{Lit: `a\`},
+				}},
+			}},
+			err: "a backslash at the end of a quoted string is not supported",
+		},
+		{
+			node: &parser.Root{Items: []parser.CmdNode{
+				parser.Wrd{Lit: `a\`},
+				parser.Var{Name: "x"},
+			}},
+			err: "a backslash before a variable or a quoted string is not supported",
+		},
+		{
+			node: parser.Wrd{Lit: "a b"},
+			err:  `unsupported whitespace in word "a b"`,
+		},
+		{
+			node: parser.Var{Name: "1x"},
+			err:  `invalid variable name "1x"`,
+		},
+		{
+			node: parser.Var{Name: "x", Opts: "q}"},
+			err:  `invalid format "q}" of variable x`,
+		},
+		{
+			node: parser.Expr{Src: `f(x, "}")`, Opts: "%q", Sep: sep(" ")},
+			want: `${f(x, "}"):%q" "}`,
+		},
+		{
+			node: parser.Expr{Src: `f(x`},
+			err:  `invalid expression "f(x"`,
+		},
+		{
+			node: parser.Expr{Src: `x`},
+			err:  `invalid expression "x"`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		var got, err = parser.Print(tc.node)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("print failed (test case %d): %v", ti, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func FuzzPrint(f *testing.F) {
+	for _, src := range []string{
+		`ls -lash "./some dir"`,
+		`sh -c «echo ‹${name:%q}› \«x\» 'it\'s'»`,
+		`a\b\ \$ ${x|"\"d\""} ${y:%Q", "?"msg"} ${z.w:%d+"-v"}`,
+		"multiple\n\tlines\r\n",
+		`${x:}}${y:q}«»`,
+		`${count + 1} ${f(x, "}"):%q", "} ${(a)}`,
+	} {
+		f.Add(src)
+	}
+	f.Fuzz(func(tt *testing.T, src string) {
+		var root, err = parser.NewParser().Parse(strings.NewReader(src))
+		if err != nil {
+			return
+		}
+		printed, err := parser.Print(root)
+		if err != nil {
+			tt.Fatalf("print failed src=%q: %v", src, err)
+		}
+		got, err := parser.NewParser().Parse(strings.NewReader(printed))
+		if err != nil {
+			tt.Fatalf("parsing the printed source failed src=%q printed=%q: %v", src, printed, err)
+		}
+		if diff := cmp.Diff(root, got); diff != "" {
+			tt.Fatalf("mismatching results src=%q printed=%q\ndiff guide:\n  - want\n  + got\ndiff:\n%s", src, printed, diff)
+		}
+		if again, _ := parser.Print(got); again != printed {
+			tt.Fatalf("printing is not canonical src=%q: %q then %q", src, printed, again)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sequence is a list of pipelines separated by operators, e.g.
+//
+//	make && ls bin | wc -l || echo failed ; date
+//
+// Like in a shell, && runs the next pipeline if the previous one succeeded,
+// || runs it if the previous one failed, and ; runs it in any case.
+type Sequence struct {
+	Pipelines []Pipeline
+	Ops       []string // the operator before each pipeline but the first
+}
+
+// Pipeline is a list of commands separated by |. The stdout of each command
+// is the stdin of the next one.
+type Pipeline struct {
+	Commands []*Root
+}
+
+// operators are longest first, so that || is not read as two |.
+var operators = []string{"&&", "||", "|", ";"}
+
+// SplitOperators splits root at the |, &&, || and ; operators in the words
+// at its top level. Operators in containers and in the values of variables
+// are not split, e.g. «a | b» is one argument. A template without commands,
+// e.g. one with only whitespaces, has no pipelines. A ; at the end is
+// allowed, like in a shell.
+func SplitOperators(root *Root) (Sequence, error) {
+	var cmds = []*Root{{}}
+	var ops []string
+	for _, item := range root.Items {
+		var wrd, ok = item.(Wrd)
+		if !ok {
+			cmds[len(cmds)-1].Items = append(cmds[len(cmds)-1].Items, item)
+			continue
+		}
+		var lit = wrd.Lit
+		for lit != "" {
+			var i, op = indexOperator(lit)
+			if i == -1 {
+				i = len(lit)
+			}
+			if i > 0 {
+				cmds[len(cmds)-1].Items = append(cmds[len(cmds)-1].Items, Wrd{Lit: lit[:i]})
+			}
+			if op == "" {
+				break
+			}
+			ops = append(ops, op)
+			cmds = append(cmds, &Root{})
+			lit = lit[i+len(op):]
+		}
+	}
+
+	if len(ops) > 0 && ops[len(ops)-1] == ";" && isEmpty(cmds[len(cmds)-1]) {
+		ops = ops[:len(ops)-1]
+		cmds = cmds[:len(cmds)-1]
+	}
+	if len(ops) == 0 && isEmpty(cmds[0]) {
+		return Sequence{}, nil
+	}
+	for i, cmd := range cmds {
+		if !isEmpty(cmd) {
+			continue
+		}
+		if i == 0 {
+			return Sequence{}, fmt.Errorf("expected a command before %s", ops[0])
+		}
+		return Sequence{}, fmt.Errorf("expected a command after %s", ops[i-1])
+	}
+
+	var seq Sequence
+	var pipeline = Pipeline{Commands: []*Root{cmds[0]}}
+	for i, op := range ops {
+		if op == "|" {
+			pipeline.Commands = append(pipeline.Commands, cmds[i+1])
+			continue
+		}
+		seq.Pipelines = append(seq.Pipelines, pipeline)
+		seq.Ops = append(seq.Ops, op)
+		pipeline = Pipeline{Commands: []*Root{cmds[i+1]}}
+	}
+	seq.Pipelines = append(seq.Pipelines, pipeline)
+	return seq, nil
+}
+
+// indexOperator returns the index of the first operator in s and the
+// operator, or -1 and "".
+func indexOperator(s string) (int, string) {
+	for i := range s {
+		for _, op := range operators {
+			if strings.HasPrefix(s[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+// isEmpty reports whether root has no items other than whitespaces.
+func isEmpty(root *Root) bool {
+	for _, item := range root.Items {
+		if _, ok := item.(Whs); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/syntax/strs/parser"
+)
+
+func TestSplitOperators(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want [][]string // the commands of each pipeline
+		ops  []string
+		err  string
+	}{
+		{
+			src:  `echo «a | b»`,
+			want: [][]string{{`echo «a | b»`}},
+		},
+		{
+			src:  `make && ls bin|wc -l || echo ${msg:%q} ; date;`,
+			want: [][]string{{`make `}, {` ls bin`, `wc -l `}, {` echo ${msg:%q} `}, {` date`}},
+			ops:  []string{"&&", "||", ";"},
+		},
+		{
+			src:  `curl "a|b" ‹x && y› a&b`,
+			want: [][]string{{`curl "a|b" ‹x && y› a&b`}},
+		},
+		{
+			src:  "  \n",
+			want: nil,
+		},
+		{
+			src: `| wc -l`,
+			err: "expected a command before |",
+		},
+		{
+			src: `ls &&`,
+			err: "expected a command after &&",
+		},
+		{
+			src: `ls | ; date`,
+			err: "expected a command after |",
+		},
+	}
+
+	for ti, tc := range testCases {
+		var root, err = parser.NewParser().Parse(strings.NewReader(tc.src))
+		if err != nil {
+			tt.Fatalf("parsing failed (test case %d): %v", ti, err)
+		}
+		seq, err := parser.SplitOperators(root)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				tt.Fatalf("expected error %q (test case %d), got: %v", tc.err, ti, err)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Fatalf("split failed (test case %d): %v", ti, err)
+		}
+
+		var got [][]string
+		for _, pipeline := range seq.Pipelines {
+			var cmds []string
+			for _, cmd := range pipeline.Commands {
+				cmds = append(cmds, cmd.String())
+			}
+			got = append(got, cmds)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching pipelines (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+		if diff := cmp.Diff(tc.ops, seq.Ops); diff != "" {
+			tt.Fatalf("mismatching operators (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
@@ -25,6 +25,7 @@ type CmdScanner struct {
 type CmdToken struct {
 	Typ CmdTokenType
 	Lit string
+	Pos int // the offset in runes of the token, or of the offending rune of an ILLEGAL_TOKEN
 }
 
 func (t CmdToken) String() string {
@@ -43,6 +44,11 @@ func NewScanner(src io.Reader) *CmdScanner {
 	return scanner
 }
 
+// Source returns the scanned source.
+func (s *CmdScanner) Source() []rune {
+	return s.src
+}
+
 func (s *CmdScanner) SetDebug(v bool) {
 	s.debug = v
 }
@@ -60,6 +66,12 @@ func (s *CmdScanner) reset() {
 	s.currRune = 0
 }
 
+// seek moves the scanner to the rune at offset.
+func (s *CmdScanner) seek(offset int) {
+	s.readPosition = offset
+	s.readRune()
+}
+
 func (s *CmdScanner) readRune() {
 	if s.readPosition >= len(s.src) {
 		s.currRune = 0
@@ -104,75 +116,239 @@ func (s *CmdScanner) isWord() bool {
 
 func (s *CmdScanner) readVariable() CmdToken {
 	if curr := s.currRune; curr != '$' {
+		var tok = s.illegal("expected $ got %s", describe(curr))
 		s.readRune() // skip
-		return CmdToken{
-			Typ: ILLEGAL_TOKEN,
-			Lit: fmt.Sprintf("expected $ got %c", curr),
-		}
+		return tok
 	}
 	s.readRune()
 
 	if curr := s.currRune; curr != '{' {
+		var tok = s.illegal("expected { got %s", describe(curr))
 		s.readRune() // skip
-		return CmdToken{
-			Typ: ILLEGAL_TOKEN,
-			Lit: fmt.Sprintf("expected { got %c", curr),
-		}
+		return tok
 	}
 	s.readRune()
 
-	if !s.isIdentifierPartFirst() {
-		return CmdToken{
-			Typ: ILLEGAL_TOKEN,
-			Lit: fmt.Sprintf("expected identifier, got %c", s.currRune),
+	var start = s.position
+	if s.isIdentifierPartFirst() {
+		s.readIdentifier()
+		for s.currRune == '.' {
+			// a nested value, e.g. ${db.host}
+			s.readRune()
+			if !s.isIdentifierPartFirst() {
+				return s.illegal("expected identifier after ., got %s", describe(s.currRune))
+			}
+			s.readIdentifier()
+		}
+	}
+	if s.position == start || !s.isVariableEnd() {
+		s.seek(start)
+		return s.readExpr()
+	}
+
+	if curr := s.currRune; curr == ':' {
+		s.readRune()
+		s.readVariableFlags()
+		if s.currRune == '"' {
+			// the separator of the elements of a list
+			if tok, ok := s.readQuotedValue(); !ok {
+				return tok
+			}
 		}
+	} else if curr != '}' && !isModifier(curr) {
+		var tok = s.illegal("expected : got %s", describe(curr))
+		s.readRune() // skip
+		return tok
 	}
-	var name = s.readIdentifier()
 
-	if curr := s.currRune; curr == '}' {
+	if isModifier(s.currRune) {
 		s.readRune()
-		return CmdToken{
-			Typ: ARG,
-			Lit: name,
+		if tok, ok := s.readQuotedValue(); !ok {
+			return tok
 		}
 	}
 
-	if curr := s.currRune; curr != ':' {
+	if curr := s.currRune; curr != '}' {
+		var tok = s.illegal("expected } got %s", describe(curr))
 		s.readRune() // skip
-		return CmdToken{
-			Typ: ILLEGAL_TOKEN,
-			Lit: fmt.Sprintf("expected : got %c", curr),
-		}
+		return tok
 	}
+	var lit = string(s.src[start:s.position])
 	s.readRune()
 
-	var flags = s.readVariableFlags()
+	return CmdToken{
+		Typ: ARG,
+		Lit: lit,
+	}
+}
+
+// isVariableEnd reports whether the current rune ends the name of a
+// variable, i.e. it starts its flags or its modifier, or it closes it. If it
+// does not, the variable is an expression, e.g. ${count + 1}. A + right
+// after a name is the alternate value modifier only if its quoted value
+// follows, so ${count+"x"} is a modifier, but ${count+1} is an addition.
+func (s *CmdScanner) isVariableEnd() bool {
+	switch s.currRune {
+	case ':', '}':
+		return true
+	case '+':
+		return s.readPosition < len(s.src) && s.src[s.readPosition] == '"'
+	}
+	return isModifier(s.currRune)
+}
+
+// readExpr reads the rest of an expression variable, e.g. count + 1:%q}. The
+// literal of the token is the expression, followed by its flags and
+// separator.
+func (s *CmdScanner) readExpr() CmdToken {
+	var start = s.position
+	var end = exprEnd(s.src, start)
+	if end == start {
+		return s.illegal("expected identifier or expression, got %s", describe(s.currRune))
+	}
+	s.seek(end)
+
+	if s.currRune == ':' {
+		s.readRune()
+		s.readVariableFlags()
+		if s.currRune == '"' {
+			if tok, ok := s.readQuotedValue(); !ok {
+				return tok
+			}
+		}
+	}
 
 	if curr := s.currRune; curr != '}' {
+		var tok = s.illegal("expected } got %s", describe(curr))
 		s.readRune() // skip
-		return CmdToken{
-			Typ: ILLEGAL_TOKEN,
-			Lit: fmt.Sprintf("expected } got %c", curr),
-		}
+		return tok
 	}
+	var lit = string(s.src[start:s.position])
 	s.readRune()
 
 	return CmdToken{
-		Typ: ARG,
-		Lit: fmt.Sprintf("%s:%s", name, flags),
+		Typ: EXPR,
+		Lit: lit,
+	}
+}
+
+// exprEnd returns the offset of the : or } that ends the expression that
+// starts at src[start]. Parentheses, brackets, braces and Well strings are
+// skipped. It returns the offset of the end of input if there is none.
+func exprEnd(src []rune, start int) int {
+	var depth = 0
+	for i := start; i < len(src); i++ {
+		switch src[i] {
+		case 0:
+			return i
+		case '(', '[', '{':
+			depth += 1
+		case ')', ']':
+			if depth > 0 {
+				depth -= 1
+			}
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth -= 1
+		case ':':
+			if depth == 0 {
+				return i
+			}
+		case '"', '`':
+			var quote = src[i]
+			for i += 1; i < len(src) && src[i] != quote && src[i] != 0; i++ {
+				if src[i] == '\\' && quote == '"' {
+					i += 1
+				}
+			}
+			if i >= len(src) {
+				return len(src)
+			}
+			if src[i] == 0 {
+				return i
+			}
+		}
+	}
+	return len(src)
+}
+
+// SplitExpr splits the literal of an EXPR token into its expression and the
+// rest, i.e. its flags and separator, without the colon.
+func SplitExpr(lit string) (string, string) {
+	var src = []rune(lit)
+	var end = exprEnd(src, 0)
+	var expr = string(src[:end])
+	if end == len(src) {
+		return expr, ""
 	}
+	return expr, string(src[end+1:])
+}
+
+// illegal returns an ILLEGAL_TOKEN at the current rune, the message is its
+// literal.
+func (s *CmdScanner) illegal(format string, args ...interface{}) CmdToken {
+	return CmdToken{
+		Typ: ILLEGAL_TOKEN,
+		Lit: fmt.Sprintf(format, args...),
+		Pos: s.position,
+	}
+}
+
+// describe returns ch for error messages.
+func describe(ch rune) string {
+	if ch == 0 {
+		return "end of input"
+	}
+	return fmt.Sprintf("%c", ch)
+}
+
+// isModifier reports whether ch starts the modifier of a variable, i.e. a
+// default value (|), a required message (?) or an alternate value (+).
+func isModifier(ch rune) bool {
+	return ch == '|' || ch == '?' || ch == '+'
+}
+
+// readQuotedValue reads the double quoted value of a modifier or a
+// separator. In the value, a backslash escapes a double quote or a backslash.
+func (s *CmdScanner) readQuotedValue() (CmdToken, bool) {
+	if curr := s.currRune; curr != '"' {
+		var tok = s.illegal("expected \" got %s", describe(curr))
+		s.readRune() // skip
+		return tok, false
+	}
+	s.readRune()
+	for s.currRune != '"' {
+		if s.currRune == 0 {
+			return s.illegal("unclosed variable value"), false
+		}
+		if s.currRune == '\\' {
+			s.readRune()
+			if s.currRune == 0 {
+				continue
+			}
+		}
+		s.readRune()
+	}
+	s.readRune()
+	return CmdToken{}, true
 }
 
 func (s *CmdScanner) readVariableFlags() string {
 	var position = s.position
 
+	if curr := s.currRune; curr == '"' || curr == '}' || curr == 0 || isModifier(curr) {
+		// no flags, e.g. ${name:", "} or ${name:}
+		return ""
+	}
 	if want, curr := '%', s.currRune; curr != want {
 		s.readRune() // skip
 		return ""
 	}
 	s.readRune() // skip
 
-	for s.currRune != '}' && s.currToken.Typ != EOF {
+	for s.currRune != '}' && s.currRune != '"' && !isModifier(s.currRune) && s.currRune != 0 {
 		s.readRune()
 	}
 
@@ -244,7 +420,11 @@ func (s *CmdScanner) getCurrPosition() (int, int) {
 }
 
 func (s *CmdScanner) NextToken() (CmdToken, error) {
+	var start = s.position
 	var t, err = s.nextToken()
+	if t.Typ != ILLEGAL_TOKEN {
+		t.Pos = start
+	}
 	s.currToken = t
 	if s.debug {
 		s.PrintCursor("[debug]")
@@ -264,46 +444,46 @@ func (s *CmdScanner) nextToken() (CmdToken, error) {
 		s.readRune() // get the next one
 
 		switch s.currRune {
-		case '«', '»', '‹', '›', '$':
-			var tok = CmdToken{WORD, fmt.Sprintf("%c", s.currRune)}
+		case '«', '»', '‹', '›', '$', '\'', '"':
+			var tok = CmdToken{Typ: WORD, Lit: fmt.Sprintf("%c", s.currRune)}
 			s.readRune()
 			return tok, nil
 		default:
-			var tok = CmdToken{WORD, fmt.Sprintf("%c", rn)}
+			var tok = CmdToken{Typ: WORD, Lit: fmt.Sprintf("%c", rn)}
 			return tok, nil
 		}
 	case '\'':
-		var tok = CmdToken{SINGLE_QUOTE, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: SINGLE_QUOTE, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case '"':
-		var tok = CmdToken{DOUBLE_QUOTE, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: DOUBLE_QUOTE, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case '$':
 		var tok = s.readVariable()
 		return tok, nil
 	case '«':
-		var tok = CmdToken{LDOUBLE_GUILLEMET, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: LDOUBLE_GUILLEMET, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case '»':
-		var tok = CmdToken{RDOUBLE_GUILLEMET, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: RDOUBLE_GUILLEMET, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case '‹':
-		var tok = CmdToken{LSINGLE_GUILLEMET, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: LSINGLE_GUILLEMET, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case '›':
-		var tok = CmdToken{RSINGLE_GUILLEMET, fmt.Sprintf("%c", s.currRune)}
+		var tok = CmdToken{Typ: RSINGLE_GUILLEMET, Lit: fmt.Sprintf("%c", s.currRune)}
 		s.readRune()
 		return tok, nil
 	case ' ', '\t', '\n', '\r':
 		var tok = s.readWhitespace()
 		return tok, nil
 	case 0:
-		var tok = CmdToken{EOF, ""}
+		var tok = CmdToken{Typ: EOF, Lit: ""}
 		s.readRune()
 		return tok, nil
 	default:
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/siadat/well/syntax/strs/scanner"
 )
 
@@ -16,72 +17,130 @@ func TestScanner(tt *testing.T) {
 		{
 			src: `ls  -lash --directory   -C ./something`,
 			want: []scanner.CmdToken{
-				{scanner.WORD, `ls`},
-				{scanner.SPACE, `  `},
-				{scanner.WORD, `-lash`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `--directory`},
-				{scanner.SPACE, `   `},
-				{scanner.WORD, `-C`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `./something`},
+				{Typ: scanner.WORD, Lit: `ls`},
+				{Typ: scanner.SPACE, Lit: `  `},
+				{Typ: scanner.WORD, Lit: `-lash`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `--directory`},
+				{Typ: scanner.SPACE, Lit: `   `},
+				{Typ: scanner.WORD, Lit: `-C`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `./something`},
 			},
 		},
 		{
 			src: `echo "Hello ${name}!"`,
 			want: []scanner.CmdToken{
-				{scanner.WORD, `echo`},
-				{scanner.SPACE, ` `},
-				{scanner.DOUBLE_QUOTE, `"`},
-				{scanner.WORD, `Hello`},
-				{scanner.SPACE, ` `},
-				{scanner.ARG, `name`},
-				{scanner.WORD, `!`},
-				{scanner.DOUBLE_QUOTE, `"`},
+				{Typ: scanner.WORD, Lit: `echo`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.DOUBLE_QUOTE, Lit: `"`},
+				{Typ: scanner.WORD, Lit: `Hello`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `name`},
+				{Typ: scanner.WORD, Lit: `!`},
+				{Typ: scanner.DOUBLE_QUOTE, Lit: `"`},
 			},
 		},
 		{
 			src: `one ${var} three`,
 			want: []scanner.CmdToken{
-				{scanner.WORD, `one`},
-				{scanner.SPACE, ` `},
-				{scanner.ARG, `var`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `three`},
+				{Typ: scanner.WORD, Lit: `one`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `var`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `three`},
 			},
 		},
 		{
 			src: `one ${var:%q} three`,
 			want: []scanner.CmdToken{
-				{scanner.WORD, `one`},
-				{scanner.SPACE, ` `},
-				{scanner.ARG, `var:%q`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `three`},
+				{Typ: scanner.WORD, Lit: `one`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `var:%q`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `three`},
+			},
+		},
+		{
+			src: `cp ${src|"a \"b\" c"} ${dst:%q?"where to?"}${flag+"-v"}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.WORD, Lit: `cp`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `src|"a \"b\" c"`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `dst:%q?"where to?"`},
+				{Typ: scanner.ARG, Lit: `flag+"-v"`},
+			},
+		},
+		{
+			src: `psql -h ${db.host} -p ${db.port_1:%q}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.WORD, Lit: `psql`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `-h`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `db.host`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `-p`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `db.port_1:%q`},
 			},
 		},
 		{
 			src: `one «${var_123:%q} «this is \«three\»» four» end`,
 			want: []scanner.CmdToken{
-				{scanner.WORD, `one`},
-				{scanner.SPACE, ` `},
-				{scanner.LDOUBLE_GUILLEMET, `«`},
-				{scanner.ARG, `var_123:%q`},
-				{scanner.SPACE, ` `},
-				{scanner.LDOUBLE_GUILLEMET, `«`},
-				{scanner.WORD, `this`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `is`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `«`}, // NOTE: this is a WORD, because it was escaped
-				{scanner.WORD, `three`},
-				{scanner.WORD, `»`}, // NOTE: this is a WORD, because it was escaped
-				{scanner.RDOUBLE_GUILLEMET, `»`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `four`},
-				{scanner.RDOUBLE_GUILLEMET, `»`},
-				{scanner.SPACE, ` `},
-				{scanner.WORD, `end`},
+				{Typ: scanner.WORD, Lit: `one`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.LDOUBLE_GUILLEMET, Lit: `«`},
+				{Typ: scanner.ARG, Lit: `var_123:%q`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.LDOUBLE_GUILLEMET, Lit: `«`},
+				{Typ: scanner.WORD, Lit: `this`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `is`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `«`}, // NOTE: this is a WORD, because it was escaped
+				{Typ: scanner.WORD, Lit: `three`},
+				{Typ: scanner.WORD, Lit: `»`}, // NOTE: this is a WORD, because it was escaped
+				{Typ: scanner.RDOUBLE_GUILLEMET, Lit: `»`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `four`},
+				{Typ: scanner.RDOUBLE_GUILLEMET, Lit: `»`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.WORD, Lit: `end`},
+			},
+		},
+		{
+			src: `${count + 1} ${f(x, "}:"):%q", "} ${a.b} ${x|"d"}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.EXPR, Lit: `count + 1`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.EXPR, Lit: `f(x, "}:"):%q", "`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `a.b`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `x|"d"`},
+			},
+		},
+		{
+			// + is a modifier only if its quoted value follows
+			src: `${count+1} ${count+"x"} ${a.b+c}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.EXPR, Lit: `count+1`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `count+"x"`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.EXPR, Lit: `a.b+c`},
+			},
+		},
+		{
+			// empty flags
+			src: `${a:}} ${b:|"d"}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.ARG, Lit: `a:`},
+				{Typ: scanner.WORD, Lit: `}`},
+				{Typ: scanner.SPACE, Lit: ` `},
+				{Typ: scanner.ARG, Lit: `b:|"d"`},
 			},
 		},
 	}
@@ -105,8 +164,98 @@ func TestScanner(tt *testing.T) {
 		if diff := cmp.Diff(([]error)(nil), errs); diff != "" {
 			tt.Fatalf("case error failed to match src=%q (-want +got):\n%s", src, diff)
 		}
-		if diff := cmp.Diff(tc.want, got); diff != "" {
+		if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(scanner.CmdToken{}, "Pos")); diff != "" {
 			tt.Fatalf("case failed src=%q (-want +got):\n%s", src, diff)
 		}
 	}
 }
+
+func TestScannerPositions(tt *testing.T) {
+	var testCases = []struct {
+		src  string
+		want []scanner.CmdToken
+	}{
+		{
+			src: `a «b» \‹${c:%q}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.WORD, Lit: `a`, Pos: 0},
+				{Typ: scanner.SPACE, Lit: ` `, Pos: 1},
+				{Typ: scanner.LDOUBLE_GUILLEMET, Lit: `«`, Pos: 2},
+				{Typ: scanner.WORD, Lit: `b`, Pos: 3},
+				{Typ: scanner.RDOUBLE_GUILLEMET, Lit: `»`, Pos: 4},
+				{Typ: scanner.SPACE, Lit: ` `, Pos: 5},
+				{Typ: scanner.WORD, Lit: `‹`, Pos: 6},
+				{Typ: scanner.ARG, Lit: `c:%q`, Pos: 8},
+			},
+		},
+		{
+			src: `echo ${abc x}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.WORD, Lit: `echo`, Pos: 0},
+				{Typ: scanner.SPACE, Lit: ` `, Pos: 4},
+				{Typ: scanner.EXPR, Lit: `abc x`, Pos: 5},
+			},
+		},
+		{
+			src: `echo ${(x}`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.WORD, Lit: `echo`, Pos: 0},
+				{Typ: scanner.SPACE, Lit: ` `, Pos: 4},
+				{Typ: scanner.ILLEGAL_TOKEN, Lit: `expected } got end of input`, Pos: 10},
+			},
+		},
+		{
+			src: `${abc|"x`,
+			want: []scanner.CmdToken{
+				{Typ: scanner.ILLEGAL_TOKEN, Lit: `unclosed variable value`, Pos: 8},
+			},
+		},
+	}
+
+	for ti, tc := range testCases {
+		var s = scanner.NewScanner(strings.NewReader(tc.src))
+		var got []scanner.CmdToken
+		for {
+			var t, _ = s.NextToken()
+			if t.Typ == scanner.EOF {
+				break
+			}
+			got = append(got, t)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			tt.Fatalf("mismatching results (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+	}
+}
+
+func FuzzScanner(f *testing.F) {
+	for _, src := range []string{
+		`ls -lash "./some dir"`,
+		`sh -c «echo ‹${name:%q}› \«x\» 'it\'s'»`,
+		`${x|"\"d\""} ${y:%Q", "?"msg"} ${z.w:%d+"-v"} ${a:}`,
+		`${1} ${x ${x:%q"} \`,
+	} {
+		f.Add(src)
+	}
+	f.Fuzz(func(tt *testing.T, src string) {
+		var s = scanner.NewScanner(strings.NewReader(src))
+		var size = len(s.Source())
+		var prev = 0
+		for i := 0; ; i++ {
+			if i > size+1 {
+				tt.Fatalf("too many tokens src=%q", src)
+			}
+			var t, err = s.NextToken()
+			if err != nil {
+				tt.Fatalf("unexpected error src=%q: %v", src, err)
+			}
+			if t.Pos < prev || t.Pos > size {
+				tt.Fatalf("token %s at %d is out of order or out of range src=%q", t, t.Pos, src)
+			}
+			prev = t.Pos
+			if t.Typ == scanner.EOF || t.Typ == scanner.ILLEGAL_TOKEN {
+				break
+			}
+		}
+	})
+}
@@ -10,6 +10,7 @@ const (
 	WORD // TODO: rename to FRAGMENT?
 	SPACE
 	ARG
+	EXPR // ${count + 1}
 	// ARG_FLAGS
 
 	SINGLE_QUOTE // '
@@ -52,6 +53,7 @@ func (t CmdTokenType) String() string {
 		WORD:  "WORD",
 		SPACE: "SPACE",
 		ARG:   "ARG",
+		EXPR:  "EXPR",
 		// ARG_FLAGS: "ARG_FLAGS",
 
 		SINGLE_QUOTE: "SINGLE_QUOTE",
@@ -113,6 +113,8 @@ var Precedences = map[Token]Precedence{
 	QUO: 2,
 
 	LPAREN: 3,
+	LBRACK: 3,
+	PERIOD: 3,
 }
 
 func (tok Token) String() string {
@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siadat/well/interpreter"
+)
+
+// Chrome trace-event format, as loaded by chrome://tracing and Perfetto.
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+
+const (
+	functionsTid = 1
+	commandsTid  = 2
+)
+
+type chromeEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat,omitempty"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"` // in microseconds
+	Dur  int64             `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+type chromeTracer struct {
+	w      io.Writer
+	start  time.Time
+	events []chromeEvent
+	calls  []chromeEvent // the calls that have not returned yet
+	mu     sync.Mutex
+}
+
+// NewChromeTracer returns a tracer that writes the events as Chrome
+// trace-event JSON to w when it is closed. Calls of Well functions and
+// external commands are on separate threads, because commands may outlive
+// the calls that start them.
+func NewChromeTracer(w io.Writer) *chromeTracer {
+	return &chromeTracer{
+		w: w,
+		events: []chromeEvent{
+			{Name: "thread_name", Ph: "M", Pid: 1, Tid: functionsTid, Args: map[string]string{"name": "functions"}},
+			{Name: "thread_name", Ph: "M", Pid: 1, Tid: commandsTid, Args: map[string]string{"name": "commands"}},
+		},
+	}
+}
+
+func (t *chromeTracer) Trace(event interpreter.TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var start = event.Time
+	if event.Kind == interpreter.TraceReturn {
+		start = event.Time.Add(-event.Duration)
+	}
+	if t.start.IsZero() {
+		t.start = start
+	}
+
+	switch event.Kind {
+	case interpreter.TraceCall:
+		var args = make(map[string]string)
+		for _, arg := range event.Args {
+			args[arg.Name] = formatValue(arg.Value)
+		}
+		if event.Position.IsValid() {
+			args["position"] = event.Position.String()
+		}
+		t.calls = append(t.calls, chromeEvent{
+			Name: event.Name,
+			Cat:  "function",
+			Ph:   "X",
+			Ts:   t.micros(start),
+			Pid:  1,
+			Tid:  functionsTid,
+			Args: args,
+		})
+	case interpreter.TraceReturn:
+		if len(t.calls) == 0 {
+			return
+		}
+		var call = t.calls[len(t.calls)-1]
+		t.calls = t.calls[:len(t.calls)-1]
+		call.Dur = event.Duration.Microseconds()
+		if event.Result != nil {
+			call.Args["result"] = formatValue(event.Result)
+		}
+		t.events = append(t.events, call)
+	case interpreter.TraceCommand:
+		t.events = append(t.events, chromeEvent{
+			Name: event.Name,
+			Cat:  "command",
+			Ph:   "X",
+			Ts:   t.micros(start),
+			Dur:  event.Duration.Microseconds(),
+			Pid:  1,
+			Tid:  commandsTid,
+			Args: map[string]string{
+				"argv":      formatArgv(event.Argv),
+				"exit code": strconv.Itoa(event.ExitCode),
+			},
+		})
+	}
+}
+
+func (t *chromeTracer) micros(tm time.Time) int64 {
+	return tm.Sub(t.start).Microseconds()
+}
+
+// Close writes the trace. Calls that have not returned, e.g. because of an
+// error, are written as begin events without an end.
+func (t *chromeTracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events = t.events
+	for _, call := range t.calls {
+		call.Ph = "B"
+		events = append(events, call)
+	}
+	var enc = json.NewEncoder(t.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
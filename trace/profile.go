@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/siadat/well/interpreter"
+)
+
+// subcommandPrograms are the programs whose subcommands are profiled
+// separately, e.g. "docker build" and "docker push". Other programs are
+// grouped by their name, so that "grep foo" and "grep bar" are one row.
+var subcommandPrograms = map[string]bool{
+	"cargo":   true,
+	"docker":  true,
+	"git":     true,
+	"go":      true,
+	"helm":    true,
+	"kubectl": true,
+	"npm":     true,
+	"podman":  true,
+}
+
+// subcommand matches arguments like "build" in "docker build", but not flags
+// like "-C" in "git -C dir log".
+var subcommand = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+type profileEntry struct {
+	kind  string
+	name  string
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+type profiler struct {
+	entries map[string]*profileEntry
+	active  map[string]int // the number of frames of each function on the stack
+	mu      sync.Mutex
+}
+
+// NewProfiler returns a tracer that aggregates the wall time of each Well
+// function and each external command. The time of a function includes the
+// time of the functions it calls. A recursive function counts every call,
+// but only the time of its outermost call, so that no time is counted twice.
+func NewProfiler() *profiler {
+	return &profiler{
+		entries: make(map[string]*profileEntry),
+		active:  make(map[string]int),
+	}
+}
+
+func (p *profiler) Trace(event interpreter.TraceEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var kind, name string
+	var duration = event.Duration
+	switch event.Kind {
+	case interpreter.TraceCall:
+		p.active[event.Name] += 1
+		return
+	case interpreter.TraceReturn:
+		kind, name = "function", event.Name
+		p.active[name] -= 1
+		if p.active[name] > 0 {
+			// an outer call of the same function is still running, its
+			// time includes this one
+			duration = 0
+		} else {
+			delete(p.active, name)
+		}
+	case interpreter.TraceCommand:
+		kind, name = "command", event.Name
+		if len(event.Argv) > 1 && subcommandPrograms[event.Name] && subcommand.MatchString(event.Argv[1]) {
+			name += " " + event.Argv[1]
+		}
+	default:
+		return
+	}
+
+	var key = kind + " " + name
+	var entry, ok = p.entries[key]
+	if !ok {
+		entry = &profileEntry{kind: kind, name: name}
+		p.entries[key] = entry
+	}
+	entry.count += 1
+	entry.total += duration
+	if duration > entry.max {
+		entry.max = duration
+	}
+}
+
+// WriteReport writes a table of the functions and commands, the ones that
+// took the longest in total first.
+func (p *profiler) WriteReport(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var entries []*profileEntry
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].total != entries[j].total {
+			return entries[i].total > entries[j].total
+		}
+		if entries[i].kind != entries[j].kind {
+			return entries[i].kind < entries[j].kind
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "KIND\tNAME\tCOUNT\tTOTAL\tMEAN\tMAX\n")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			entry.kind,
+			entry.name,
+			entry.count,
+			formatDuration(entry.total),
+			formatDuration(entry.total/time.Duration(entry.count)),
+			formatDuration(entry.max),
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,18 @@
+package trace
+
+import (
+	"github.com/siadat/well/interpreter"
+)
+
+type tee []interpreter.Tracer
+
+// Tee returns a tracer that passes the events to all tracers.
+func Tee(tracers ...interpreter.Tracer) interpreter.Tracer {
+	return tee(tracers)
+}
+
+func (t tee) Trace(event interpreter.TraceEvent) {
+	for _, tracer := range t {
+		tracer.Trace(event)
+	}
+}
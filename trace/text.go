@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siadat/well/interpreter"
+)
+
+// This package implements the tracers of "well run --trace", which log the
+// calls of Well functions and the external commands with their durations.
+
+const maxValueLen = 60
+
+type textTracer struct {
+	w  io.Writer
+	mu sync.Mutex // commands may exit in other goroutines
+}
+
+// NewTextTracer returns a tracer that writes one line per event to w,
+// indented by the call depth.
+func NewTextTracer(w io.Writer) *textTracer {
+	return &textTracer{w: w}
+}
+
+func (t *textTracer) Trace(event interpreter.TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var indent = strings.Repeat("  ", event.Depth-1)
+	switch event.Kind {
+	case interpreter.TraceCall:
+		var args []string
+		for _, arg := range event.Args {
+			args = append(args, fmt.Sprintf("%s=%s", arg.Name, formatValue(arg.Value)))
+		}
+		var at = ""
+		if event.Position.IsValid() {
+			at = " at " + event.Position.String()
+		}
+		fmt.Fprintf(t.w, "%s→ %s(%s)%s\n", indent, event.Name, strings.Join(args, ", "), at)
+	case interpreter.TraceReturn:
+		var result = ""
+		if event.Result != nil {
+			result = " = " + formatValue(event.Result)
+		}
+		fmt.Fprintf(t.w, "%s← %s%s (%s)\n", indent, event.Name, result, formatDuration(event.Duration))
+	case interpreter.TraceCommand:
+		// commands run inside the call of their external function
+		fmt.Fprintf(t.w, "%s  $ %s (exit %d, %s)\n", indent, formatArgv(event.Argv), event.ExitCode, formatDuration(event.Duration))
+	}
+}
+
+// formatValue returns strings quoted, and shortens long values.
+func formatValue(obj interpreter.Object) string {
+	var s string
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *interpreter.String:
+		s = strconv.Quote(obj.String())
+	case *interpreter.PipeStream:
+		return "stream"
+	default:
+		s = obj.String()
+	}
+	if r := []rune(s); len(r) > maxValueLen {
+		s = string(r[:maxValueLen]) + "…"
+	}
+	return s
+}
+
+// formatArgv quotes the arguments that would not be read back as a single
+// word by a shell.
+func formatArgv(argv []string) string {
+	var words []string
+	for _, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`|&;<>()*?") {
+			arg = strconv.Quote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,140 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/siadat/well/interpreter"
+	"github.com/siadat/well/syntax/scanner"
+	"github.com/siadat/well/trace"
+)
+
+func TestTextTracer(tt *testing.T) {
+	var src = `external echo(s string) => "echo ${s}"
+
+function greet(name string) string {
+  return "hello ${name}"
+}
+
+function (stdin reader) | main() {
+  let a = greet("x")
+  print_stream(echo(a))
+}
+`
+	var stdout, stderr bytes.Buffer
+	var interp = interpreter.NewInterpreter(&stdout, &stdout)
+	interp.SetTracer(trace.NewTextTracer(&stderr))
+	var env = interpreter.NewEnvironment()
+	if err := env.Set("MainStdin", &interpreter.PipeStream{}); err != nil {
+		tt.Fatal(err)
+	}
+	if _, err := interp.EvalFile("test.well", strings.NewReader(src), env); err != nil {
+		tt.Fatal(err)
+	}
+
+	var durations = regexp.MustCompile(`[0-9.]+[µm]?s\)`)
+	var got = durations.ReplaceAllString(stderr.String(), "DURATION)")
+	var want = "→ main(stdin=stream)\n" +
+		"  → greet(name=\"x\") at test.well:8:11\n" +
+		"  ← greet = \"hello x\" (DURATION)\n" +
+		"  → echo(s=\"hello x\") at test.well:9:16\n" +
+		"  ← echo = stream (DURATION)\n" +
+		"    $ echo hello x (exit 0, DURATION)\n" +
+		"← main (DURATION)\n"
+	if diff := cmp.Diff(want, got); diff != "" {
+		tt.Fatalf("mismatching results\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestChromeTracer(tt *testing.T) {
+	var start = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events = []interpreter.TraceEvent{
+		{Kind: interpreter.TraceCall, Depth: 1, Name: "main", Time: start},
+		{
+			Kind: interpreter.TraceCall, Depth: 2, Name: "build", Time: start.Add(10 * time.Microsecond),
+			Args:     []interpreter.TraceArg{{Name: "target", Value: &interpreter.String{AsSingle: "all"}}},
+			Position: scanner.Position{Filename: "test.well", Line: 3, Column: 5},
+		},
+		{Kind: interpreter.TraceCommand, Depth: 2, Name: "make", Argv: []string{"make", "all"}, Time: start.Add(20 * time.Microsecond), Duration: 500 * time.Microsecond},
+		{Kind: interpreter.TraceReturn, Depth: 2, Name: "build", Time: start.Add(600 * time.Microsecond), Duration: 590 * time.Microsecond},
+	}
+
+	var out bytes.Buffer
+	var tracer = trace.NewChromeTracer(&out)
+	for _, event := range events {
+		tracer.Trace(event)
+	}
+	if err := tracer.Close(); err != nil {
+		tt.Fatal(err)
+	}
+
+	var got, want any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		tt.Fatal(err)
+	}
+	var wantJSON = `{
+		"traceEvents": [
+			{"name": "thread_name", "ph": "M", "ts": 0, "pid": 1, "tid": 1, "args": {"name": "functions"}},
+			{"name": "thread_name", "ph": "M", "ts": 0, "pid": 1, "tid": 2, "args": {"name": "commands"}},
+			{"name": "make", "cat": "command", "ph": "X", "ts": 20, "dur": 500, "pid": 1, "tid": 2, "args": {"argv": "make all", "exit code": "0"}},
+			{"name": "build", "cat": "function", "ph": "X", "ts": 10, "dur": 590, "pid": 1, "tid": 1, "args": {"target": "\"all\"", "position": "test.well:3:5"}},
+			{"name": "main", "cat": "function", "ph": "B", "ts": 0, "pid": 1, "tid": 1}
+		],
+		"displayTimeUnit": "ms"
+	}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		tt.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		tt.Fatalf("mismatching results\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
+
+func TestProfiler(tt *testing.T) {
+	var events = []interpreter.TraceEvent{
+		{Kind: interpreter.TraceCall, Name: "main"},
+		{Kind: interpreter.TraceCommand, Name: "docker", Argv: []string{"docker", "build", "."}, Duration: 3 * time.Second},
+		{Kind: interpreter.TraceCommand, Name: "docker", Argv: []string{"docker", "build", "-t", "x", "."}, Duration: 5 * time.Second},
+		{Kind: interpreter.TraceCommand, Name: "git", Argv: []string{"git", "-C", "dir", "log"}, Duration: 50 * time.Millisecond},
+		{Kind: interpreter.TraceCommand, Name: "grep", Argv: []string{"grep", "foo"}, Duration: 20 * time.Millisecond},
+		{Kind: interpreter.TraceCommand, Name: "grep", Argv: []string{"grep", "bar"}, Duration: 30 * time.Millisecond},
+		{Kind: interpreter.TraceCall, Name: "fetch"},
+		{Kind: interpreter.TraceCommand, Name: "curl", Argv: []string{"curl", "-s", "https://example.com"}, Duration: 200 * time.Millisecond},
+		{Kind: interpreter.TraceReturn, Name: "fetch", Duration: 210 * time.Millisecond},
+		// a recursive function, only its outermost call is in its total
+		{Kind: interpreter.TraceCall, Name: "walk"},
+		{Kind: interpreter.TraceCall, Name: "walk"},
+		{Kind: interpreter.TraceCall, Name: "walk"},
+		{Kind: interpreter.TraceReturn, Name: "walk", Duration: 100 * time.Millisecond},
+		{Kind: interpreter.TraceReturn, Name: "walk", Duration: 200 * time.Millisecond},
+		{Kind: interpreter.TraceReturn, Name: "walk", Duration: 300 * time.Millisecond},
+		{Kind: interpreter.TraceReturn, Name: "main", Duration: 8500 * time.Millisecond},
+	}
+
+	var profiler = trace.NewProfiler()
+	var tracer = trace.Tee(profiler)
+	for _, event := range events {
+		tracer.Trace(event)
+	}
+	var out bytes.Buffer
+	if err := profiler.WriteReport(&out); err != nil {
+		tt.Fatal(err)
+	}
+
+	var want = "KIND      NAME          COUNT  TOTAL  MEAN   MAX\n" +
+		"function  main          1      8.5s   8.5s   8.5s\n" +
+		"command   docker build  2      8s     4s     5s\n" +
+		"function  walk          3      300ms  100ms  300ms\n" +
+		"function  fetch         1      210ms  210ms  210ms\n" +
+		"command   curl          1      200ms  200ms  200ms\n" +
+		"command   git           1      50ms   50ms   50ms\n" +
+		"command   grep          2      50ms   25ms   30ms\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		tt.Fatalf("mismatching results\ndiff guide:\n  - want\n  + got\ndiff:\n%s", diff)
+	}
+}
@@ -1,60 +1,198 @@
 package types
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/siadat/well/diagnostics"
 	"github.com/siadat/well/erroring"
-	"github.com/siadat/well/fumt"
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/parser"
 	"github.com/siadat/well/syntax/scanner"
+	strs_parser "github.com/siadat/well/syntax/strs/parser"
+	"github.com/siadat/well/syntax/token"
 )
 
 func NewChecker() typeChecker {
 	return typeChecker{
-		types:         make(map[ast.Expr]Type),
-		files:         make(map[string]scanner.Pos),
-		commands:      make(map[string]scanner.Pos),
-		externalDecls: make(map[string]struct{}),
+		types:    make(map[ast.Expr]Type),
+		globals:  make(map[string]Type),
+		files:    make(map[string]*Dependency),
+		commands: make(map[string]*Dependency),
+
+		funcs:         make(map[string]*ast.FuncDecl),
+		secretArgs:    make(map[string]map[string]bool),
+		secretResults: make(map[string]bool),
 	}
 }
 
 type typeChecker struct {
-	types  map[ast.Expr]Type
-	parser *parser.Parser
-	debug  bool
+	types   map[ast.Expr]Type
+	globals map[string]Type // the types of the top level declarations
+	locals  map[string]Type // the types of the variables of the function being checked
+	parser  *parser.Parser
+	debug   bool
+
+	files    map[string]*Dependency
+	commands map[string]*Dependency
+	dir      string // the directory of the program, files are relative to it
+
+	// Secrets are tracked through the arguments and the results of the
+	// functions. A program is checked again until no more are found.
+	funcs         map[string]*ast.FuncDecl
+	secretArgs    map[string]map[string]bool // the args of each function that are given a secret
+	secretResults map[string]bool            // the functions that return a secret
+	currFunc      string                     // the name of the function being checked
+	foundSecrets  bool                       // a secret arg or result was found in this pass
+}
+
+// Dependency is a file or an external command a program needs in order to
+// run. Commands are resolved on $PATH and files are resolved relative to the
+// directory set with SetDir.
+type Dependency struct {
+	Kind   string `json:"kind"` // "file" or "command"
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Found  bool   `json:"found"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+
+	Position scanner.Pos `json:"-"`
+
+	resolved bool
+	err      error // the error of resolving a file, if it is not a missing file
+}
 
-	files    map[string]scanner.Pos
-	commands map[string]scanner.Pos
+// SetDir sets the directory that the files of "requires file" are relative
+// to, i.e. the directory of the program. It is the current working directory
+// by default.
+func (tc *typeChecker) SetDir(dir string) {
+	tc.dir = dir
+}
 
-	externalDecls map[string]struct{}
+// Dependencies returns all declared files and all commands used by external
+// functions or declared with "requires command", sorted by position. They
+// are looked up on $PATH and in the file system the first time they are
+// returned, not while checking, which runs on every change in an editor.
+func (tc *typeChecker) Dependencies() []Dependency {
+	var deps []Dependency
+	for _, dep := range tc.files {
+		tc.resolve(dep)
+		deps = append(deps, *dep)
+	}
+	for _, dep := range tc.commands {
+		tc.resolve(dep)
+		deps = append(deps, *dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Position != deps[j].Position {
+			return deps[i].Position < deps[j].Position
+		}
+		return deps[i].Name < deps[j].Name
+	})
+	return deps
 }
 
 func (tc *typeChecker) UnresolvedDependencies() []string {
 	const lenLimit = 110
 	var rets []string
-	for name, pos := range tc.files {
-		var line, col = tc.parser.GetLineColAt(pos)
-		if len(name) > lenLimit {
-			name = name[:lenLimit] + "..."
-		}
-		rets = append(rets, fmt.Sprintf("%d:%d \t%s", line+1, col+1, name))
-	}
-	for name, pos := range tc.commands {
-		if _, ok := tc.externalDecls[name]; ok {
+	for _, dep := range tc.Dependencies() {
+		if dep.Found {
 			continue
 		}
-		var line, col = tc.parser.GetLineColAt(pos)
+		var name = dep.Name
 		if len(name) > lenLimit {
 			name = name[:lenLimit] + "..."
 		}
-		rets = append(rets, fmt.Sprintf("%d:%d \t%s", line+1, col+1, name))
+		var reason = "not found in $PATH"
+		if dep.Kind == "file" {
+			reason = "no such file"
+		}
+		if dep.err != nil {
+			reason = dep.err.Error()
+		}
+		rets = append(rets, fmt.Sprintf("%d:%d \t%s %s (%s)", dep.Line, dep.Column, dep.Kind, name, reason))
 	}
 	return rets
 }
 
+func (tc *typeChecker) addCommand(name string, pos scanner.Pos) {
+	if _, ok := tc.commands[name]; ok {
+		return
+	}
+	var line, col = tc.parser.GetLineColAt(pos)
+	tc.commands[name] = &Dependency{Kind: "command", Name: name, Line: line + 1, Column: col + 1, Position: pos}
+}
+
+func (tc *typeChecker) addFile(name string, node ast.Node) {
+	var pos = node.Pos()
+	if _, ok := tc.files[name]; ok {
+		return
+	}
+	var line, col = tc.parser.GetLineColAt(pos)
+	tc.files[name] = &Dependency{Kind: "file", Name: name, Line: line + 1, Column: col + 1, Position: pos}
+}
+
+// resolve looks up dep, once.
+func (tc *typeChecker) resolve(dep *Dependency) {
+	if dep.resolved {
+		return
+	}
+	dep.resolved = true
+	switch dep.Kind {
+	case "command":
+		if path, err := exec.LookPath(dep.Name); err == nil {
+			dep.Path = path
+			dep.Found = true
+		}
+	case "file":
+		var path = dep.Name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(tc.dir, path)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			dep.err = err
+			return
+		}
+		dep.Path = path
+		if _, err := os.Stat(path); err == nil {
+			dep.Found = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			dep.err = fmt.Errorf("failed to check file: %v", err)
+		}
+	}
+}
+
+// commandName returns the first word of an external function's command
+// template, or "" if it cannot be known statically (e.g. "${cmd} -v").
+func commandName(expr ast.Expr) string {
+	var str, ok = expr.(*ast.String)
+	if !ok {
+		return ""
+	}
+	var name strings.Builder
+	for _, item := range str.Root.Items {
+		switch item := item.(type) {
+		case strs_parser.Whs:
+			if name.Len() > 0 {
+				return name.String()
+			}
+		case strs_parser.Wrd:
+			name.WriteString(item.Lit)
+		default:
+			return ""
+		}
+	}
+	return name.String()
+}
+
 func (tc *typeChecker) SetDebug(v bool) {
 	tc.debug = v
 }
@@ -67,6 +205,15 @@ func (tc *typeChecker) Check(src io.Reader) (map[ast.Expr]Type, error) {
 		return nil, parseErr
 	}
 
+	return tc.CheckNode(tc.parser, node)
+}
+
+// CheckNode checks a node that was parsed by p. The top level declarations
+// of the nodes checked before are known, so that a program can be checked
+// incrementally, e.g. in the REPL. It returns the types of all expressions
+// checked so far.
+func (tc *typeChecker) CheckNode(p *parser.Parser, node ast.Node) (map[ast.Expr]Type, error) {
+	tc.parser = p
 	return erroring.CallAndRecover[Error](func() map[ast.Expr]Type {
 		tc.check(node)
 		return tc.types
@@ -77,7 +224,19 @@ func (tc *typeChecker) check(node ast.Node) {
 	switch node := node.(type) {
 	case *ast.Root:
 		for _, decl := range node.Decls {
-			tc.check(decl)
+			if decl, ok := decl.(*ast.FuncDecl); ok {
+				tc.funcs[decl.Name.Name] = decl
+			}
+		}
+		for {
+			tc.foundSecrets = false
+			for _, decl := range node.Decls {
+				tc.check(decl)
+				tc.declare(decl)
+			}
+			if !tc.foundSecrets {
+				break
+			}
 		}
 	case *ast.ParenExpr:
 		for _, expr := range node.Exprs {
@@ -89,45 +248,109 @@ func (tc *typeChecker) check(node ast.Node) {
 		tc.types[node] = WellType{"Function"}
 		tc.types[node.Fun] = WellType{"Function"}
 		tc.check(node.Arg)
-
-		switch fun := node.Fun.(type) {
-		case *ast.Ident:
-			switch fun.Name {
-			case "pipe", "pipe_capture":
-				for _, expr := range node.Arg.Exprs {
-					switch expr := expr.(type) {
-					case *ast.CallExpr:
-						if expr, ok := expr.Fun.(*ast.Ident); ok {
-							var formater = fumt.NewFormater()
-							var command = formater.FormatNode(expr)
-							tc.commands[command] = node.Pos()
-						} else {
-							panic(tc.newError(node.Pos(), "args to pipe must be simple call expressions"))
-						}
-					default:
-						panic(tc.newError(node.Pos(), "args to pipe must be call expressions"))
+		if node.PipedArg != nil {
+			tc.check(node.PipedArg)
+		}
+		if fun, ok := node.Fun.(*ast.Ident); ok {
+			if secretFuncs[fun.Name] || tc.secretResults[fun.Name] {
+				tc.types[node] = WellType{"Secret"}
+			}
+			if decl, ok := tc.funcs[fun.Name]; ok {
+				tc.passSecrets(fun.Name, decl.Signature.Args, node.Arg)
+				tc.passSecrets(fun.Name, decl.Signature.PipedArgs, node.PipedArg)
+			}
+			if typ, ok := containerFuncs[fun.Name]; ok {
+				tc.types[node] = typ
+				for _, arg := range node.Arg.Exprs {
+					if tc.types[arg] == (WellType{"Secret"}) {
+						// a list or a record of secrets is masked like a secret
+						tc.types[node] = WellType{"Secret"}
+					}
+				}
+			}
+			if printFuncs[fun.Name] {
+				for _, arg := range node.Arg.Exprs {
+					if tc.types[arg] == (WellType{"Secret"}) {
+						panic(tc.newError(arg, "cannot print a secret with %s, secrets are only revealed to external commands", fun.Name))
 					}
 				}
 			}
 		}
 	case *ast.ReturnStmt:
 		tc.check(node.Expr)
+		if tc.currFunc != "" && tc.types[node.Expr] == (WellType{"Secret"}) && !tc.secretResults[tc.currFunc] {
+			tc.secretResults[tc.currFunc] = true
+			tc.foundSecrets = true
+		}
 	case *ast.Ident:
-		// NoOp
+		if typ, ok := tc.lookup(node.Name); ok {
+			tc.types[node] = typ
+		}
 	case *ast.IfStmt:
-		// NoOp
+		tc.check(node.Cond)
+		tc.check(node.Body)
+		if node.Else != nil {
+			tc.check(node.Else)
+		}
+	case *ast.BlockStmt:
+		for _, stmt := range node.Statements {
+			tc.check(stmt)
+		}
 	case *ast.FuncSignature:
 		// TODO
 	case *ast.BinaryExpr:
-		// TODO
+		tc.check(node.X)
+		tc.check(node.Y)
+		switch node.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO:
+			var x, y = tc.types[node.X], tc.types[node.Y]
+			switch {
+			case x == (WellType{"Integer"}) && y == (WellType{"Integer"}):
+				tc.types[node] = x
+			case isNumber(x) && isNumber(y):
+				tc.types[node] = WellType{"Float"}
+			}
+		}
+	case *ast.IndexExpr:
+		tc.check(node.X)
+		tc.check(node.Index)
+		if typ := tc.types[node.X]; typ == (WellType{"Secret"}) {
+			tc.types[node] = typ
+		}
+	case *ast.SelectorExpr:
+		tc.check(node.X)
+		if typ := tc.types[node.X]; typ == (WellType{"Secret"}) {
+			tc.types[node] = typ
+		}
+	case *ast.UnaryExpr:
+		tc.check(node.X)
+		if typ, ok := tc.types[node.X]; ok {
+			tc.types[node] = typ
+		}
 	case *ast.FuncDecl:
 		tc.types[node.Name] = WellType{"Function"}
 
 		if node.IsExternal {
-			tc.externalDecls[node.Name.Name] = struct{}{}
+			var template = node.Template()
+			if name := commandName(template); name != "" {
+				tc.addCommand(name, template.Pos())
+			}
 		}
 
 		tc.check(node.Signature)
+		tc.locals = make(map[string]Type)
+		tc.currFunc = node.Name.Name
+		defer func() {
+			tc.locals = nil
+			tc.currFunc = ""
+		}()
+		for _, args := range [][]ast.FuncSignatureArg{node.Signature.Args, node.Signature.PipedArgs} {
+			for _, arg := range args {
+				if arg.Type == "secret" || tc.secretArgs[node.Name.Name][arg.Name] {
+					tc.locals[arg.Name] = WellType{"Secret"}
+				}
+			}
+		}
 		for _, stmt := range node.Body.Statements {
 			tc.check(stmt)
 		}
@@ -137,23 +360,149 @@ func (tc *typeChecker) check(node ast.Node) {
 		tc.types[node] = WellType{"Float"}
 	case *ast.String:
 		tc.types[node] = WellType{"String"}
+		for _, name := range interpolatedNames(node.Root) {
+			// a field of a record, e.g. ${db.token}, is a secret if the
+			// record is
+			name = strings.SplitN(name, ".", 2)[0]
+			if typ, _ := tc.lookup(name); typ == (WellType{"Secret"}) {
+				tc.types[node] = typ
+			}
+		}
+		for _, interpolation := range node.Interpolations {
+			tc.check(interpolation.X)
+			if typ := tc.types[interpolation.X]; typ == (WellType{"Secret"}) {
+				tc.types[node] = typ
+			}
+		}
+	case *ast.RequiresDecl:
+		switch node.Kind {
+		case "file":
+			tc.addFile(node.Name, node)
+		case "command":
+			tc.addCommand(node.Name, node.Pos())
+		}
 	case *ast.LetDecl:
 		tc.check(node.Rhs)
 		tc.types[node.Name] = tc.types[node.Rhs]
+		if typ, ok := tc.types[node.Rhs]; ok && tc.locals != nil {
+			tc.locals[node.Name.Name] = typ
+		}
 	default:
-		panic(tc.newError(node.Pos(), "unsupported node type %T", node))
+		panic(tc.newError(node, "unsupported node type %T", node))
+	}
+}
+
+// secretFuncs are the builtins that return secrets.
+var secretFuncs = map[string]bool{
+	"secret_env":  true,
+	"read_secret": true,
+}
+
+// containerFuncs are the builtins that return a value holding their
+// arguments, and the type of the value.
+var containerFuncs = map[string]Type{
+	"list":   WellType{"List"},
+	"record": WellType{"Record"},
+}
+
+// printFuncs are the builtins that print their arguments.
+var printFuncs = map[string]bool{
+	"print":        true,
+	"println":      true,
+	"print_stream": true,
+	"exit":         true,
+}
+
+// passSecrets records the args of function name that are given a secret
+// in a call.
+func (tc *typeChecker) passSecrets(name string, args []ast.FuncSignatureArg, values *ast.ParenExpr) {
+	if values == nil {
+		return
+	}
+	for i, value := range values.Exprs {
+		if i >= len(args) || tc.types[value] != (WellType{"Secret"}) {
+			continue
+		}
+		if tc.secretArgs[name] == nil {
+			tc.secretArgs[name] = make(map[string]bool)
+		}
+		if !tc.secretArgs[name][args[i].Name] {
+			tc.secretArgs[name][args[i].Name] = true
+			tc.foundSecrets = true
+		}
+	}
+}
+
+func isNumber(typ Type) bool {
+	return typ == (WellType{"Integer"}) || typ == (WellType{"Float"})
+}
+
+// lookup returns the type of a variable of the function being checked or of
+// a top level declaration.
+func (tc *typeChecker) lookup(name string) (Type, bool) {
+	if typ, ok := tc.locals[name]; ok {
+		return typ, true
+	}
+	var typ, ok = tc.globals[name]
+	return typ, ok
+}
+
+// interpolatedNames returns the names of the variables interpolated in a
+// string.
+func interpolatedNames(node strs_parser.CmdNode) []string {
+	var names []string
+	switch node := node.(type) {
+	case *strs_parser.Root:
+		for _, item := range node.Items {
+			names = append(names, interpolatedNames(item)...)
+		}
+	case strs_parser.ContainerNode:
+		for _, item := range node.Items {
+			names = append(names, interpolatedNames(item)...)
+		}
+	case strs_parser.Var:
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// declare records the type of a top level declaration.
+func (tc *typeChecker) declare(decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		tc.globals[decl.Name.Name] = WellType{"Function"}
+	case *ast.LetDecl:
+		if typ, ok := tc.types[decl.Rhs]; ok {
+			tc.globals[decl.Name.Name] = typ
+		}
 	}
 }
 
 type Error struct {
-	err error
+	Pos scanner.Pos
+	Msg string
+
+	err        error
+	diagnostic diagnostics.Diagnostic
 }
 
 func (i Error) Error() string {
 	return i.err.Error()
 }
 
-func (tc *typeChecker) newError(pos scanner.Pos, f string, args ...any) error {
-	var lines = tc.parser.MarkAt(pos, fmt.Sprintf(f, args...), false)
-	return Error{fmt.Errorf("%s", strings.Join(lines, "\n"))}
+func (i Error) Diagnostics() []diagnostics.Diagnostic {
+	return []diagnostics.Diagnostic{i.diagnostic}
+}
+
+// newError returns an error that spans node.
+func (tc *typeChecker) newError(node ast.Node, f string, args ...any) error {
+	var pos = node.Pos()
+	var msg = fmt.Sprintf(f, args...)
+	var lines = tc.parser.MarkSpan(pos, node.End(), msg, false)
+	return Error{
+		Pos:        pos,
+		Msg:        msg,
+		err:        fmt.Errorf("%s", strings.Join(lines, "\n")),
+		diagnostic: diagnostics.New(diagnostics.CodeType, pos, node.End(), tc.parser.GetLineColAt, msg),
+	}
 }
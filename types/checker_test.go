@@ -2,11 +2,14 @@ package types_test
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/kr/pretty"
 	"github.com/siadat/well/syntax/ast"
 	"github.com/siadat/well/syntax/parser"
@@ -36,8 +39,8 @@ var testCases = []struct {
 			&ast.Ident{Name: "y", Position: 59}: types.WellType{"Float"},
 			&ast.Ident{Name: "z", Position: 81}: types.WellType{"Integer"},
 
-			&ast.Integer{Value: 123, Position: 85}: types.WellType{"Integer"},
-			&ast.Float{Value: 3.14, Position: 63}:  types.WellType{"Float"},
+			&ast.Integer{Value: 123, Lit: "123", Position: 85}:                                               types.WellType{"Integer"},
+			&ast.Float{Value: 3.14, Lit: "3.14", Position: 63}:                                               types.WellType{"Float"},
 			&ast.String{Root: parser.MustParseStr("hello", false, true), StringLit: `"hello"`, Position: 38}: types.WellType{"String"},
 
 			// ast.Ident{Name: "pipe", Position: 92}: types.WellType{"Function"},
@@ -89,3 +92,214 @@ type KeyValue struct {
 	Key   ast.Expr
 	Value types.Type
 }
+
+func TestDependencies(tt *testing.T) {
+	// the commands are looked up in a PATH with a stub command only, and the
+	// files in the directory of the program
+	var dir = tt.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), nil, 0o644); err != nil {
+		tt.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "well-stub-command"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		tt.Fatal(err)
+	}
+	tt.Setenv("PATH", dir)
+
+	var testCases = []struct {
+		src  string
+		want []types.Dependency
+	}{
+		{
+			src: `
+requires file "config.yaml"
+requires file "no_such_file.yaml"
+requires command "well-no-such-command"
+external stub(s string) => "well-stub-command ${s:%q}"
+external dynamic(cmd string) => "${cmd} --version"
+`,
+			want: []types.Dependency{
+				{Kind: "file", Name: "config.yaml", Path: filepath.Join(dir, "config.yaml"), Found: true, Line: 2, Column: 1},
+				{Kind: "file", Name: "no_such_file.yaml", Path: filepath.Join(dir, "no_such_file.yaml"), Found: false, Line: 3, Column: 1},
+				{Kind: "command", Name: "well-no-such-command", Found: false, Line: 4, Column: 1},
+				{Kind: "command", Name: "well-stub-command", Path: filepath.Join(dir, "well-stub-command"), Found: true, Line: 5, Column: 28},
+			},
+		},
+	}
+
+	for ti, tc := range testCases {
+		checker := types.NewChecker()
+		checker.SetDir(dir)
+		var _, err = checker.Check(strings.NewReader(tc.src))
+		if err != nil {
+			tt.Fatalf("check failed (test case %d)\nerr:\n%s", ti, err)
+		}
+
+		var cmpOpts = []cmp.Option{
+			cmp.FilterPath(func(p cmp.Path) bool { return p.Last().String() == ".Position" }, cmp.Ignore()),
+			cmpopts.IgnoreUnexported(types.Dependency{}),
+		}
+		if diff := cmp.Diff(tc.want, checker.Dependencies(), cmpOpts...); diff != "" {
+			tt.Fatalf("mismatching dependencies (test case %d)\ndiff guide:\n  - want\n  + got\ndiff:\n%s", ti, diff)
+		}
+
+		var unresolved = checker.UnresolvedDependencies()
+		if len(unresolved) != 2 {
+			tt.Fatalf("expected 2 unresolved dependencies, got %d: %q", len(unresolved), unresolved)
+		}
+	}
+}
+
+func TestPrintSecret(tt *testing.T) {
+	var testCases = []struct {
+		src     string
+		wantErr string
+	}{
+		{
+			src: `
+function main() {
+  let token = secret_env("TOKEN")
+  println("token:", token)
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function show(token secret) {
+  print("Bearer ${token}")
+}
+`,
+			wantErr: "cannot print a secret with print",
+		},
+		{
+			src: `
+function main() {
+  println(list("a", secret_env("TOKEN")))
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  println("token: ${secret_env(\"TOKEN\")}")
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  let db = record("user", "admin", "token", secret_env("TOKEN"))
+  println(db.user, db.token)
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  let db = record("token", secret_env("TOKEN"))
+  println("token: ${db.token}")
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  let tokens = list("a", read_secret())
+  println("first: ${tokens[0]}")
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  println("${print(read_secret())}")
+}
+`,
+			wantErr: "cannot print a secret with print",
+		},
+		{
+			// a secret given to a string arg
+			src: `
+function main() {
+  fail("token=${secret_env(\"TOKEN\")}")
+}
+function fail(msg string) {
+  exit(1, msg)
+}
+`,
+			wantErr: "cannot print a secret with exit",
+		},
+		{
+			// a secret returned by a function declared later
+			src: `
+function main() {
+  println(token())
+}
+function token() string {
+  if true {
+    return wrap(secret_env("TOKEN"))
+  }
+  return ""
+}
+function wrap(s string) string {
+  return "Bearer ${s}"
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+function main() {
+  show(secret_env("TOKEN"))
+  greet("world")
+}
+function show(s string) {
+  greet(s)
+}
+function greet(name string) {
+  println("hello ${name}")
+}
+`,
+			wantErr: "cannot print a secret with println",
+		},
+		{
+			src: `
+external curl(header string) => "curl -H ${header:%q}"
+let token = read_secret()
+function main() {
+  let header = "Authorization: ${token}"
+  curl(header)
+  println("done")
+}
+`,
+		},
+		{
+			// echo is not a builtin, an external echo is given the secret
+			src: `
+external echo(s string) => "echo ${s}"
+function main() {
+  echo(secret_env("TOKEN"))
+}
+`,
+		},
+	}
+
+	for ti, tc := range testCases {
+		checker := types.NewChecker()
+		var _, err = checker.Check(strings.NewReader(tc.src))
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Fatalf("check failed (test case %d)\nerr:\n%s", ti, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Fatalf("expected error %q (test case %d), got: %v", tc.wantErr, ti, err)
+		}
+	}
+}
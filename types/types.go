@@ -26,3 +26,5 @@ type WellType struct {
 
 // func (Basic) isType() {}
 func (WellType) isType() {}
+
+func (t WellType) String() string { return t.Name }